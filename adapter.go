@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// adapterConflicts are the flags that need go test and can't be used with
+// --command.
+var adapterConflicts = []struct {
+	flag string
+	set  func(c config) bool
+}{
+	{"--proftype", func(c config) bool { return c.ProfType != "" }},
+	{"--profcallgrind", func(c config) bool { return c.ProfCallgrind }},
+	{"--xctrace", func(c config) bool { return c.Xctrace != "" }},
+	{"--etw", func(c config) bool { return c.ETW != "" }},
+	{"--perf-stat", func(c config) bool { return c.PerfStat }},
+	{"--instructions", func(c config) bool { return c.Instructions }},
+	{"--cachegrind", func(c config) bool { return c.Cachegrind }},
+	{"--bce", func(c config) bool { return c.BCE }},
+	{"--parallel", func(c config) bool { return c.Parallel > 0 }},
+	{"--parallel-build", func(c config) bool { return c.ParallelBuild }},
+	{"--keep-going", func(c config) bool { return c.KeepGoing }},
+	{"--budget", func(c config) bool { return c.Budget > 0 }},
+	{"--shard", func(c config) bool { return c.Shard != "" }},
+	{"--affected", func(c config) bool { return c.Affected }},
+	{"--sparse", func(c config) bool { return c.Sparse }},
+	{"--verify", func(c config) bool { return c.Verify }},
+}
+
+// adapterConflict returns the first flag set that can't be used with
+// --command, empty if none.
+func (c config) adapterConflict() string {
+	for _, conflict := range adapterConflicts {
+		if conflict.set(c) {
+			return conflict.flag
+		}
+	}
+	return ""
+}
+
+// runAdapter runs the --command for ref count times in the checkout. The
+// command must print its results in the Go benchmark format, which are
+// written to output.
+func (r runner) runAdapter(ref string, count int, env []string, output, errOutput io.Writer) error {
+	return r.withSweep(env, output, func(env []string, output io.Writer) error {
+		var buf bytes.Buffer
+		cmd := shellCommandContext(r.context(), r.Command)
+		cmd.Dir = r.workDir
+		cmd.Env = append(append(os.Environ(), env...),
+			"GOBENCH_REF="+ref,
+			"GOBENCH_COUNT="+strconv.Itoa(count),
+			"GOBENCH_BENCH="+r.Bench,
+			"GOBENCH_PACKAGE="+r.Package,
+			"GOBENCH_OUTDIR="+r.OutDir,
+		)
+		cmd.Stdout = io.MultiWriter(output, &buf)
+		cmd.Stderr = errOutput
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+		if !hasBenchmarkResults(buf.Bytes()) {
+			return fmt.Errorf("printed no benchmark results in the Go benchmark format, e.g. \"BenchmarkFoo 1 1234 ns/op\"")
+		}
+		return nil
+	})
+}
+
+// hasBenchmarkResults reports whether output has at least one result line
+// in the Go benchmark format.
+func hasBenchmarkResults(output []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if _, ok := parseBenchResult(scanner.Text()); ok {
+			return true
+		}
+	}
+	return false
+}
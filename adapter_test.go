@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestHasBenchmarkResults(t *testing.T) {
+	for _, test := range []struct {
+		output string
+		want   bool
+	}{
+		{"BenchmarkHTTP 1000 123 ns/op\n", true},
+		{"goos: linux\nBenchmarkHTTP/path=/-8 1000 123.5 ns/op 12 B/op\nPASS\n", true},
+		{"Requests/sec: 1234\n", false},
+		{"BenchmarkHTTP done\n", false},
+		{"", false},
+	} {
+		if got := hasBenchmarkResults([]byte(test.output)); got != test.want {
+			t.Errorf("%q: got %t, want %t", test.output, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// affectedRef returns the ref to look for changes against with --affected.
+func (r runner) affectedRef(hasUncommitted bool) (string, error) {
+	switch {
+	case hasUncommitted:
+		// The stash is relative to HEAD.
+		return "HEAD", nil
+	case r.HistoryWindow > 0:
+		return r.HistoryBranch, nil
+	case r.Base != "":
+		return r.Base, nil
+	}
+	return "", fmt.Errorf("--affected requires a git base to diff against, e.g. --base")
+}
+
+// affectedPackages returns the packages matching --package with benchmarks
+// that are affected by the changes since ref, that is packages with changed
+// files or depending (also in tests) on packages with changed files.
+// All packages with tests are affected if go.mod or go.sum changed.
+func (r runner) affectedPackages(ref string) ([]string, error) {
+	root, err := gitOutput(r.workDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	diff, err := gitOutput(r.workDir, "diff", "--name-only", ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var moduleChanged bool
+	changedDirs := make(map[string]bool)
+	for _, filename := range strings.Split(diff, "\n") {
+		if filename == "" {
+			continue
+		}
+		if base := filepath.Base(filename); base == "go.mod" || base == "go.sum" {
+			moduleChanged = true
+		}
+		changedDirs[filepath.Dir(filepath.Join(root, filename))] = true
+	}
+
+	// The test main package, p.test, depends on everything needed
+	// to build the tests of p, including the test only dependencies.
+	cmd := exec.Command(goExe, "list", "-test", "-deps", "-f", "{{.ImportPath}}\t{{.Dir}}\t{{join .Deps \" \"}}", r.Package)
+	cmd.Dir = r.workDir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list failed: %s", err)
+	}
+
+	dirs := make(map[string]string)
+	tests := make(map[string][]string)
+	var testPackages []string
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		importPath := trimTestVariant(fields[0])
+		if pkg := strings.TrimSuffix(importPath, ".test"); pkg != importPath {
+			tests[pkg] = strings.Fields(fields[2])
+			testPackages = append(testPackages, pkg)
+			continue
+		}
+		dirs[importPath] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var affected []string
+	for _, pkg := range testPackages {
+		if moduleChanged || changedDirs[dirs[pkg]] {
+			affected = append(affected, pkg)
+			continue
+		}
+		for _, dep := range tests[pkg] {
+			if dir, found := dirs[trimTestVariant(dep)]; found && changedDirs[dir] {
+				affected = append(affected, pkg)
+				break
+			}
+		}
+	}
+
+	return affected, nil
+}
+
+// trimTestVariant trims the test variant suffix from an import path
+// from go list -test, e.g. "example.com/p [example.com/p.test]".
+func trimTestVariant(importPath string) string {
+	if i := strings.Index(importPath, " ["); i != -1 {
+		return importPath[:i]
+	}
+	return importPath
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// runChunk records a chunk of counts run for a ref with --alternate.
+type runChunk struct {
+	Ref   string    `json:"ref"`
+	Count int       `json:"count"`
+	Start int64     `json:"start"`
+	End   int64     `json:"end"`
+	Time  time.Time `json:"time"`
+}
+
+// runAlternating runs the counts for the base and the current ref in chunks
+// of --alternate counts, alternating between them, so drift over time affects
+// both. The base is run in a git worktree to avoid repeated checkouts.
+// The per-ref setup, e.g. --generate and the hooks, is done once per ref
+// before its first chunk, each chunk only runs the measured step.
+// The chunk boundaries in the result files are recorded in the state file.
+func (r *runner) runAlternating(exe1, exe2, first, second, baseRef string) (err error) {
+	base := *r
+	if baseRef != second {
+		dir, remove, err := r.addWorktree(baseRef)
+		if err != nil {
+			return err
+		}
+		defer remove()
+		base.workDir = dir
+	}
+
+	refs := []*struct {
+		r         runner
+		exe, name string
+		count     int
+		env       []string
+		setUp     bool
+	}{
+		{r: base, exe: exe1, name: first, count: r.countBase(), env: r.EnvBase},
+		{r: *r, exe: exe2, name: second, count: r.countCurrent(), env: r.EnvCurrent},
+	}
+
+	for target := r.Alternate; ; target += r.Alternate {
+		var remaining bool
+		for _, ref := range refs {
+			count := target
+			if count > ref.count {
+				count = ref.count
+			}
+			start := r.state.Offsets[ref.name]
+			done := r.state.Completed[ref.name]
+			if done >= count {
+				continue
+			}
+			if !ref.setUp {
+				teardown, err := ref.r.setupRun(ref.exe, ref.name)
+				if err != nil {
+					return err
+				}
+				defer func() {
+					if terr := teardown(); terr != nil && err == nil {
+						err = terr
+					}
+				}()
+				ref.setUp = true
+			}
+			fmt.Printf("Run %d to %d of %d for %q.\n", done+1, count, ref.count, ref.name)
+			if err := ref.r.runMeasured(ref.exe, ref.name, count, ref.env); err != nil {
+				return err
+			}
+			if err := r.state.addChunk(runChunk{Ref: ref.name, Count: count - done, Start: start, End: r.state.Offsets[ref.name], Time: time.Now()}); err != nil {
+				return err
+			}
+			if count < ref.count {
+				remaining = true
+			}
+		}
+		if !remaining {
+			return nil
+		}
+	}
+}
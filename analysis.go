@@ -0,0 +1,548 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// alpha is the significance level used when comparing results.
+const alpha = 0.05
+
+// comparison holds the comparison of one benchmark and unit between two
+// result sets.
+type comparison struct {
+	Name string `json:"name"`
+	Unit string `json:"unit"`
+
+	Old []float64 `json:"-"`
+	New []float64 `json:"-"`
+
+	OldMean float64 `json:"old"`
+	NewMean float64 `json:"new"`
+
+	// Delta is the relative change from old to new in percent.
+	Delta float64 `json:"delta"`
+
+	// P is the p-value of the Mann-Whitney U-test.
+	P float64 `json:"p"`
+
+	Significant bool `json:"significant"`
+
+	// HigherIsBetter is set for units where an increase is an improvement,
+	// e.g. MB/s.
+	HigherIsBetter bool `json:"higherIsBetter"`
+
+	// Exact is set for units without noise, where any change is significant.
+	Exact bool `json:"exact,omitempty"`
+
+	// CV is the pooled coefficient of variation of the samples and CI the
+	// half width of the 95% confidence interval of Delta, both in percent.
+	CV float64 `json:"cv"`
+	CI float64 `json:"ci"`
+
+	// RecommendedCount is the count needed to detect a change of
+	// PowerDelta, 0 if not set.
+	RecommendedCount int `json:"recommendedCount,omitempty"`
+
+	// Quarantined is set for the benchmarks in the quarantine list of the
+	// config file, which never violate the threshold.
+	Quarantined bool `json:"quarantined,omitempty"`
+
+	// BelowNoiseFloor is set for the significant changes smaller than the
+	// noise floor, which are reported as not significant.
+	BelowNoiseFloor bool `json:"belowNoiseFloor,omitempty"`
+}
+
+// regression reports whether this is a significant change for the worse.
+func (c comparison) regression() bool {
+	return c.Significant && c.Delta != 0 && (c.Delta > 0) != c.HigherIsBetter
+}
+
+// improvement reports whether this is a significant change for the better.
+func (c comparison) improvement() bool {
+	return c.Significant && c.Delta != 0 && (c.Delta < 0) != c.HigherIsBetter
+}
+
+// lowerIsBetter reports whether lower values are better for unit by default.
+func lowerIsBetter(unit string) bool {
+	// Throughput, e.g. MB/s.
+	return !strings.HasSuffix(unit, "/s")
+}
+
+// summary holds the comparison of two result sets.
+type summary struct {
+	Base    string `json:"base"`
+	Current string `json:"current"`
+
+	Comparisons []comparison `json:"comparisons"`
+
+	// Removed and Added hold the benchmarks only found in the base and only
+	// found in the current results, e.g. because they were renamed.
+	Removed []string `json:"removed"`
+	Added   []string `json:"added"`
+
+	// Geomeans holds the geometric mean of the changes per unit.
+	Geomeans []geomean `json:"geomeans"`
+
+	// Threshold is the max allowed regression in percent, 0 if not set.
+	Threshold float64 `json:"threshold,omitempty"`
+
+	// Violations holds the regressions exceeding Threshold.
+	Violations []comparison `json:"violations"`
+
+	// NoiseFloor is the min change in percent considered significant,
+	// 0 if not set.
+	NoiseFloor float64 `json:"noiseFloor,omitempty"`
+
+	// PowerDelta is the change in percent to recommend counts for, 0 if not
+	// set, and RecommendedCount the max count needed to detect it.
+	PowerDelta       float64 `json:"powerDelta,omitempty"`
+	RecommendedCount int     `json:"recommendedCount,omitempty"`
+
+	// Retries and Throttled map the result names to the number of failed
+	// runs that were retried and of runs that were throttled, if any.
+	Retries   map[string]int `json:"retries,omitempty"`
+	Throttled map[string]int `json:"throttled,omitempty"`
+
+	// Collapse is set to only list the geomean of sub-benchmarks per parent
+	// in reports.
+	Collapse bool `json:"-"`
+
+	// Plots is set to show box plots of the spread of the samples in
+	// reports.
+	Plots bool `json:"-"`
+
+	// Report is the rendered text report.
+	Report string `json:"-"`
+}
+
+// geomean is the geometric mean of the relative changes for a unit across
+// all benchmarks.
+type geomean struct {
+	Unit string `json:"unit"`
+
+	// Delta is the geometric mean change in percent.
+	Delta float64 `json:"delta"`
+
+	Improved  int `json:"improved"`
+	Regressed int `json:"regressed"`
+	Unchanged int `json:"unchanged"`
+}
+
+// newSummary compares the results in bf1 (base) and bf2 (current).
+// Only benchmarks and units present in both are compared.
+// units holds the semantics of units, e.g. custom units reported with
+// b.ReportMetric where higher values are better.
+func newSummary(base, current string, bf1, bf2 *benchFile, units map[string]unitMeta) *summary {
+	s := &summary{Base: base, Current: current}
+
+	oldSamples, newSamples := bf1.samples(), bf2.samples()
+	for _, key := range sortedKeys(oldSamples) {
+		newValues, found := newSamples[key]
+		if !found {
+			continue
+		}
+		oldValues := oldSamples[key]
+		meta := units[key.unit]
+		c := comparison{
+			Name:    key.name,
+			Unit:    key.unit,
+			Old:     oldValues,
+			New:     newValues,
+			OldMean: mean(oldValues),
+			NewMean: mean(newValues),
+
+			HigherIsBetter: meta.higherIsBetter(key.unit),
+			Exact:          meta.Assume == "exact",
+		}
+		if c.OldMean != 0 {
+			c.Delta = (c.NewMean - c.OldMean) / c.OldMean * 100
+		}
+		c.CV, c.CI = c.cv()*100, c.ci()
+		c.P = mannWhitneyU(oldValues, newValues)
+		c.Significant = c.P < alpha
+		if c.Exact {
+			c.Significant = c.OldMean != c.NewMean
+		}
+		s.Comparisons = append(s.Comparisons, c)
+	}
+
+	s.Removed, s.Added = benchmarkNames(bf1).diff(benchmarkNames(bf2))
+	s.Geomeans = geomeans(s.Comparisons)
+
+	return s
+}
+
+// geomeans computes the geometric mean of the changes per unit, in the
+// order the units are first seen.
+func geomeans(comparisons []comparison) []geomean {
+	var (
+		units []string
+		means = make(map[string]*geomean)
+		logs  = make(map[string]float64)
+		n     = make(map[string]int)
+	)
+	for _, c := range comparisons {
+		g, found := means[c.Unit]
+		if !found {
+			g = &geomean{Unit: c.Unit}
+			means[c.Unit] = g
+			units = append(units, c.Unit)
+		}
+		switch {
+		case c.regression():
+			g.Regressed++
+		case c.improvement():
+			g.Improved++
+		default:
+			g.Unchanged++
+		}
+		if c.OldMean > 0 && c.NewMean > 0 {
+			logs[c.Unit] += math.Log(c.NewMean / c.OldMean)
+			n[c.Unit]++
+		}
+	}
+
+	result := make([]geomean, 0, len(units))
+	for _, unit := range units {
+		g := *means[unit]
+		if n[unit] > 0 {
+			g.Delta = (math.Exp(logs[unit]/float64(n[unit])) - 1) * 100
+		}
+		result = append(result, g)
+	}
+	return result
+}
+
+// group holds the comparisons for a benchmark and its sub-benchmarks,
+// e.g. BenchmarkFoo/size=1K and BenchmarkFoo/size=1M.
+type group struct {
+	Name        string
+	Comparisons []comparison
+	Geomeans    []geomean
+}
+
+// hasSubs reports whether the group holds sub-benchmarks.
+func (g group) hasSubs() bool {
+	for _, c := range g.Comparisons {
+		if strings.Contains(c.Name, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// groups returns the comparisons grouped by top level benchmark name,
+// in the order they are first seen.
+func (s *summary) groups() []group {
+	var groups []group
+	index := make(map[string]int)
+	for _, c := range s.Comparisons {
+		name := trimProcsSuffix(c.Name)
+		if i := strings.Index(name, "/"); i != -1 {
+			name = name[:i]
+		}
+		i, found := index[name]
+		if !found {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, group{Name: name})
+		}
+		groups[i].Comparisons = append(groups[i].Comparisons, c)
+	}
+	for i := range groups {
+		groups[i].Geomeans = geomeans(groups[i].Comparisons)
+	}
+	return groups
+}
+
+// violation reports whether c is a threshold violation.
+func (s *summary) violation(c comparison) bool {
+	for _, v := range s.Violations {
+		if v.Name == c.Name && v.Unit == c.Unit {
+			return true
+		}
+	}
+	return false
+}
+
+// applyNoiseFloor marks the changes smaller than floor percent as not
+// significant, whatever the p-value, so they're neither regressions nor
+// improvements.
+func (s *summary) applyNoiseFloor(floor float64) {
+	s.NoiseFloor = floor
+	if floor <= 0 {
+		return
+	}
+	for i, c := range s.Comparisons {
+		if c.Significant && math.Abs(c.Delta) < floor {
+			s.Comparisons[i].Significant = false
+			s.Comparisons[i].BelowNoiseFloor = true
+		}
+	}
+	s.Geomeans = geomeans(s.Comparisons)
+}
+
+// noiseFloorNotes returns the lines listing the significant changes below
+// the noise floor, empty if none. The text format prints the benchstat
+// output as is, which still shows them as changes.
+func (s *summary) noiseFloorNotes() string {
+	below := s.filterSorted(func(c comparison) bool {
+		return c.BelowNoiseFloor
+	})
+	if len(below) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\nChanges below the noise floor of %g%%, treated as ~:\n", s.NoiseFloor)
+	for _, c := range below {
+		fmt.Fprintf(&sb, "  %s %s: %+.2f%%\n", c.Name, c.Unit, c.Delta)
+	}
+	return sb.String()
+}
+
+// percent is a percentage flag value, e.g. 2 or 2%.
+type percent float64
+
+func (p *percent) UnmarshalText(b []byte) error {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(string(b)), "%"), 64)
+	if err != nil {
+		return fmt.Errorf("invalid percentage %q", b)
+	}
+	*p = percent(v)
+	return nil
+}
+
+// applyThreshold sets the threshold and collects the regressions exceeding it.
+// If units is set, only regressions in those units are violations. The
+// quarantined benchmarks are never violations.
+func (s *summary) applyThreshold(threshold float64, units []string) {
+	s.Threshold = threshold
+	s.Violations = nil
+	if threshold <= 0 {
+		return
+	}
+	for _, c := range s.regressions() {
+		if c.Quarantined || (units != nil && !contains(units, c.Unit)) {
+			continue
+		}
+		if math.Abs(c.Delta) > threshold {
+			s.Violations = append(s.Violations, c)
+		}
+	}
+}
+
+// regressions returns the significant regressions, worst first.
+func (s *summary) regressions() []comparison {
+	return s.filterSorted(comparison.regression)
+}
+
+// improvements returns the significant improvements, best first.
+func (s *summary) improvements() []comparison {
+	return s.filterSorted(comparison.improvement)
+}
+
+func (s *summary) filterSorted(keep func(c comparison) bool) []comparison {
+	var filtered []comparison
+	for _, c := range s.Comparisons {
+		if keep(c) {
+			filtered = append(filtered, c)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return math.Abs(filtered[i].Delta) > math.Abs(filtered[j].Delta)
+	})
+	return filtered
+}
+
+type nameSet map[string]bool
+
+func benchmarkNames(bf *benchFile) nameSet {
+	names := make(nameSet)
+	for _, r := range bf.Results {
+		names[r.Name] = true
+	}
+	return names
+}
+
+// diff returns the sorted names only in s and the sorted names only in other.
+func (s nameSet) diff(other nameSet) ([]string, []string) {
+	only := func(a, b nameSet) []string {
+		var names []string
+		for name := range a {
+			if !b[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+	return only(s, other), only(other, s)
+}
+
+type sampleKey struct {
+	name string
+	unit string
+}
+
+// samples returns all values per benchmark and unit.
+func (bf *benchFile) samples() map[sampleKey][]float64 {
+	m := make(map[sampleKey][]float64)
+	for _, r := range bf.Results {
+		for _, v := range r.Values {
+			key := sampleKey{name: r.Name, unit: v.Unit}
+			m[key] = append(m[key], v.Value)
+		}
+	}
+	return m
+}
+
+func sortedKeys(m map[sampleKey][]float64) []sampleKey {
+	keys := make([]sampleKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].unit < keys[j].unit
+	})
+	return keys
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// exactLimit is the max number of combined samples for which the exact
+// distribution of the U statistic is computed.
+const exactLimit = 20
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U-test for
+// the null hypothesis that x and y come from the same distribution.
+func mannWhitneyU(x, y []float64) float64 {
+	n1, n2 := len(x), len(y)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	pooled := append(append([]float64(nil), x...), y...)
+	if allEqual(pooled) {
+		return 1
+	}
+	ranks, tieCorrection := rank(pooled)
+
+	var r1 float64
+	for i := 0; i < n1; i++ {
+		r1 += ranks[i]
+	}
+	u := r1 - float64(n1*(n1+1))/2
+	mu := float64(n1*n2) / 2
+
+	if n1+n2 <= exactLimit {
+		return exactUPValue(ranks, n1, math.Abs(u-mu))
+	}
+
+	n := float64(n1 + n2)
+	sigma := math.Sqrt(float64(n1*n2) / 12 * ((n + 1) - tieCorrection/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	// With continuity correction.
+	z := (math.Abs(u-mu) - 0.5) / sigma
+	if z < 0 {
+		z = 0
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// exactUPValue computes the two-sided p-value by enumerating all ways to
+// assign the ranks to the first group.
+func exactUPValue(ranks []float64, n1 int, observed float64) float64 {
+	n := len(ranks)
+	mu := float64(n1*(n-n1)) / 2
+	offset := float64(n1*(n1+1)) / 2
+
+	var total, extreme float64
+	var walk func(start, remaining int, sum float64)
+	walk = func(start, remaining int, sum float64) {
+		if remaining == 0 {
+			total++
+			// Small epsilon to count ties with the observed value.
+			if math.Abs(sum-offset-mu) >= observed-1e-9 {
+				extreme++
+			}
+			return
+		}
+		for i := start; i <= n-remaining; i++ {
+			walk(i+1, remaining-1, sum+ranks[i])
+		}
+	}
+	walk(0, n1, 0)
+
+	return extreme / total
+}
+
+// rank returns the ranks of values, using the average rank for ties,
+// and the tie correction, the sum of t^3-t over all groups of t ties.
+func rank(values []float64) ([]float64, float64) {
+	n := len(values)
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return values[idx[i]] < values[idx[j]] })
+
+	ranks := make([]float64, n)
+	var tieCorrection float64
+	for i := 0; i < n; {
+		j := i
+		for j+1 < n && values[idx[j+1]] == values[idx[i]] {
+			j++
+		}
+		r := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			ranks[idx[k]] = r
+		}
+		t := float64(j - i + 1)
+		if t > 1 {
+			tieCorrection += t*t*t - t
+		}
+		i = j + 1
+	}
+
+	return ranks, tieCorrection
+}
+
+func allEqual(values []float64) bool {
+	for _, v := range values {
+		if v != values[0] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMannWhitneyU(t *testing.T) {
+	for _, test := range []struct {
+		x, y []float64
+		p    float64
+	}{
+		// Values checked against R's wilcox.test(x, y, exact=TRUE).
+		{[]float64{1, 2, 3, 4}, []float64{5, 6, 7, 8}, 0.02857},
+		{[]float64{1, 3, 5, 7}, []float64{2, 4, 6, 8}, 0.6857},
+		{[]float64{1, 1, 1}, []float64{1, 1, 1}, 1},
+		{[]float64{1, 2}, []float64{3}, 0.6667},
+	} {
+		if p := mannWhitneyU(test.x, test.y); math.Abs(p-test.p) > 0.001 {
+			t.Errorf("mannWhitneyU(%v, %v) = %v, expected %v", test.x, test.y, p, test.p)
+		}
+	}
+}
+
+func TestNewSummary(t *testing.T) {
+	bf1, _ := parseBenchFile(strings.NewReader(`BenchmarkA-4	10	100 ns/op	16 B/op
+BenchmarkA-4	10	101 ns/op	16 B/op
+BenchmarkA-4	10	102 ns/op	16 B/op
+BenchmarkA-4	10	103 ns/op	16 B/op
+BenchmarkOld-4	10	100 ns/op
+`))
+	bf2, _ := parseBenchFile(strings.NewReader(`BenchmarkA-4	10	150 ns/op	16 B/op
+BenchmarkA-4	10	151 ns/op	16 B/op
+BenchmarkA-4	10	152 ns/op	16 B/op
+BenchmarkA-4	10	153 ns/op	16 B/op
+`))
+
+	s := newSummary("base", "current", bf1, bf2, nil)
+	if len(s.Comparisons) != 2 {
+		t.Fatalf("expected 2 comparisons, got %d", len(s.Comparisons))
+	}
+	if len(s.Removed) != 1 || s.Removed[0] != "BenchmarkOld-4" || len(s.Added) != 0 {
+		t.Fatalf("got removed %v and added %v", s.Removed, s.Added)
+	}
+	regressions := s.regressions()
+	if len(regressions) != 1 || regressions[0].Unit != "ns/op" {
+		t.Fatalf("unexpected regressions: %v", regressions)
+	}
+	if d := regressions[0].Delta; math.Abs(d-49.26) > 0.01 {
+		t.Fatalf("got delta %v", d)
+	}
+	if len(s.improvements()) != 0 {
+		t.Fatal("expected no improvements")
+	}
+
+	s.applyThreshold(50, nil)
+	if len(s.Violations) != 0 {
+		t.Fatalf("expected no violations, got %v", s.Violations)
+	}
+	s.applyThreshold(10, nil)
+	if len(s.Violations) != 1 {
+		t.Fatalf("expected 1 violation, got %v", s.Violations)
+	}
+	s.applyThreshold(10, allocUnits)
+	if len(s.Violations) != 0 {
+		t.Fatalf("expected no allocation violations, got %v", s.Violations)
+	}
+
+	s.applyNoiseFloor(50)
+	s.applyThreshold(10, nil)
+	if len(s.regressions()) != 0 || len(s.Violations) != 0 {
+		t.Fatalf("expected the regression below the noise floor to be ignored, got %v", s.regressions())
+	}
+	if notes := s.noiseFloorNotes(); !strings.Contains(notes, "noise floor of 50%") || strings.Count(notes, "\n  ") != 1 {
+		t.Fatalf("got notes %q", notes)
+	}
+}
+
+func TestGeomeans(t *testing.T) {
+	g := geomeans([]comparison{
+		{Name: "A", Unit: "ns/op", OldMean: 100, NewMean: 200},
+		{Name: "B", Unit: "ns/op", OldMean: 100, NewMean: 50},
+		{Name: "A", Unit: "B/op", OldMean: 0, NewMean: 16},
+	})
+	if len(g) != 2 || g[0].Unit != "ns/op" || g[1].Unit != "B/op" {
+		t.Fatalf("unexpected geomeans: %v", g)
+	}
+	if math.Abs(g[0].Delta) > 1e-9 || g[0].Unchanged != 2 {
+		t.Fatalf("got %v", g[0])
+	}
+	if g[1].Delta != 0 {
+		t.Fatalf("got %v", g[1])
+	}
+}
+
+func TestNewSummaryCustomMetrics(t *testing.T) {
+	bf1, _ := parseBenchFile(strings.NewReader(`BenchmarkA-4	10	100 requests/sec	10 cache-hits/op
+BenchmarkA-4	10	101 requests/sec	11 cache-hits/op
+BenchmarkA-4	10	102 requests/sec	12 cache-hits/op
+BenchmarkA-4	10	103 requests/sec	13 cache-hits/op
+`))
+	bf2, _ := parseBenchFile(strings.NewReader(`BenchmarkA-4	10	50 requests/sec	20 cache-hits/op
+BenchmarkA-4	10	51 requests/sec	21 cache-hits/op
+BenchmarkA-4	10	52 requests/sec	22 cache-hits/op
+BenchmarkA-4	10	53 requests/sec	23 cache-hits/op
+`))
+
+	s := newSummary("base", "current", bf1, bf2, nil)
+	if len(s.regressions()) != 1 || s.regressions()[0].Unit != "cache-hits/op" {
+		t.Fatalf("unexpected regressions: %v", s.regressions())
+	}
+
+	s = newSummary("base", "current", bf1, bf2, map[string]unitMeta{"requests/sec": {Better: "higher"}, "cache-hits/op": {Better: "higher"}})
+	if len(s.improvements()) != 1 || s.improvements()[0].Unit != "cache-hits/op" {
+		t.Fatalf("unexpected improvements: %v", s.improvements())
+	}
+	if len(s.regressions()) != 1 || s.regressions()[0].Unit != "requests/sec" {
+		t.Fatalf("unexpected regressions: %v", s.regressions())
+	}
+}
+
+func TestNewSummaryUnitMetadata(t *testing.T) {
+	bf1, _ := parseBenchFile(strings.NewReader(`Unit hits/op better=higher
+Unit objects/op assume=exact
+BenchmarkA-4	10	10 hits/op	5 objects/op
+BenchmarkA-4	10	10 hits/op	5 objects/op
+`))
+	bf2, _ := parseBenchFile(strings.NewReader(`BenchmarkA-4	10	5 hits/op	6 objects/op
+BenchmarkA-4	10	5 hits/op	6 objects/op
+`))
+	if m := bf1.Units["hits/op"]; m.Better != "higher" {
+		t.Fatalf("got unit metadata %v", bf1.Units)
+	}
+
+	s := newSummary("base", "current", bf1, bf2, runner{}.unitMetas(bf1, bf2))
+	if len(s.Comparisons) != 2 {
+		t.Fatalf("expected 2 comparisons, got %v", s.Comparisons)
+	}
+	hits, objects := s.Comparisons[0], s.Comparisons[1]
+	if !hits.HigherIsBetter || hits.Significant {
+		t.Fatalf("unexpected hits/op comparison: %v", hits)
+	}
+	if !objects.Exact || !objects.regression() {
+		t.Fatalf("unexpected objects/op comparison: %v", objects)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+)
+
+// badge is a shields.io endpoint badge, see https://shields.io/badges/endpoint-badge
+type badge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+func newBadge(s *summary) badge {
+	b := badge{SchemaVersion: 1, Label: "perf", Message: "no regression", Color: "brightgreen"}
+	regressions := s.regressions()
+	switch {
+	case len(s.Violations) > 0:
+		b.Message = fmt.Sprintf("%d regressions", len(s.Violations))
+		b.Color = "red"
+	case len(regressions) > 0:
+		b.Message = fmt.Sprintf("%+.1f%%", regressions[0].Delta)
+		b.Color = "yellow"
+	}
+	return b
+}
+
+// writeBadge writes a badge summarizing s to filename, as SVG if the
+// filename has a .svg extension, else as shields.io endpoint JSON.
+func writeBadge(filename string, s *summary) error {
+	b := newBadge(s)
+
+	var data []byte
+	if filepath.Ext(filename) == ".svg" {
+		data = []byte(b.svg())
+	} else {
+		var err error
+		if data, err = json.Marshal(b); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(filename, data, 0o644)
+}
+
+var badgeColors = map[string]string{
+	"brightgreen": "#4c1",
+	"yellow":      "#dfb317",
+	"red":         "#e05d44",
+}
+
+// svg renders the badge as a flat style SVG.
+func (b badge) svg() string {
+	// Approximate text widths for an 11px Verdana.
+	const charWidth, padding = 7, 10
+	lw := len(b.Label)*charWidth + padding
+	mw := len(b.Message)*charWidth + padding
+	w := lw + mw
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%[2]s: %[3]s">
+<rect width="%[4]d" height="20" fill="#555"/>
+<rect x="%[4]d" width="%[5]d" height="20" fill="%[6]s"/>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,sans-serif" font-size="11">
+<text x="%[7]d" y="14">%[2]s</text>
+<text x="%[8]d" y="14">%[3]s</text>
+</g>
+</svg>
+`, w, html.EscapeString(b.Label), html.EscapeString(b.Message), lw, mw, badgeColors[b.Color], lw/2, lw+mw/2)
+}
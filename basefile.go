@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// baseFilesDir is the directory in --outdir the --basefile URLs are
+// downloaded to.
+const baseFilesDir = "base-files"
+
+// isURL reports whether the --basefile s is an HTTP(S) URL.
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://")
+}
+
+// baseFiles returns the files in the comma separated --basefile list s,
+// with the glob patterns expanded and the URLs downloaded to --outdir. Each
+// download is verified against --basefile-sha256 or, if not set, the
+// checksum in <url>.sha256 if found, and with --verify-key, against the
+// signature in <url>.sig. The downloads are stored in a directory per entry
+// in the list, so URLs with the same file name don't overwrite each other.
+func (r runner) baseFiles(s string) ([]string, error) {
+	var filenames []string
+	for i, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !isURL(entry) {
+			matches, err := expandBenchFiles(entry)
+			if err != nil {
+				return nil, err
+			}
+			filenames = append(filenames, matches...)
+			continue
+		}
+		filename, err := r.downloadBaseFile(entry, filepath.Join(r.OutDir, baseFilesDir, strconv.Itoa(i+1)))
+		if err != nil {
+			return nil, err
+		}
+		filenames = append(filenames, filename)
+	}
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no files in %q", s)
+	}
+	return filenames, nil
+}
+
+// downloadBaseFile downloads and verifies the --basefile url to dir and
+// returns the filename.
+func (r runner) downloadBaseFile(url, dir string) (string, error) {
+	b, err := download(url)
+	if err != nil {
+		return "", err
+	}
+
+	want := r.BaseFileSHA256
+	if want == "" {
+		if want, err = downloadChecksum(url + ".sha256"); err != nil {
+			return "", err
+		}
+	}
+	if want != "" {
+		if sum := sha256.Sum256(b); !strings.EqualFold(want, hex.EncodeToString(sum[:])) {
+			return "", fmt.Errorf("checksum mismatch for %s", url)
+		}
+	} else if r.RequireChecksum {
+		return "", fmt.Errorf("no checksum found for %s in %s.sha256 and --require-checksum is set", url, url)
+	} else if r.VerifyKey == "" {
+		fmt.Printf("Warning: no checksum found for %s, the download is not verified.\n", url)
+	}
+
+	var sig []byte
+	if r.VerifyKey != "" {
+		if sig, err = download(url + ".sig"); err != nil {
+			return "", fmt.Errorf("no signature for %s: %s", url, err)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return "", err
+	}
+	name := path.Base(strings.SplitN(strings.SplitN(url, "?", 2)[0], "#", 2)[0])
+	if name == "" || name == "/" || name == "." {
+		name = "base.bench"
+	}
+	filename := filepath.Join(dir, name)
+	if err := os.WriteFile(filename, b, 0o644); err != nil {
+		return "", err
+	}
+	if sig != nil {
+		if err := r.verifyDownload(filename, sig); err != nil {
+			return "", err
+		}
+	}
+	fmt.Printf("Downloaded %s.\n", url)
+	return filename, nil
+}
+
+// downloadChecksum returns the SHA-256 checksum in the file at url, on the
+// form written by sha256sum, empty if there is no such file.
+func downloadChecksum(url string) (string, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("no checksum in %s", url)
+	}
+	return fields[0], nil
+}
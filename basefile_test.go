@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDownloadBaseFiles(t *testing.T) {
+	content := "BenchmarkFoo 100 10 ns/op\n"
+	sum := sha256.Sum256([]byte(content))
+	checksum := hex.EncodeToString(sum[:])
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/main-latest.bench", "/unverified.bench", "/other/main-latest.bench", "/run[1].bench":
+			w.Write([]byte(content))
+		case "/main-latest.bench.sha256":
+			w.Write([]byte(checksum + "  main-latest.bench\n"))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+
+	r := runner{config: config{OutDir: t.TempDir()}}
+	local := filepath.Join(r.OutDir, "local.bench")
+	if err := os.WriteFile(local, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.baseFiles(local + "," + srv.URL + "/main-latest.bench," + srv.URL + "/other/main-latest.bench," + srv.URL + "/run[1].bench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		local,
+		filepath.Join(r.OutDir, baseFilesDir, "2", "main-latest.bench"),
+		filepath.Join(r.OutDir, baseFilesDir, "3", "main-latest.bench"),
+		filepath.Join(r.OutDir, baseFilesDir, "4", "run[1].bench"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if b, err := os.ReadFile(want[1]); err != nil || string(b) != content {
+		t.Errorf("got %q: %v", b, err)
+	}
+
+	if _, err := r.baseFiles(srv.URL + "/unverified.bench"); err != nil {
+		t.Errorf("expected unverified download to succeed, got %v", err)
+	}
+	r.RequireChecksum = true
+	if _, err := r.baseFiles(srv.URL + "/unverified.bench"); err == nil || !strings.Contains(err.Error(), "no checksum") {
+		t.Errorf("expected missing checksum error, got %v", err)
+	}
+	if _, err := r.baseFiles(srv.URL + "/main-latest.bench"); err != nil {
+		t.Errorf("expected verified download to succeed, got %v", err)
+	}
+
+	r.BaseFileSHA256 = strings.Repeat("0", 64)
+	if _, err := r.baseFiles(srv.URL + "/main-latest.bench"); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+
+	if _, err := r.baseFiles(srv.URL + "/missing.bench"); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
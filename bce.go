@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// bceRe matches the compiler's bounds check diagnostics, e.g.
+// "./foo.go:10:6: Found IsInBounds".
+var bceRe = regexp.MustCompile(`^(.+\.go):(\d+):\d+: Found (Is\w*InBounds)$`)
+
+func (c config) bceFilename(name string) string {
+	return filepath.Join(c.OutDir, c.normalizeName(name)+".bce")
+}
+
+// captureBCE builds the benchmarked packages with the compiler's bounds
+// check diagnostics and saves the bounds checks for name, one per line with
+// the file, the kind of check and the source line. Line numbers are left
+// out, so unrelated edits don't show up in the diff.
+func (r runner) captureBCE(exeName, name string) error {
+	args := []string{"build", "-gcflags=-d=ssa/check_bce/debug=1"}
+	if r.Tags != "" {
+		args = append(args, "-tags", r.Tags)
+	}
+	cmd := exec.Command(exeName, append(args, r.packageArgs()...)...)
+	cmd.Dir = r.workDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to build with bounds check diagnostics: %s: %s", err, output)
+	}
+
+	sources := make(map[string][]string)
+	var checks []string
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		m := bceRe.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		file, kind := m[1], m[3]
+		line, _ := strconv.Atoi(m[2])
+		if _, found := sources[file]; !found {
+			b, _ := os.ReadFile(filepath.Join(r.workDir, file))
+			sources[file] = strings.Split(string(b), "\n")
+		}
+		var source string
+		if lines := sources[file]; line > 0 && line <= len(lines) {
+			source = strings.TrimSpace(lines[line-1])
+		}
+		checks = append(checks, strings.Join([]string{filepath.ToSlash(file), kind, source}, "\t"))
+	}
+	sort.Strings(checks)
+
+	return os.WriteFile(r.bceFilename(name), []byte(strings.Join(checks, "\n")), 0o666)
+}
+
+// diffBCE prints the bounds checks added and removed between name1
+// and name2.
+func (r runner) diffBCE(name1, name2 string) error {
+	checks1, err := readBCE(r.bceFilename(name1))
+	if err != nil {
+		return err
+	}
+	checks2, err := readBCE(r.bceFilename(name2))
+	if err != nil {
+		return err
+	}
+	added, removed := diffChecks(checks1, checks2)
+
+	fmt.Printf("\nBounds checks %s vs %s: %d => %d, %d added, %d removed\n", name1, name2, len(checks1), len(checks2), len(added), len(removed))
+	for _, check := range removed {
+		fmt.Printf("- %s\n", formatBCE(check))
+	}
+	for _, check := range added {
+		fmt.Printf("+ %s\n", formatBCE(check))
+	}
+	return nil
+}
+
+func readBCE(filename string) ([]string, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, nil
+	}
+	return strings.Split(string(b), "\n"), nil
+}
+
+// diffChecks returns the checks in checks2 but not in checks1 and the
+// checks in checks1 but not in checks2, counting duplicates, e.g. two
+// checks on the same source line.
+func diffChecks(checks1, checks2 []string) (added, removed []string) {
+	counts := make(map[string]int)
+	for _, check := range checks1 {
+		counts[check]++
+	}
+	for _, check := range checks2 {
+		if counts[check] > 0 {
+			counts[check]--
+			continue
+		}
+		added = append(added, check)
+	}
+	for _, check := range checks1 {
+		if counts[check] > 0 {
+			counts[check]--
+			removed = append(removed, check)
+		}
+	}
+	return added, removed
+}
+
+// formatBCE formats a saved check as e.g. "foo.go: IsInBounds: v := s[i]".
+func formatBCE(check string) string {
+	return strings.Replace(check, "\t", ": ", -1)
+}
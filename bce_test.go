@@ -0,0 +1,19 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffChecks(t *testing.T) {
+	added, removed := diffChecks(
+		[]string{"a.go\tIsInBounds\tv := s[i]", "a.go\tIsInBounds\tv := s[i]", "b.go\tIsSliceInBounds\ts = s[:n]"},
+		[]string{"a.go\tIsInBounds\tv := s[i]", "c.go\tIsInBounds\tw := s[j]"},
+	)
+	if expected := []string{"c.go\tIsInBounds\tw := s[j]"}; !reflect.DeepEqual(added, expected) {
+		t.Fatalf("got added %q", added)
+	}
+	if expected := []string{"a.go\tIsInBounds\tv := s[i]", "b.go\tIsSliceInBounds\ts = s[:n]"}; !reflect.DeepEqual(removed, expected) {
+		t.Fatalf("got removed %q", removed)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// benchFile holds a parsed Go benchmark output file, see
+// https://go.googlesource.com/proposal/+/master/design/14313-benchmark-format.md
+type benchFile struct {
+	// Config holds the "key: value" configuration lines, e.g. goos, goarch and cpu.
+	// If a key is repeated, the first value wins.
+	Config map[string]string
+
+	// Units holds the unit metadata lines, e.g. "Unit ns/op better=lower".
+	Units map[string]unitMeta
+
+	Results []*benchResult
+
+	// All lines in the file, used to write it back.
+	lines []benchLine
+}
+
+type benchLine struct {
+	raw    string
+	result *benchResult
+}
+
+type benchResult struct {
+	Name       string
+	Iterations int
+	Values     []benchValue
+}
+
+type benchValue struct {
+	Value float64
+	Unit  string
+}
+
+// value returns the value for the given unit and whether it was found.
+func (r *benchResult) value(unit string) (float64, bool) {
+	for _, v := range r.Values {
+		if v.Unit == unit {
+			return v.Value, true
+		}
+	}
+	return 0, false
+}
+
+func (r *benchResult) String() string {
+	var sb strings.Builder
+	sb.WriteString(r.Name)
+	sb.WriteString("\t")
+	sb.WriteString(strconv.Itoa(r.Iterations))
+	for _, v := range r.Values {
+		sb.WriteString("\t")
+		sb.WriteString(strconv.FormatFloat(v.Value, 'f', -1, 64))
+		sb.WriteString(" ")
+		sb.WriteString(v.Unit)
+	}
+	return sb.String()
+}
+
+func readBenchFile(filename string) (*benchFile, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseBenchFile(f)
+}
+
+func parseBenchFile(r io.Reader) (*benchFile, error) {
+	bf := &benchFile{Config: make(map[string]string), Units: make(map[string]unitMeta)}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if res, ok := parseBenchResult(line); ok {
+			bf.Results = append(bf.Results, res)
+			bf.lines = append(bf.lines, benchLine{result: res})
+			continue
+		}
+		if unit, m, ok := parseBenchUnit(line); ok {
+			bf.Units[unit] = bf.Units[unit].merge(m)
+		} else if key, value, ok := parseBenchConfig(line); ok {
+			if _, found := bf.Config[key]; !found {
+				bf.Config[key] = value
+			}
+		}
+		bf.lines = append(bf.lines, benchLine{raw: line})
+	}
+
+	return bf, scanner.Err()
+}
+
+func (bf *benchFile) write(w io.Writer) error {
+	for _, line := range bf.lines {
+		s := line.raw
+		if line.result != nil {
+			s = line.result.String()
+		}
+		if _, err := fmt.Fprintln(w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bf *benchFile) writeFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := bf.write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// mean returns the mean value for the given benchmark and unit across all
+// runs and whether any value was found.
+func (bf *benchFile) mean(name, unit string) (float64, bool) {
+	var sum float64
+	var n int
+	for _, r := range bf.Results {
+		if r.Name != name {
+			continue
+		}
+		if v, ok := r.value(unit); ok {
+			sum += v
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
+
+// parseBenchResult parses a line on the form
+// "BenchmarkFoo-8 	 1000	 1234 ns/op	 16 B/op	 1 allocs/op".
+func parseBenchResult(line string) (*benchResult, bool) {
+	if !strings.HasPrefix(line, "Benchmark") {
+		return nil, false
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 4 || len(fields)%2 != 0 {
+		return nil, false
+	}
+	if len(fields[0]) > len("Benchmark") {
+		if r := rune(fields[0][len("Benchmark")]); unicode.IsLower(r) {
+			return nil, false
+		}
+	}
+	iterations, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, false
+	}
+	res := &benchResult{Name: fields[0], Iterations: iterations}
+	for i := 2; i < len(fields); i += 2 {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, false
+		}
+		res.Values = append(res.Values, benchValue{Value: v, Unit: fields[i+1]})
+	}
+	return res, true
+}
+
+// parseBenchConfig parses a configuration line on the form "key: value".
+func parseBenchConfig(line string) (string, string, bool) {
+	i := strings.Index(line, ":")
+	if i <= 0 {
+		return "", "", false
+	}
+	key := line[:i]
+	if !unicode.IsLower(rune(key[0])) {
+		return "", "", false
+	}
+	for _, r := range key {
+		if unicode.IsSpace(r) || unicode.IsUpper(r) {
+			return "", "", false
+		}
+	}
+	value := strings.TrimSpace(line[i+1:])
+	return key, value, true
+}
+
+// expandBenchFiles expands a comma separated list of filenames and glob
+// patterns into a list of filenames.
+func expandBenchFiles(s string) ([]string, error) {
+	var filenames []string
+	for _, pattern := range strings.Split(s, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files matching %q", pattern)
+		}
+		filenames = append(filenames, matches...)
+	}
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no files in %q", s)
+	}
+	return filenames, nil
+}
+
+// mergeBenchFiles merges the result files in from into one file, to,
+// e.g. to combine results from separate sessions or shards.
+func mergeBenchFiles(to string, from []string) error {
+	var merged *benchFile
+	for _, filename := range from {
+		bf, err := readBenchFile(filename)
+		if err != nil {
+			return err
+		}
+		if merged == nil {
+			merged = bf
+			continue
+		}
+		if mismatches := hardwareMismatches(merged, bf); len(mismatches) > 0 {
+			fmt.Printf("Warning: merging %s with results from different hardware: %s\n", filename, strings.Join(mismatches, ", "))
+		}
+		for unit, m := range bf.Units {
+			merged.Units[unit] = merged.Units[unit].merge(m)
+		}
+		merged.Results = append(merged.Results, bf.Results...)
+		merged.lines = append(merged.lines, bf.lines...)
+	}
+	if merged == nil {
+		return fmt.Errorf("nothing to merge into %s", to)
+	}
+	return merged.writeFile(to)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testBenchOutput = `goos: linux
+goarch: amd64
+pkg: github.com/bep/gobench/testing
+cpu: Intel(R) Core(TM) i7-8700 CPU @ 3.20GHz
+BenchmarkSleep-12    	     100	  10123456 ns/op	      80 B/op	       1 allocs/op
+BenchmarkSleep-12    	     100	  10234567 ns/op	      80 B/op	       1 allocs/op
+Benchmarking is fun
+PASS
+ok  	github.com/bep/gobench/testing	2.345s
+`
+
+func TestParseBenchFile(t *testing.T) {
+	bf, err := parseBenchFile(strings.NewReader(testBenchOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bf.Results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(bf.Results))
+	}
+	if got := bf.Config["cpu"]; got != "Intel(R) Core(TM) i7-8700 CPU @ 3.20GHz" {
+		t.Fatalf("got cpu %q", got)
+	}
+	r := bf.Results[0]
+	if r.Name != "BenchmarkSleep-12" || r.Iterations != 100 || len(r.Values) != 3 {
+		t.Fatalf("unexpected result: %v", r)
+	}
+	if v, _ := r.value("allocs/op"); v != 1 {
+		t.Fatalf("got allocs/op %v", v)
+	}
+
+	var buf bytes.Buffer
+	if err := bf.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	assertContainsAll(t, buf.String(),
+		"BenchmarkSleep-12\t100\t10123456 ns/op\t80 B/op\t1 allocs/op",
+		"Benchmarking is fun",
+		"cpu: Intel")
+}
+
+func TestMergeBenchFiles(t *testing.T) {
+	dir := t.TempDir()
+	f1, f2 := filepath.Join(dir, "a.1.bench"), filepath.Join(dir, "a.2.bench")
+	os.WriteFile(f1, []byte("cpu: A\nBenchmarkFoo-4\t10\t100 ns/op\n"), 0o644)
+	os.WriteFile(f2, []byte("cpu: A\nBenchmarkFoo-4\t10\t200 ns/op\n"), 0o644)
+
+	filenames, err := expandBenchFiles(filepath.Join(dir, "a.*.bench"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filenames) != 2 {
+		t.Fatalf("expected 2 files, got %v", filenames)
+	}
+
+	merged := filepath.Join(dir, "merged.bench")
+	if err := mergeBenchFiles(merged, filenames); err != nil {
+		t.Fatal(err)
+	}
+	bf, err := readBenchFile(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := bf.mean("BenchmarkFoo-4", "ns/op"); v != 150 {
+		t.Fatalf("got ns/op %v", v)
+	}
+}
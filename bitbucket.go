@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// bitbucketCloudURL is the API URL of Bitbucket Cloud. Any other
+// --bitbucket-url is taken to be a Bitbucket Server or Data Center.
+const bitbucketCloudURL = "https://api.bitbucket.org"
+
+// bitbucketReport is a Code Insights report. Bitbucket Server ignores
+// report_type.
+type bitbucketReport struct {
+	Title      string              `json:"title"`
+	Details    string              `json:"details"`
+	Reporter   string              `json:"reporter"`
+	ReportType string              `json:"report_type,omitempty"`
+	Result     string              `json:"result"`
+	Data       []bitbucketDataItem `json:"data"`
+}
+
+type bitbucketDataItem struct {
+	Title string      `json:"title"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// reportBitbucket attaches the comparison in s to the current commit as a
+// Code Insights report and, for pull requests, posts the markdown report as
+// a comment. The repository, commit and pull request default to those set
+// in Bitbucket Pipelines.
+func (r runner) reportBitbucket(s *summary) error {
+	repo := r.BitbucketRepo
+	if repo == "" {
+		repo = os.Getenv("BITBUCKET_REPO_FULL_NAME")
+	}
+	parts := strings.Split(repo, "/")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid --bitbucket-repo %q, must be on the form workspace/repo or PROJECT/repo", repo)
+	}
+	commit := os.Getenv("BITBUCKET_COMMIT")
+	if commit == "" {
+		commit = r.refCommit(r.currentBranch)
+	}
+	pr := r.BitbucketPR
+	if pr == "" {
+		pr = os.Getenv("BITBUCKET_PR_ID")
+	}
+
+	baseURL := strings.TrimSuffix(r.BitbucketURL, "/")
+	cloud := baseURL == bitbucketCloudURL
+	auth := func(req *http.Request) {
+		if r.BitbucketToken != "" {
+			req.Header.Set("Authorization", "Bearer "+r.BitbucketToken)
+		}
+	}
+
+	result := "PASSED"
+	if !r.passed(s) {
+		result = "FAILED"
+	}
+	report := bitbucketReport{
+		Title:    "gobench: " + s.Base + " vs " + s.Current,
+		Details:  s.Headline(),
+		Reporter: "gobench",
+		Result:   result,
+		Data: []bitbucketDataItem{
+			{Title: "Regressions", Type: "NUMBER", Value: len(s.regressions())},
+			{Title: "Improvements", Type: "NUMBER", Value: len(s.improvements())},
+			{Title: "Threshold violations", Type: "NUMBER", Value: len(s.Violations)},
+		},
+	}
+
+	var reportURL, commentURL string
+	var comment interface{}
+	if cloud {
+		report.ReportType = "TEST"
+		reportURL = fmt.Sprintf("%s/2.0/repositories/%s/%s/commit/%s/reports/gobench", baseURL, parts[0], parts[1], commit)
+		commentURL = fmt.Sprintf("%s/2.0/repositories/%s/%s/pullrequests/%s/comments", baseURL, parts[0], parts[1], pr)
+		comment = map[string]interface{}{"content": map[string]string{"raw": renderMarkdown(s)}}
+	} else {
+		reportURL = fmt.Sprintf("%s/rest/insights/1.0/projects/%s/repos/%s/commits/%s/reports/gobench", baseURL, parts[0], parts[1], commit)
+		commentURL = fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/pull-requests/%s/comments", baseURL, parts[0], parts[1], pr)
+		comment = map[string]string{"text": renderMarkdown(s)}
+	}
+
+	if commit != "" {
+		if err := sendJSON("PUT", reportURL, report, auth); err != nil {
+			return fmt.Errorf("failed to create Code Insights report: %s", err)
+		}
+	}
+	if pr != "" {
+		if err := sendJSON("POST", commentURL, comment, auth); err != nil {
+			return fmt.Errorf("failed to comment on pull request %s: %s", pr, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReportBitbucketServer(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req.Method+" "+req.URL.Path+" "+req.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+
+	os.Setenv("BITBUCKET_COMMIT", "abc123")
+	defer os.Unsetenv("BITBUCKET_COMMIT")
+
+	r := runner{config: config{BitbucketURL: srv.URL, BitbucketRepo: "PROJ/repo", BitbucketPR: "7", BitbucketToken: "secret"}}
+	if err := r.reportBitbucket(&summary{Base: "main", Current: "feature"}); err != nil {
+		t.Fatal(err)
+	}
+	assertContainsAll(t, strings.Join(requests, "\n"),
+		"PUT /rest/insights/1.0/projects/PROJ/repos/repo/commits/abc123/reports/gobench Bearer secret",
+		"POST /rest/api/1.0/projects/PROJ/repos/repo/pull-requests/7/comments Bearer secret",
+	)
+}
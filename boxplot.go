@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// boxPlotWidth is the width in characters of the box plots.
+const boxPlotWidth = 20
+
+// boxPlot renders the spread of values as a box plot between lo and hi,
+// with whiskers from the min to the max, a box from the 25th to the 75th
+// percentile and a bar at the median, e.g. "  ├──▒▒▒┃▒▒──┤      ".
+func boxPlot(values []float64, lo, hi float64, width int) string {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	pos := func(v float64) int {
+		if hi <= lo {
+			return width / 2
+		}
+		i := int(math.Round(float64(width-1) * (v - lo) / (hi - lo)))
+		if i < 0 {
+			i = 0
+		}
+		if i > width-1 {
+			i = width - 1
+		}
+		return i
+	}
+
+	row := []rune(strings.Repeat(" ", width))
+	min, max := pos(sorted[0]), pos(sorted[len(sorted)-1])
+	q1, q3 := pos(percentile(sorted, 25)), pos(percentile(sorted, 75))
+	for i := min; i <= max; i++ {
+		row[i] = '─'
+	}
+	for i := q1; i <= q3; i++ {
+		row[i] = '▒'
+	}
+	row[min], row[max] = '├', '┤'
+	row[pos(percentile(sorted, 50))] = '┃'
+	return string(row)
+}
+
+// comparisonBoxPlots returns the box plots of the old and new values of c
+// on a shared scale.
+func comparisonBoxPlots(c comparison) (string, string, bool) {
+	if len(c.Old) == 0 || len(c.New) == 0 {
+		return "", "", false
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range append(append([]float64(nil), c.Old...), c.New...) {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	if lo == hi {
+		return "", "", false
+	}
+	return boxPlot(c.Old, lo, hi, boxPlotWidth), boxPlot(c.New, lo, hi, boxPlotWidth), true
+}
+
+// renderBoxPlots renders the box plots of the base and current values for
+// each comparison in s with any spread, for the text format.
+func renderBoxPlots(s *summary) string {
+	var sb strings.Builder
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "\t\t%s\t%s\t\n", s.Base, s.Current)
+	for _, c := range s.Comparisons {
+		old, new, ok := comparisonBoxPlots(c)
+		if !ok {
+			continue
+		}
+		delta := "~"
+		if c.Significant {
+			delta = fmt.Sprintf("%+.2f%%", c.Delta)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t|%s|\t|%s|\t%s\n", c.Name, c.Unit, old, new, delta)
+	}
+	tw.Flush()
+	return sb.String()
+}
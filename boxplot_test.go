@@ -0,0 +1,11 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBoxPlot(t *testing.T) {
+	if got := boxPlot([]float64{2, 4, 5, 6, 10}, 0, 10, 11); got != "  ├─▒┃▒───┤" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// minBudgetCount is the smallest count per ref with which the Mann-Whitney
+// U-test can find a change significant at alpha 0.05.
+const minBudgetCount = 4
+
+// maxBudgetCount caps the counts chosen for --budget, more runs than this
+// add little power.
+const maxBudgetCount = 30
+
+// planBudget runs the benchmarks once for the current code, named name, to
+// estimate their cost and sets per-benchmark counts to fit the runs for refs
+// refs, each once per sweep value, in what's left of --budget. The
+// calibration run uses the flags of the measured runs, e.g. -race or -exec.
+// The counts are set as the count overrides in the config file.
+func (r *runner) planBudget(exeName, name string, refs int) error {
+	start := time.Now()
+	fmt.Printf("Calibrate the benchmarks for a time budget of %s\n", r.Budget)
+
+	args := r.asBenchArgs(name, 1)
+	if mod := r.modFlag(exeName); mod != "" {
+		args = append(args, "-mod="+mod)
+	}
+	cmd := r.benchCommand(exeName, append(args, r.packageArgs()...))
+	cmd.Dir = r.workDir
+	if env := append(append([]string(nil), r.Env...), r.EnvCurrent...); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("calibration run failed: %s", err)
+	}
+
+	names, costs := benchmarkCosts(stdout.String())
+	if len(names) == 0 {
+		return fmt.Errorf("no benchmarks matching %q found", r.Bench)
+	}
+	runs := refs
+	if s := r.file.Sweep; s != nil {
+		runs *= len(s.Values)
+	}
+	remaining := r.Budget - time.Since(start)
+	counts := allocateCounts(costs, remaining.Seconds()/float64(runs), maxBudgetCount)
+
+	byCount := make(map[int][]string)
+	for i, name := range names {
+		byCount[counts[i]] = append(byCount[counts[i]], name)
+	}
+	var overrides []countOverride
+	for count, names := range byCount {
+		c := countOverride{Bench: benchPattern(map[string][]string{"": names}), Count: count}
+		if err := c.compile(); err != nil {
+			return err
+		}
+		overrides = append(overrides, c)
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Count > overrides[j].Count })
+	r.file.Counts = overrides
+
+	var few int
+	for _, c := range overrides {
+		fmt.Printf("  count %d: %d benchmarks\n", c.Count, len(byCount[c.Count]))
+		if c.Count < minBudgetCount {
+			few += len(byCount[c.Count])
+		}
+	}
+	if few > 0 {
+		fmt.Printf("Warning: the budget allows fewer than %d runs for %d benchmarks, changes in those can't be significant.\n", minBudgetCount, few)
+	}
+	return nil
+}
+
+// benchmarkCosts returns the top level benchmarks in the go test output and
+// the estimated seconds to run each once. Go grows b.N until the benchmark
+// runs for -benchtime, so the cost is estimated as twice the measured run.
+func benchmarkCosts(output string) ([]string, []float64) {
+	var names []string
+	costs := make(map[string]float64)
+	for _, line := range strings.Split(output, "\n") {
+		res, ok := parseBenchResult(line)
+		if !ok {
+			continue
+		}
+		ns, ok := res.value("ns/op")
+		if !ok {
+			continue
+		}
+		name := trimProcsSuffix(res.Name)
+		if i := strings.Index(name, "/"); i != -1 {
+			name = name[:i]
+		}
+		if _, found := costs[name]; !found {
+			names = append(names, name)
+		}
+		costs[name] += 2 * float64(res.Iterations) * ns / 1e9
+	}
+	result := make([]float64, len(names))
+	for i, name := range names {
+		result[i] = costs[name]
+	}
+	return names, result
+}
+
+// allocateCounts returns the count for each benchmark with the given costs in
+// seconds so the total fits in budget seconds. Starting at 1, the benchmark
+// with the lowest count that still fits is incremented until none does or
+// all are at max, so the counts are as even as the budget allows and the
+// expensive benchmarks don't starve the cheap ones.
+func allocateCounts(costs []float64, budget float64, max int) []int {
+	counts := make([]int, len(costs))
+	var spent float64
+	for i, c := range costs {
+		counts[i] = 1
+		spent += c
+	}
+	for {
+		best := -1
+		for i, c := range costs {
+			if counts[i] >= max || spent+c > budget {
+				continue
+			}
+			if best == -1 || counts[i] < counts[best] || (counts[i] == counts[best] && c < costs[best]) {
+				best = i
+			}
+		}
+		if best == -1 {
+			break
+		}
+		counts[best]++
+		spent += costs[best]
+	}
+	return counts
+}
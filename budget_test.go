@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllocateCounts(t *testing.T) {
+	// The expensive benchmark stops at 2, the cheap ones continue.
+	if got := allocateCounts([]float64{10, 1, 1}, 30, 30); !reflect.DeepEqual(got, []int{2, 5, 5}) {
+		t.Fatalf("got %v", got)
+	}
+	if got := allocateCounts([]float64{1, 1}, 100, 4); !reflect.DeepEqual(got, []int{4, 4}) {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestBenchmarkCosts(t *testing.T) {
+	names, costs := benchmarkCosts(`BenchmarkA/small-8	1000	1000000 ns/op
+BenchmarkA/large-8	10	100000000 ns/op
+BenchmarkB-8	100	1000000 ns/op
+`)
+	if !reflect.DeepEqual(names, []string{"BenchmarkA", "BenchmarkB"}) || !reflect.DeepEqual(costs, []float64{4, 0.2}) {
+		t.Fatalf("got %v %v", names, costs)
+	}
+}
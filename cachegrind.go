@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func (c config) cachegrindOutFilename(name string) string {
+	return filepath.Join(c.OutDir, c.normalizeName(name)+".cachegrind.out")
+}
+
+// cachegrindRunFilename returns the cachegrind file name for the test binary
+// processes for name, with valgrind's %p for the process id, so the test
+// binaries for several packages don't overwrite each other's results.
+func (c config) cachegrindRunFilename(name string) string {
+	return filepath.Join(c.OutDir, c.normalizeName(name)+".cachegrind.%p.out")
+}
+
+// cachegrindExec returns the go test -exec value running the test binary
+// for name under valgrind's cache and branch simulator.
+func (c config) cachegrindExec(name string) string {
+	return fmt.Sprintf("valgrind --tool=cachegrind --cache-sim=yes --branch-sim=yes '--cachegrind-out-file=%s'", c.cachegrindRunFilename(name))
+}
+
+// cachegrindRuns returns the cachegrind files written by the test binary
+// processes for name since the last merge.
+func (c config) cachegrindRuns(name string) ([]string, error) {
+	entries, err := os.ReadDir(c.OutDir)
+	if err != nil {
+		return nil, err
+	}
+	prefix, suffix := c.normalizeName(name)+".cachegrind.", ".out"
+	var runs []string
+	for _, e := range entries {
+		n := e.Name()
+		if !strings.HasPrefix(n, prefix) || !strings.HasSuffix(n, suffix) || len(n) <= len(prefix)+len(suffix) {
+			continue
+		}
+		if _, err := strconv.Atoi(n[len(prefix) : len(n)-len(suffix)]); err == nil {
+			runs = append(runs, filepath.Join(c.OutDir, n))
+		}
+	}
+	return runs, nil
+}
+
+// removeCachegrindRuns removes the cachegrind files for name not merged yet,
+// e.g. from a failed or discarded run.
+func (c config) removeCachegrindRuns(name string) error {
+	runs, err := c.cachegrindRuns(name)
+	if err != nil {
+		return err
+	}
+	for _, filename := range runs {
+		if err := os.Remove(filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeCachegrind merges the cachegrind files of the test binary processes
+// for name into its cachegrind file with cg_merge, so the results for all
+// packages and chunks of runs are compared.
+func (c config) mergeCachegrind(name string) error {
+	runs, err := c.cachegrindRuns(name)
+	if err != nil || len(runs) == 0 {
+		return err
+	}
+	merged := c.cachegrindOutFilename(name)
+	files := runs
+	if _, err := os.Stat(merged); err == nil {
+		files = append([]string{merged}, runs...)
+	}
+	tmp := merged + ".tmp"
+	if out, err := exec.Command("cg_merge", append([]string{"-o", tmp}, files...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("cg_merge failed: %s: %s", err, out)
+	}
+	if err := os.Rename(tmp, merged); err != nil {
+		return err
+	}
+	return c.removeCachegrindRuns(name)
+}
+
+// diffCachegrind diffs the cachegrind results for name1 and name2 with
+// cg_diff and prints the annotated difference.
+func (r runner) diffCachegrind(name1, name2 string) error {
+	diff, err := exec.Command("cg_diff", r.cachegrindOutFilename(name1), r.cachegrindOutFilename(name2)).Output()
+	if err != nil {
+		return fmt.Errorf("cg_diff failed: %s", err)
+	}
+	diffFilename := filepath.Join(r.OutDir, "cachegrind.diff")
+	if err := os.WriteFile(diffFilename, diff, 0o644); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nCachegrind %s vs %s (%s):\n\n", name1, name2, diffFilename)
+	cmd := exec.Command("cg_annotate", diffFilename)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cg_annotate failed: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCachegrindRuns(t *testing.T) {
+	c := config{OutDir: t.TempDir()}
+	for _, name := range []string{
+		"base.cachegrind.out",
+		"base.cachegrind.123.out",
+		"base.cachegrind.45.out",
+		"base.cachegrind.out.tmp",
+		"base-2.cachegrind.67.out",
+		"master.cachegrind.89.out",
+	} {
+		if err := os.WriteFile(filepath.Join(c.OutDir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := c.cachegrindRuns("base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(c.OutDir, "base.cachegrind.123.out"), filepath.Join(c.OutDir, "base.cachegrind.45.out")}
+	if !reflect.DeepEqual(runs, expected) {
+		t.Fatalf("got %v", runs)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// callGraph is an approximation of a call graph: a name based reference
+// graph of the top level declarations in a module, where a declaration
+// refers to another if it mentions its name. Methods are keyed by their name
+// only, so methods with the same name on different types alias each other.
+// Calls through interfaces from outside the module, e.g. fmt calling a
+// String method, are not seen, so changed methods are tracked separately
+// for the callers to fall back to running all benchmarks.
+type callGraph struct {
+	// referrers maps a name to the names of the declarations mentioning it.
+	referrers map[string]map[string]bool
+
+	// changed holds the names of the declarations with changed lines, and
+	// changedMethods those of them that are methods.
+	changed        map[string]bool
+	changedMethods map[string]bool
+
+	// benchmarks maps a directory to its benchmark functions.
+	benchmarks map[string][]string
+
+	// std holds the import paths of the standard library packages.
+	std map[string]bool
+}
+
+// newCallGraph parses all Go files below root, marking the declarations
+// overlapping the changed lines, keyed by filename relative to root.
+func newCallGraph(root string, changed map[string][]lineRange, std map[string]bool) (*callGraph, error) {
+	g := &callGraph{
+		referrers:      make(map[string]map[string]bool),
+		changed:        make(map[string]bool),
+		changedMethods: make(map[string]bool),
+		benchmarks:     make(map[string][]string),
+		std:            std,
+	}
+	fset := token.NewFileSet()
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if path != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		g.addFile(fset, f, filepath.Dir(path), changed[filepath.ToSlash(rel)], strings.HasSuffix(path, "_test.go"))
+		return nil
+	})
+
+	return g, err
+}
+
+func (g *callGraph) addFile(fset *token.FileSet, f *ast.File, dir string, changed []lineRange, isTest bool) {
+	// References to the standard library, e.g. testing.B, can not
+	// reach the module's code.
+	stdlib := make(map[string]bool)
+	for _, imp := range f.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		if !g.std[path] {
+			continue
+		}
+		name := filepath.Base(path)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		stdlib[name] = true
+	}
+
+	for _, decl := range f.Decls {
+		var names []string
+		var method bool
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			names = append(names, d.Name.Name)
+			method = d.Recv != nil
+			if isTest && d.Recv == nil && strings.HasPrefix(d.Name.Name, "Benchmark") {
+				g.benchmarks[dir] = append(g.benchmarks[dir], d.Name.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						names = append(names, name.Name)
+					}
+				case *ast.TypeSpec:
+					names = append(names, s.Name.Name)
+				}
+			}
+		}
+
+		start, end := fset.Position(decl.Pos()).Line, fset.Position(decl.End()).Line
+		for _, lr := range changed {
+			if lr.start <= end && lr.end >= start {
+				for _, name := range names {
+					g.changed[name] = true
+					if method {
+						g.changedMethods[name] = true
+					}
+				}
+				break
+			}
+		}
+
+		ast.Inspect(decl, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if x, ok := sel.X.(*ast.Ident); ok && stdlib[x.Name] {
+					return false
+				}
+			}
+			if id, ok := n.(*ast.Ident); ok {
+				for _, name := range names {
+					if id.Name == name {
+						continue
+					}
+					if g.referrers[id.Name] == nil {
+						g.referrers[id.Name] = make(map[string]bool)
+					}
+					g.referrers[id.Name][name] = true
+				}
+			}
+			return true
+		})
+	}
+}
+
+// impacted returns the names of all declarations that changed or can
+// reach a changed declaration.
+func (g *callGraph) impacted() map[string]bool {
+	impacted := make(map[string]bool)
+	var queue []string
+	for name := range g.changed {
+		impacted[name] = true
+		queue = append(queue, name)
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for referrer := range g.referrers[name] {
+			if !impacted[referrer] {
+				impacted[referrer] = true
+				queue = append(queue, referrer)
+			}
+		}
+	}
+	return impacted
+}
+
+// stdPackages returns the import paths of the standard library packages.
+// Module paths need not contain a dot, so they can't be told apart by the
+// import path alone.
+func stdPackages(dir string) (map[string]bool, error) {
+	cmd := exec.Command(goExe, "list", "std")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list std failed: %s", err)
+	}
+	std := make(map[string]bool)
+	for _, path := range strings.Fields(string(output)) {
+		std[path] = true
+	}
+	return std, nil
+}
+
+// changedNonGoFiles returns the changed files compared to ref that are not
+// Go files, e.g. go.mod or testdata, which the call graph can't account for.
+func changedNonGoFiles(dir, ref string) ([]string, error) {
+	diff, err := gitOutput(dir, "diff", "--name-only", ref)
+	if err != nil {
+		return nil, err
+	}
+	var filenames []string
+	for _, filename := range strings.Split(diff, "\n") {
+		if filename != "" && !strings.HasSuffix(filename, ".go") {
+			filenames = append(filenames, filename)
+		}
+	}
+	return filenames, nil
+}
+
+// lineRange is a range of lines, inclusive.
+type lineRange struct {
+	start, end int
+}
+
+var hunkRe = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// changedLines returns the changed lines in the current Go files compared
+// to ref, keyed by filename relative to the repository root.
+func changedLines(dir, ref string) (map[string][]lineRange, error) {
+	cmd := exec.Command("git", "diff", "-U0", "--no-color", ref, "--", "*.go")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff failed: %s", err)
+	}
+
+	changed := make(map[string][]lineRange)
+	var filename string
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "+++ ") {
+			filename = strings.TrimPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+			continue
+		}
+		m := hunkRe.FindStringSubmatch(line)
+		if m == nil || filename == "/dev/null" {
+			continue
+		}
+		start, _ := strconv.Atoi(m[1])
+		n := 1
+		if m[2] != "" {
+			n, _ = strconv.Atoi(m[2])
+		}
+		// Pure deletions (n == 0) are after line start.
+		end := start + n - 1
+		if n == 0 {
+			end = start + 1
+		}
+		changed[filename] = append(changed[filename], lineRange{start: start, end: end})
+	}
+
+	return changed, scanner.Err()
+}
+
+// impactedBenchmarks returns the benchmarks in pkgs matching the top level
+// of --bench that can reach code changed since ref, keyed by package, and
+// the names of the changed methods, which may also be called through
+// interfaces the graph doesn't follow.
+func (r runner) impactedBenchmarks(ref string, pkgs []string) (map[string][]string, []string, error) {
+	root, err := gitOutput(r.workDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, nil, err
+	}
+	changed, err := changedLines(r.workDir, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	std, err := stdPackages(r.workDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	g, err := newCallGraph(root, changed, std)
+	if err != nil {
+		return nil, nil, err
+	}
+	var methods []string
+	for name := range g.changedMethods {
+		methods = append(methods, name)
+	}
+	sort.Strings(methods)
+	top, _ := splitBenchPattern(r.Bench)
+	benchRe, err := regexp.Compile(top)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid --bench %q: %s", r.Bench, err)
+	}
+
+	args := append([]string{"list", "-f", "{{.ImportPath}}\t{{.Dir}}"}, pkgs...)
+	cmd := exec.Command(goExe, args...)
+	cmd.Dir = r.workDir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, nil, fmt.Errorf("go list failed: %s", err)
+	}
+
+	impacted := g.impacted()
+	benchmarks := make(map[string][]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 {
+			continue
+		}
+		for _, name := range g.benchmarks[fields[1]] {
+			if impacted[name] && benchRe.MatchString(name) {
+				benchmarks[fields[0]] = append(benchmarks[fields[0]], name)
+			}
+		}
+	}
+
+	return benchmarks, methods, nil
+}
+
+// splitBenchPattern splits a -bench pattern into the pattern for the top
+// level benchmarks and the rest for the sub-benchmarks, starting with the
+// slash, as go test does: slashes in brackets or parentheses or escaped
+// don't separate the levels.
+func splitBenchPattern(pattern string) (string, string) {
+	var depth int
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+		case '/':
+			if depth == 0 {
+				return pattern[:i], pattern[i:]
+			}
+		}
+	}
+	return pattern, ""
+}
+
+// benchPattern returns a -bench pattern matching exactly the given benchmarks.
+func benchPattern(benchmarks map[string][]string) string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, pkgBenchmarks := range benchmarks {
+		for _, name := range pkgBenchmarks {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, regexp.QuoteMeta(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return "^(" + strings.Join(names, "|") + ")$"
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestCallGraph(t *testing.T) {
+	const src = `package p
+
+import "testing"
+
+func A() int { return 1 }
+
+func B() int { return A() }
+
+func BenchmarkB(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		B()
+	}
+}
+
+func BenchmarkOther(b *testing.B) {}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p_test.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &callGraph{
+		referrers:      make(map[string]map[string]bool),
+		changed:        make(map[string]bool),
+		changedMethods: make(map[string]bool),
+		benchmarks:     make(map[string][]string),
+		std:            map[string]bool{"testing": true},
+	}
+	// Line 5 is A.
+	g.addFile(fset, f, "p", []lineRange{{start: 5, end: 5}}, true)
+
+	if len(g.benchmarks["p"]) != 2 {
+		t.Fatalf("got benchmarks %v", g.benchmarks)
+	}
+	impacted := g.impacted()
+	if !impacted["BenchmarkB"] || impacted["BenchmarkOther"] {
+		t.Fatalf("got impacted %v", impacted)
+	}
+	// A module path without a dot is not the standard library.
+	f, err = parser.ParseFile(fset, "q_test.go", `package q
+
+import (
+	"testing"
+
+	"gobench/p"
+)
+
+func BenchmarkQ(b *testing.B) { p.B() }
+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.addFile(fset, f, "q", nil, true)
+	if impacted := g.impacted(); !impacted["BenchmarkQ"] {
+		t.Fatalf("got impacted %v", impacted)
+	}
+
+	if got := benchPattern(map[string][]string{"p": {"BenchmarkB"}}); got != "^(BenchmarkB)$" {
+		t.Fatalf("got pattern %q", got)
+	}
+
+	// A changed method may be called through an interface, e.g. by fmt.
+	f, err = parser.ParseFile(fset, "t.go", `package t
+
+type T struct{}
+
+func (T) String() string { return "t" }
+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.addFile(fset, f, "t", []lineRange{{start: 5, end: 5}}, false)
+	if !g.changedMethods["String"] || g.changedMethods["A"] {
+		t.Fatalf("got changed methods %v", g.changedMethods)
+	}
+}
+
+func TestSplitBenchPattern(t *testing.T) {
+	for _, test := range []struct {
+		pattern, top, sub string
+	}{
+		{".", ".", ""},
+		{"BenchmarkA/small", "BenchmarkA", "/small"},
+		{"Benchmark(A|B/x)/small/1", "Benchmark(A|B/x)", "/small/1"},
+		{`A[/]B\/C/sub`, `A[/]B\/C`, "/sub"},
+	} {
+		if top, sub := splitBenchPattern(test.pattern); top != test.top || sub != test.sub {
+			t.Errorf("%q: got %q %q", test.pattern, top, sub)
+		}
+	}
+}
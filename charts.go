@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Chart dimensions in pixels.
+const (
+	chartWidth     = 320
+	chartHeight    = 240
+	chartMargin    = 40
+	chartBarWidth  = 80
+	chartTitleSize = 13
+)
+
+// chartColors are the fill colors of the base and current bars.
+var chartColors = []string{"#9e9e9e", "#1e88e5"}
+
+// writeCharts writes an SVG bar chart per comparison in s to dir, with the
+// mean of the base and the current code as bars and the range of the
+// samples as error bars.
+func (c config) writeCharts(dir string, s *summary) error {
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return err
+	}
+	for _, cmp := range s.Comparisons {
+		filename := filepath.Join(dir, c.normalizeName(cmp.Name+"-"+cmp.Unit)+".svg")
+		if err := os.WriteFile(filename, []byte(renderChart(s.Base, s.Current, cmp)), 0o666); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Wrote %d charts to %s\n", len(s.Comparisons), dir)
+	return nil
+}
+
+// renderChart renders the comparison c as a standalone SVG bar chart.
+func renderChart(base, current string, c comparison) string {
+	bars := []struct {
+		label   string
+		mean    float64
+		samples []float64
+	}{
+		{base, c.OldMean, c.Old},
+		{current, c.NewMean, c.New},
+	}
+
+	top := math.Max(c.OldMean, c.NewMean)
+	for _, bar := range bars {
+		for _, v := range bar.samples {
+			top = math.Max(top, v)
+		}
+	}
+	if top <= 0 {
+		top = 1
+	}
+	plotHeight := float64(chartHeight - 2*chartMargin)
+	y := func(v float64) float64 {
+		return float64(chartHeight-chartMargin) - v/top*plotHeight
+	}
+
+	delta := "~"
+	if c.Significant {
+		delta = fmt.Sprintf("%+.2f%%", c.Delta)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`+"\n", chartWidth, chartHeight)
+	fmt.Fprintf(&sb, `<rect width="%d" height="%d" fill="white"/>`+"\n", chartWidth, chartHeight)
+	fmt.Fprintf(&sb, `<text x="%d" y="20" text-anchor="middle" font-size="%d">%s</text>`+"\n", chartWidth/2, chartTitleSize, html.EscapeString(fmt.Sprintf("%s %s: %s", c.Name, c.Unit, delta)))
+
+	// The axes, with the top value as the only tick.
+	fmt.Fprintf(&sb, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`+"\n", chartMargin, chartMargin, chartMargin, chartHeight-chartMargin)
+	fmt.Fprintf(&sb, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`+"\n", chartMargin, chartHeight-chartMargin, chartWidth-chartMargin/2, chartHeight-chartMargin)
+	fmt.Fprintf(&sb, `<text x="%d" y="%d" text-anchor="end">%.4g</text>`+"\n", chartMargin-4, chartMargin+4, top)
+	fmt.Fprintf(&sb, `<text x="%d" y="%d" text-anchor="end">0</text>`+"\n", chartMargin-4, chartHeight-chartMargin+4)
+
+	slot := float64(chartWidth-chartMargin-chartMargin/2) / float64(len(bars))
+	for i, bar := range bars {
+		x := float64(chartMargin) + slot*float64(i) + (slot-chartBarWidth)/2
+		center := x + chartBarWidth/2
+		fmt.Fprintf(&sb, `<rect x="%.1f" y="%.1f" width="%d" height="%.1f" fill="%s"/>`+"\n", x, y(bar.mean), chartBarWidth, y(0)-y(bar.mean), chartColors[i])
+		if len(bar.samples) > 0 {
+			lo, hi := bar.samples[0], bar.samples[0]
+			for _, v := range bar.samples {
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+			fmt.Fprintf(&sb, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="black"/>`+"\n", center, y(lo), center, y(hi))
+			for _, v := range []float64{lo, hi} {
+				fmt.Fprintf(&sb, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="black"/>`+"\n", center-8, y(v), center+8, y(v))
+			}
+		}
+		fmt.Fprintf(&sb, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n", center, chartHeight-chartMargin+16, html.EscapeString(bar.label))
+		fmt.Fprintf(&sb, `<text x="%.1f" y="%d" text-anchor="middle">%.4g</text>`+"\n", center, chartHeight-chartMargin+30, bar.mean)
+	}
+
+	sb.WriteString("</svg>\n")
+	return sb.String()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// annotateBuildkite creates a Buildkite annotation with the markdown report
+// for s. Threshold violations are reported as error level annotations.
+func annotateBuildkite(s *summary) error {
+	style := "success"
+	switch {
+	case len(s.Violations) > 0:
+		style = "error"
+	case len(s.regressions()) > 0:
+		style = "warning"
+	}
+
+	cmd := exec.Command("buildkite-agent", "annotate", "--style", style, "--context", "gobench-"+s.Base+"-"+s.Current)
+	cmd.Stdin = strings.NewReader(renderMarkdown(s))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// azureLogIssues prints Azure Pipelines logging commands for s: errors for
+// threshold violations, warnings for other regressions, and the markdown
+// report, written to outDir, as a build summary attachment.
+func azureLogIssues(outDir string, s *summary) error {
+	for _, c := range s.regressions() {
+		typ := "warning"
+		if s.violation(c) {
+			typ = "error"
+		}
+		fmt.Printf("##vso[task.logissue type=%s]gobench: %s\n", typ, azureEscape(formatComparison(c)))
+	}
+
+	filename := filepath.Join(outDir, "gobench-summary.md")
+	if err := os.WriteFile(filename, []byte(renderMarkdown(s)), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("##vso[task.uploadsummary]%s\n", filename)
+
+	if len(s.Violations) > 0 {
+		fmt.Println("##vso[task.complete result=Failed;]")
+	}
+
+	return nil
+}
+
+var azureReplacer = strings.NewReplacer(
+	"%", "%AZP25",
+	"\r", "%0D",
+	"\n", "%0A",
+	";", "%3B",
+	"]", "%5D",
+)
+
+func azureEscape(s string) string {
+	return azureReplacer.Replace(s)
+}
+
+// appendGitHubStepSummary appends the markdown report for s to the GitHub
+// Actions job summary in filename, see GITHUB_STEP_SUMMARY.
+func appendGitHubStepSummary(filename string, s *summary) error {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "## gobench\n\n%s\n", renderMarkdown(s)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// gitHubOutputs returns the GitHub Actions step outputs for s, so later steps
+// can act on the result, e.g. with steps.<id>.outputs.passed:
+//
+//	passed: false if the run failed the threshold or --fail-on-removed
+//	geomean-delta: the geomean change in percent for the time unit
+//	worst-regression, worst-regression-delta: the worst significant regression
+//	regressions, improvements, violations: the number of each
+//	summary: the path to summary.json
+func gitHubOutputs(s *summary, passed bool, summaryFile string) [][2]string {
+	outputs := [][2]string{{"passed", fmt.Sprint(passed)}}
+
+	var geomeanDelta string
+	for _, g := range s.Geomeans {
+		if isTimeUnit(g.Unit) {
+			geomeanDelta = fmt.Sprintf("%.2f", g.Delta)
+		}
+	}
+	outputs = append(outputs, [2]string{"geomean-delta", geomeanDelta})
+
+	var worst, worstDelta string
+	if regressions := s.regressions(); len(regressions) > 0 {
+		worst = regressions[0].Name + " " + regressions[0].Unit
+		worstDelta = fmt.Sprintf("%.2f", regressions[0].Delta)
+	}
+	return append(outputs,
+		[2]string{"worst-regression", worst},
+		[2]string{"worst-regression-delta", worstDelta},
+		[2]string{"regressions", fmt.Sprint(len(s.regressions()))},
+		[2]string{"improvements", fmt.Sprint(len(s.improvements()))},
+		[2]string{"violations", fmt.Sprint(len(s.Violations))},
+		[2]string{"summary", summaryFile},
+	)
+}
+
+// writeGitHubOutputs appends the step outputs for s to filename, see
+// GITHUB_OUTPUT.
+func writeGitHubOutputs(filename string, s *summary, passed bool, summaryFile string) error {
+	var sb strings.Builder
+	for _, kv := range gitHubOutputs(s, passed, summaryFile) {
+		fmt.Fprintf(&sb, "%s=%s\n", kv[0], kv[1])
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(sb.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+)
+
+type compareCmd struct {
+	Old string `arg:"positional,required" help:"the .bench file(s) to use as the base, comma separated or glob"`
+	New string `arg:"positional,required" help:"the .bench file(s) to compare with the base, comma separated or glob"`
+}
+
+// runCompare runs the analysis and report on existing result files.
+// No git or go commands are executed.
+func (r runner) runCompare() error {
+	olds, err := expandBenchFiles(r.Compare.Old)
+	if err != nil {
+		return err
+	}
+	news, err := expandBenchFiles(r.Compare.New)
+	if err != nil {
+		return err
+	}
+
+	first, second := resultName(olds[0]), resultName(news[0])
+	if r.normalizeName(first) == r.normalizeName(second) {
+		first, second = "old-"+first, "new-"+second
+	}
+
+	if err := mergeBenchFiles(r.benchOutFilename(first), olds); err != nil {
+		return err
+	}
+	if err := mergeBenchFiles(r.benchOutFilename(second), news); err != nil {
+		return err
+	}
+
+	fmt.Printf("Compare %q and %q.\n\n", r.Compare.Old, r.Compare.New)
+
+	return r.runBenchStat(first, second)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// defaultComposeUpTimeout is the default max time to wait for the services
+// to become healthy.
+const defaultComposeUpTimeout = 2 * time.Minute
+
+// compose declares docker compose services in the config file that are
+// brought up before and torn down after each benchmark run, so both refs
+// get a fresh, identical environment, e.g.
+// {"file": "docker-compose.bench.yml", "up_timeout": "5m"}.
+type compose struct {
+	File string `json:"file"`
+
+	// UpTimeout is the max time to wait for the services to be running and
+	// their health checks to pass, e.g. 90s.
+	UpTimeout string `json:"up_timeout"`
+
+	upTimeout time.Duration
+}
+
+// compile resolves the file relative to dir, the directory of the config
+// file.
+func (c *compose) compile(dir string) error {
+	if c.File == "" {
+		return errors.New("compose requires file")
+	}
+	if !filepath.IsAbs(c.File) {
+		c.File = filepath.Join(dir, c.File)
+	}
+	// The same services are used for all refs, also when benchmarked in
+	// another worktree.
+	var err error
+	if c.File, err = filepath.Abs(c.File); err != nil {
+		return err
+	}
+	c.upTimeout = defaultComposeUpTimeout
+	if c.UpTimeout != "" {
+		if c.upTimeout, err = time.ParseDuration(c.UpTimeout); err != nil {
+			return fmt.Errorf("invalid compose up_timeout %q: %s", c.UpTimeout, err)
+		}
+	}
+	return nil
+}
+
+// composeCommand returns docker compose with args for the services.
+func (c compose) composeCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "docker", append([]string{"compose", "-f", c.File}, args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// composeUp brings up the services in the config file for the run of ref
+// and waits for them to become healthy. It returns a function that tears
+// them down again, including their volumes.
+func (r runner) composeUp(ref string) (func() error, error) {
+	c := r.file.Compose
+	down := func() error {
+		fmt.Printf("Stop the services in %s.\n", c.File)
+		if err := c.composeCommand(context.Background(), "down", "--volumes", "--remove-orphans").Run(); err != nil {
+			return fmt.Errorf("docker compose down failed: %s", err)
+		}
+		return nil
+	}
+
+	fmt.Printf("Start the services in %s for %q.\n", c.File, ref)
+	ctx, cancel := context.WithTimeout(r.context(), c.upTimeout)
+	defer cancel()
+	// --wait waits for the services to be running and healthy.
+	if err := c.composeCommand(ctx, "up", "--detach", "--wait", "--force-recreate", "--renew-anon-volumes").Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("the services were not healthy within %s", c.upTimeout)
+		}
+		down()
+		return nil, fmt.Errorf("docker compose up failed: %s", err)
+	}
+	return down, nil
+}
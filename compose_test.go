@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestComposeCompile(t *testing.T) {
+	dir := t.TempDir()
+	c := &compose{File: "docker-compose.yml"}
+	if err := c.compile(dir); err != nil {
+		t.Fatal(err)
+	}
+	if c.File != filepath.Join(dir, "docker-compose.yml") || c.upTimeout != defaultComposeUpTimeout {
+		t.Errorf("got %q %s", c.File, c.upTimeout)
+	}
+
+	abs := filepath.Join(dir, "compose", "bench.yml")
+	c = &compose{File: abs}
+	if err := c.compile("other"); err != nil || c.File != abs {
+		t.Errorf("got %q: %v", c.File, err)
+	}
+
+	c = &compose{File: "docker-compose.yml", UpTimeout: "90s"}
+	if err := c.compile(dir); err != nil || c.upTimeout != 90*time.Second {
+		t.Errorf("got %s: %v", c.upTimeout, err)
+	}
+
+	for _, c := range []*compose{{}, {File: "docker-compose.yml", UpTimeout: "soon"}} {
+		if err := c.compile(dir); err == nil {
+			t.Errorf("expected error for %+v", c)
+		}
+	}
+}
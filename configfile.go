@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultConfigFile is read from the current directory if --config is not set.
+const defaultConfigFile = "gobench.json"
+
+// fileConfig holds the settings read from the JSON config file.
+type fileConfig struct {
+	// Units declares the semantics of benchmark units, e.g.
+	// {"requests/sec": {"better": "higher"}}.
+	Units map[string]unitMeta `json:"units"`
+
+	// Sweep declares a parameter to run the benchmarks for each value of.
+	Sweep *sweep `json:"sweep"`
+
+	// Counts overrides the count for benchmarks matching a pattern, e.g.
+	// [{"bench": "^BenchmarkMacro", "count": 2}].
+	Counts []countOverride `json:"counts"`
+
+	// Names declares rewrites of the benchmark names applied before
+	// comparing, e.g. [{"pattern": "/host=[^/]+", "replace": ""}].
+	Names []nameRewrite `json:"names"`
+
+	// Sets declares named benchmark selections for --set, e.g.
+	// {"smoke": "BenchmarkEncode|BenchmarkDecode"}.
+	Sets map[string]*benchSet `json:"sets"`
+
+	// Compose declares docker compose services to bring up for each run,
+	// e.g. {"file": "docker-compose.bench.yml"}.
+	Compose *compose `json:"compose"`
+
+	// Quarantine lists the benchmarks whose changes are reported but never
+	// violate the threshold, e.g. [{"bench": "^BenchmarkDial", "reason":
+	// "network jitter"}]. See gobench history quarantine for suggestions.
+	Quarantine []quarantined `json:"quarantine"`
+}
+
+// loadFileConfig reads the config file. If filename is empty, the default
+// config file is read if it exists.
+func loadFileConfig(filename string) (fileConfig, error) {
+	var cfg fileConfig
+
+	required := filename != ""
+	if !required {
+		filename = defaultConfigFile
+	}
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return cfg, nil
+		}
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse %s: %s", filename, err)
+	}
+
+	for unit, m := range cfg.Units {
+		if err := m.validate(unit); err != nil {
+			return cfg, fmt.Errorf("%s: %s", filename, err)
+		}
+	}
+
+	if s := cfg.Sweep; s != nil && (s.Env == "" || len(s.Values) == 0) {
+		return cfg, fmt.Errorf("%s: sweep requires env and values", filename)
+	}
+
+	for i := range cfg.Counts {
+		if err := cfg.Counts[i].compile(); err != nil {
+			return cfg, fmt.Errorf("%s: %s", filename, err)
+		}
+	}
+
+	for i := range cfg.Names {
+		if err := cfg.Names[i].compile(); err != nil {
+			return cfg, fmt.Errorf("%s: %s", filename, err)
+		}
+	}
+
+	for i := range cfg.Quarantine {
+		if err := cfg.Quarantine[i].compile(); err != nil {
+			return cfg, fmt.Errorf("%s: %s", filename, err)
+		}
+	}
+
+	if c := cfg.Compose; c != nil {
+		if err := c.compile(filepath.Dir(filename)); err != nil {
+			return cfg, fmt.Errorf("%s: %s", filename, err)
+		}
+	}
+
+	for name, s := range cfg.Sets {
+		if s == nil {
+			return cfg, fmt.Errorf("%s: set %q is empty", filename, name)
+		}
+		if err := s.compile(name); err != nil {
+			return cfg, fmt.Errorf("%s: %s", filename, err)
+		}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// coreClasses maps the --cores values to the taskpolicy arguments steering
+// the benchmark processes onto that class of cores on macOS. The scheduler
+// keeps the lowest throughput and latency tiers on the performance cores and
+// background processes on the efficiency cores.
+var coreClasses = map[string][]string{
+	"performance": {"-t", "0", "-l", "0"},
+	"efficiency":  {"-c", "background"},
+}
+
+// benchCommand returns the command running the benchmarks with exeName,
+// wrapped in taskpolicy with --cores.
+func (r runner) benchCommand(exeName string, args []string) *exec.Cmd {
+	if r.Cores == "" {
+		return commandContext(r.context(), exeName, args...)
+	}
+	policy := append(append([]string(nil), coreClasses[r.Cores]...), exeName)
+	return commandContext(r.context(), "taskpolicy", append(policy, args...)...)
+}
+
+// writeCores records the --cores class as a configuration line in the
+// results, if set.
+func (c config) writeCores(w io.Writer) error {
+	if c.Cores == "" {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "cores: %s\n", c.Cores)
+	return err
+}
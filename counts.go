@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// countOverride sets the count for the top level benchmarks matching Bench,
+// e.g. fewer runs for slow macro benchmarks.
+type countOverride struct {
+	Bench string `json:"bench"`
+	Count int    `json:"count"`
+
+	re *regexp.Regexp
+}
+
+func (c *countOverride) compile() error {
+	if c.Count < 1 {
+		return fmt.Errorf("count for %q must be at least 1", c.Bench)
+	}
+	var err error
+	if c.re, err = regexp.Compile(c.Bench); err != nil {
+		return fmt.Errorf("invalid bench pattern %q: %s", c.Bench, err)
+	}
+	return nil
+}
+
+// countGroup is a set of benchmarks run with the same count.
+type countGroup struct {
+	// The -bench pattern.
+	bench string
+
+	// The total count, 0 for the count of the ref.
+	count int
+}
+
+// chunkCount returns the number of runs for g in the chunk of n runs after
+// done of the total count for the ref. The runs of overridden counts are
+// spread evenly across the chunks, so they add up to g.count.
+func (g countGroup) chunkCount(done, n, count int) int {
+	if g.count == 0 {
+		return n
+	}
+	return g.count*(done+n)/count - g.count*done/count
+}
+
+// countGroups returns the benchmarks to run grouped by their count, with the
+// first matching override in the config file taking precedence. Without
+// overrides, all the benchmarks are run with the count of the ref.
+func (r runner) countGroups(exeName string, env []string) ([]countGroup, error) {
+	if len(r.file.Counts) == 0 {
+		return []countGroup{{bench: r.Bench}}, nil
+	}
+	if r.Command != "" {
+		return nil, fmt.Errorf("counts in the config file can not be used with --command")
+	}
+	if strings.Contains(r.Bench, "/") {
+		return nil, fmt.Errorf("counts in the config file can not be used with the sub-benchmark pattern %q", r.Bench)
+	}
+
+	names, err := r.listBenchmarks(exeName, env)
+	if err != nil {
+		return nil, err
+	}
+	overridden := make([][]string, len(r.file.Counts))
+	var rest []string
+	for _, name := range names {
+		i := r.matchCount(name)
+		if i == -1 {
+			rest = append(rest, name)
+			continue
+		}
+		overridden[i] = append(overridden[i], name)
+	}
+
+	var groups []countGroup
+	if len(rest) > 0 {
+		groups = append(groups, countGroup{bench: benchPattern(map[string][]string{"": rest})})
+	}
+	for i, names := range overridden {
+		if len(names) > 0 {
+			groups = append(groups, countGroup{bench: benchPattern(map[string][]string{"": names}), count: r.file.Counts[i].Count})
+		}
+	}
+	return groups, nil
+}
+
+// matchCount returns the index of the first count override matching the
+// benchmark name, -1 if none.
+func (r runner) matchCount(name string) int {
+	for i, c := range r.file.Counts {
+		if c.re.MatchString(name) {
+			return i
+		}
+	}
+	return -1
+}
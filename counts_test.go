@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestCountGroupChunkCount(t *testing.T) {
+	for _, test := range []struct {
+		group countGroup
+		count int
+		want  []int
+	}{
+		{countGroup{}, 4, []int{1, 1, 1, 1}},
+		{countGroup{count: 2}, 4, []int{0, 1, 0, 1}},
+		{countGroup{count: 10}, 4, []int{2, 3, 2, 3}},
+	} {
+		for done, want := range test.want {
+			if got := test.group.chunkCount(done, 1, test.count); got != want {
+				t.Errorf("count %d of %d, chunk %d: got %d, want %d", test.group.count, test.count, done, got, want)
+			}
+		}
+	}
+}
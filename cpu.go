@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// cpuMatrix holds the time comparisons for runs with multiple --cpu counts,
+// one row per benchmark with a column per CPU count.
+type cpuMatrix struct {
+	cpus []int
+	rows []cpuRow
+}
+
+type cpuRow struct {
+	name  string
+	cells map[int]comparison
+}
+
+// cpuCounts parses the --cpu list.
+func cpuCounts(s string) ([]int, error) {
+	var cpus []int
+	for _, v := range splitList(s) {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid CPU count %q in %q", v, s)
+		}
+		cpus = append(cpus, n)
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// procs returns the benchmark name without the -N GOMAXPROCS suffix and N,
+// which is 1 if missing, as go test omits it for GOMAXPROCS=1.
+func procs(name string) (string, int) {
+	trimmed := trimProcsSuffix(name)
+	if trimmed == name {
+		return name, 1
+	}
+	n, _ := strconv.Atoi(name[len(trimmed)+1:])
+	return trimmed, n
+}
+
+func newCPUMatrix(s *summary, cpus []int) cpuMatrix {
+	m := cpuMatrix{cpus: cpus}
+	index := make(map[string]int)
+	for _, c := range s.Comparisons {
+		if !isTimeUnit(c.Unit) {
+			continue
+		}
+		name, n := procs(c.Name)
+		i, found := index[name]
+		if !found {
+			i = len(m.rows)
+			index[name] = i
+			m.rows = append(m.rows, cpuRow{name: name, cells: make(map[int]comparison)})
+		}
+		m.rows[i].cells[n] = c
+	}
+	return m
+}
+
+// efficiency returns the parallel efficiency in percent from the lowest to
+// the highest CPU count for the base and the current results, that is the
+// speedup divided by the increase in CPUs.
+func (m cpuMatrix) efficiency(row cpuRow) (float64, float64, bool) {
+	lo, hi := m.cpus[0], m.cpus[len(m.cpus)-1]
+	c1, found1 := row.cells[lo]
+	c2, found2 := row.cells[hi]
+	if !found1 || !found2 || lo == hi || c2.OldMean == 0 || c2.NewMean == 0 {
+		return 0, 0, false
+	}
+	scale := float64(hi) / float64(lo)
+	return c1.OldMean / c2.OldMean / scale * 100, c1.NewMean / c2.NewMean / scale * 100, true
+}
+
+func (m cpuMatrix) cells(row cpuRow) []string {
+	var cells []string
+	for _, n := range m.cpus {
+		c, found := row.cells[n]
+		switch {
+		case !found:
+			cells = append(cells, "-")
+		case c.Significant:
+			cells = append(cells, fmt.Sprintf("%+.2f%%", c.Delta))
+		default:
+			cells = append(cells, "~")
+		}
+	}
+	if e1, e2, ok := m.efficiency(row); ok {
+		cells = append(cells, fmt.Sprintf("%.0f%% => %.0f%%", e1, e2))
+	} else {
+		cells = append(cells, "-")
+	}
+	return cells
+}
+
+func (m cpuMatrix) header() []string {
+	var header []string
+	for _, n := range m.cpus {
+		header = append(header, fmt.Sprintf("cpu=%d", n))
+	}
+	return append(header, "efficiency")
+}
+
+// text renders the matrix as an aligned plain text table.
+func (m cpuMatrix) text() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "time delta\t%s\n", strings.Join(m.header(), "\t"))
+	for _, row := range m.rows {
+		fmt.Fprintf(w, "%s\t%s\n", row.name, strings.Join(m.cells(row), "\t"))
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// markdown renders the matrix as a markdown table.
+func (m cpuMatrix) markdown() string {
+	var sb strings.Builder
+	header := m.header()
+	fmt.Fprintf(&sb, "| Benchmark | %s |\n", strings.Join(header, " | "))
+	fmt.Fprintf(&sb, "|---|%s\n", strings.Repeat("---:|", len(header)))
+	for _, row := range m.rows {
+		fmt.Fprintf(&sb, "| %s | %s |\n", row.name, strings.Join(m.cells(row), " | "))
+	}
+	return sb.String()
+}
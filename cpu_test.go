@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCPUMatrix(t *testing.T) {
+	bf1, _ := parseBenchFile(strings.NewReader(`BenchmarkFoo	10	400 ns/op
+BenchmarkFoo	10	401 ns/op
+BenchmarkFoo	10	402 ns/op
+BenchmarkFoo	10	403 ns/op
+BenchmarkFoo-4	10	100 ns/op
+BenchmarkFoo-4	10	101 ns/op
+BenchmarkFoo-4	10	102 ns/op
+BenchmarkFoo-4	10	103 ns/op
+`))
+	bf2, _ := parseBenchFile(strings.NewReader(`BenchmarkFoo	10	400 ns/op
+BenchmarkFoo	10	401 ns/op
+BenchmarkFoo	10	402 ns/op
+BenchmarkFoo	10	403 ns/op
+BenchmarkFoo-4	10	200 ns/op
+BenchmarkFoo-4	10	201 ns/op
+BenchmarkFoo-4	10	202 ns/op
+BenchmarkFoo-4	10	203 ns/op
+`))
+	cpus, err := cpuCounts("4,1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newCPUMatrix(newSummary("base", "current", bf1, bf2, nil), cpus)
+	assertContainsAll(t, m.markdown(),
+		"| Benchmark | cpu=1 | cpu=4 | efficiency |",
+		"| BenchmarkFoo | ~ | +98.52% | 99% => 50% |")
+}
+
+func TestRunCPUGroups(t *testing.T) {
+	r := runner{config: config{ProfType: "cpu", Cpu: "8,1"}}
+	var got []string
+	err := r.runCPUGroups("main", func(r runner, profileName string) error {
+		got = append(got, r.Cpu+":"+profileName)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1:main-cpu1 8:main-cpu8"; strings.Join(got, " ") != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = nil
+	r.ProfType = ""
+	r.runCPUGroups("main", func(r runner, profileName string) error {
+		got = append(got, r.Cpu+":"+profileName)
+		return nil
+	})
+	if want := "8,1:main"; strings.Join(got, " ") != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
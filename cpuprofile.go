@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// profileCPUs returns the CPU counts to capture separate profiles for, nil
+// unless profiling with more than one --cpu value.
+func (c config) profileCPUs() []int {
+	if !c.profilingEnabled() {
+		return nil
+	}
+	cpus, _ := cpuCounts(c.Cpu)
+	if len(cpus) < 2 {
+		return nil
+	}
+	return cpus
+}
+
+// cpuProfileName returns the result name for the profile of name with
+// -cpu set to cpu.
+func cpuProfileName(name string, cpu int) string {
+	return name + "-cpu" + strconv.Itoa(cpu)
+}
+
+// runCPUGroups runs run once per --cpu value with its own profile when
+// profiling with more than one, else once for all.
+func (r runner) runCPUGroups(name string, run func(r runner, profileName string) error) error {
+	cpus := r.profileCPUs()
+	if cpus == nil {
+		return run(r, name)
+	}
+	for _, cpu := range cpus {
+		rc := r
+		rc.Cpu = strconv.Itoa(cpu)
+		if err := run(rc, cpuProfileName(name, cpu)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportCPUProfiles merges the per CPU count profiles for the benchmarked
+// refs into one profile per ref, and writes and prints the difference for
+// the current code between the lowest and highest CPU count, e.g. to find
+// contention that only shows with more parallelism.
+func (r runner) reportCPUProfiles(cpus []int) error {
+	names := []string{r.currentBranch}
+	if base := r.state.First; base != "" && !r.externalBase() {
+		names = append(names, base)
+	}
+	for _, name := range names {
+		var profiles []string
+		for _, cpu := range cpus {
+			filename := r.profileOutFilename(cpuProfileName(name, cpu))
+			if _, err := os.Stat(filename); err == nil {
+				profiles = append(profiles, filename)
+			}
+		}
+		if len(profiles) == 0 {
+			continue
+		}
+		args := append([]string{"tool", "pprof", "-proto", "-output", r.profileOutFilename(name)}, profiles...)
+		if output, err := exec.Command(goExe, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to merge the profiles for %q: %s: %s", name, err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	lo, hi := cpus[0], cpus[len(cpus)-1]
+	base := r.profileOutFilename(cpuProfileName(r.currentBranch, lo))
+	current := r.profileOutFilename(cpuProfileName(r.currentBranch, hi))
+	filename := filepath.Join(r.OutDir, fmt.Sprintf("%s-cpu%d-vs-cpu%d.txt", r.normalizeName(r.currentBranch), lo, hi))
+	args := []string{"tool", "pprof", "-top", "-diff_base", base, "-output", filename}
+	if !r.IncludeRuntime {
+		args = append(args, "--ignore=runtime")
+	}
+	if r.ProfSampleIndex != "" {
+		args = append(args, "-sample_index="+r.ProfSampleIndex)
+	}
+	if output, err := exec.Command(goExe, append(args, current)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to diff the profiles for -cpu %d and %d: %s: %s", lo, hi, err, strings.TrimSpace(string(output)))
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nProfile of -cpu %d compared with -cpu %d:\n\n%s", hi, lo, b)
+	fmt.Printf("\nExplore it with: go tool pprof -http=localhost:0 -diff_base %s %s\n", base, current)
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+)
+
+// errAborted is returned for benchmark runs aborted because --max-duration
+// was reached or gobench was interrupted.
+var errAborted = errors.New("benchmark run aborted")
+
+// waitDelay is how long to wait for the output of a killed command before
+// giving up on it, in case a process it started still holds it open.
+const waitDelay = 5 * time.Second
+
+// newRunContext returns a context that is done when maxDuration, if set,
+// has passed or on the first interrupt. A second interrupt kills gobench.
+func newRunContext(maxDuration time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if maxDuration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, maxDuration)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			fmt.Println("\nInterrupted, stopping the remaining benchmark runs. Interrupt again to quit.")
+			signal.Stop(interrupt)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// commandContext is like exec.CommandContext, but kills the process group
+// of the command when ctx is done, so the processes it started are killed
+// too and don't keep writing to its output.
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.WaitDelay = waitDelay
+	return cmd
+}
+
+func (r runner) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// aborted reports whether the remaining benchmark runs should be skipped.
+func (r runner) aborted() bool {
+	return r.context().Err() != nil
+}
+
+// ignoreAborted returns nil if err is from an aborted run, in which case the
+// remaining runs are skipped and the report is based on the results so far.
+func ignoreAborted(err error) error {
+	if errors.Is(err, errAborted) {
+		return nil
+	}
+	return err
+}
+
+// printAborted prints a note about the runs completed if they were aborted.
+func (r runner) printAborted() {
+	if !r.aborted() {
+		return
+	}
+	reason := "interrupted"
+	if r.context().Err() == context.DeadlineExceeded {
+		reason = fmt.Sprintf("aborted after --max-duration %s", r.MaxDuration)
+	}
+	fmt.Printf("Note: the benchmark runs were %s, the results are partial:", reason)
+	for _, name := range []string{r.state.First, r.state.Second} {
+		if name != "" {
+			fmt.Printf(" %q %d runs", name, r.state.Completed[name])
+		}
+	}
+	fmt.Println(".")
+}
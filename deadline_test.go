@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunChunkDeadline(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+
+	// The sleep is a child of the shell, like the test binary of go test,
+	// and holds the output open when only the shell is killed.
+	exe := filepath.Join(t.TempDir(), "go")
+	script := "#!/bin/sh\necho 'BenchmarkA 1 100 ns/op'\nsleep 60\necho 'BenchmarkB 1 100 ns/op'\n"
+	if err := os.WriteFile(exe, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	r := runner{ctx: ctx}
+
+	var output, errOutput bytes.Buffer
+	start := time.Now()
+	if err := r.runChunk(exe, []string{"test"}, nil, nil, &output, &errOutput); err == nil {
+		t.Fatal("expected an error for the killed run")
+	}
+	if elapsed := time.Since(start); elapsed >= waitDelay {
+		t.Errorf("the run returned after %s, want before the WaitDelay of %s", elapsed, waitDelay)
+	}
+	if got := output.String(); !strings.Contains(got, "BenchmarkA") || strings.Contains(got, "BenchmarkB") {
+		t.Errorf("got output %q, want only the results before the deadline", got)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type depCmd struct {
+	Module   string `arg:"required" help:"the module path of the dependency, e.g. github.com/foo/bar"`
+	Versions string `arg:"required" help:"comma separated list of versions to compare, e.g. v1.4.0,v1.5.0. With only one version, the currently required version is used as the base."`
+}
+
+type replaceCmd struct {
+	Module string `arg:"required" help:"the module path of the dependency, e.g. github.com/foo/bar"`
+	With   string `arg:"required" help:"the replacement, a local directory (e.g. ../bar) or module@version"`
+}
+
+// moduleVariant is a modification of the current module's go.mod to benchmark.
+type moduleVariant struct {
+	name string
+
+	// The go command arguments that modifies go.mod.
+	args []string
+}
+
+// runDep benchmarks the current code against each of the configured
+// versions of a dependency.
+func (r runner) runDep() error {
+	versions := splitList(r.Dep.Versions)
+	if len(versions) == 0 {
+		return errors.New("no versions given")
+	}
+	if len(versions) == 1 {
+		current, err := requiredVersion(r.Dep.Module)
+		if err != nil {
+			return err
+		}
+		versions = append([]string{current}, versions...)
+	}
+
+	var variants []moduleVariant
+	seen := make(map[string]bool)
+	for _, version := range versions {
+		if seen[version] {
+			return fmt.Errorf("version %s is listed more than once", version)
+		}
+		seen[version] = true
+		variants = append(variants, moduleVariant{
+			name: version,
+			args: []string{"get", r.Dep.Module + "@" + version},
+		})
+	}
+
+	return r.runModuleVariants(variants)
+}
+
+// runReplace benchmarks the current code with and without a replace directive.
+func (r runner) runReplace() error {
+	with := r.Replace.With
+	if strings.HasPrefix(with, ".") || filepath.IsAbs(with) {
+		// The worktree lives elsewhere, so make local paths absolute.
+		var err error
+		if with, err = filepath.Abs(with); err != nil {
+			return err
+		}
+	}
+
+	return r.runModuleVariants([]moduleVariant{
+		{name: "upstream", args: []string{"mod", "edit", "-dropreplace=" + r.Replace.Module}},
+		{name: "replaced", args: []string{"mod", "edit", "-replace=" + r.Replace.Module + "=" + with}},
+	})
+}
+
+// runModuleVariants benchmarks the current code, including the uncommitted
+// changes, with each go.mod variant, each in its own temporary worktree, and
+// compares the first with the rest.
+func (r runner) runModuleVariants(variants []moduleVariant) error {
+	gomod, err := exec.Command(goExe, "env", "GOMOD").Output()
+	if err != nil {
+		return fmt.Errorf("failed to find go.mod: %s", err)
+	}
+	modDir := filepath.Dir(strings.TrimSpace(string(gomod)))
+
+	if r.Count == 0 {
+		r.Count = benchStatCountCompare
+	}
+	r.state = newRunState(r.config, variants[0].name, variants[len(variants)-1].name)
+
+	for _, variant := range variants {
+		fmt.Printf("\nBenchmark %s: go %s\n", variant.name, strings.Join(variant.args, " "))
+		if err := r.runModuleVariant(variant, modDir); err != nil {
+			return err
+		}
+	}
+
+	// Make it stand out a little.
+	fmt.Print("\n\n")
+	for _, variant := range variants[1:] {
+		if err := r.runBenchStat(variants[0].name, variant.name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runModuleVariant benchmarks the variant in a snapshot of the working tree.
+// The relative replace paths in the go.mod in modDir are made absolute, as
+// the worktree lives elsewhere.
+func (r runner) runModuleVariant(variant moduleVariant, modDir string) error {
+	dir, remove, err := snapshotWorktree()
+	if err != nil {
+		return err
+	}
+	defer remove()
+
+	if err := absReplacePaths(dir, modDir); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(goExe, variant.args...)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run go %s: %s", strings.Join(variant.args, " "), err)
+	}
+
+	r.workDir = dir
+
+	return r.runBenchmark(goExe, variant.name, r.Count, nil)
+}
+
+// absReplacePaths rewrites the replace directives with relative paths in the
+// go.mod of the module in dir to absolute paths, resolved against modDir.
+func absReplacePaths(dir, modDir string) error {
+	cmd := exec.Command(goExe, "mod", "edit", "-json")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to read go.mod: %s", err)
+	}
+	var mod struct {
+		Replace []struct {
+			Old, New struct{ Path, Version string }
+		}
+	}
+	if err := json.Unmarshal(output, &mod); err != nil {
+		return err
+	}
+
+	var args []string
+	for _, rep := range mod.Replace {
+		if rep.New.Version != "" || !isRelativeModulePath(rep.New.Path) {
+			continue
+		}
+		old := rep.Old.Path
+		if rep.Old.Version != "" {
+			old += "@" + rep.Old.Version
+		}
+		args = append(args, "-replace="+old+"="+filepath.Join(modDir, rep.New.Path))
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	cmd = exec.Command(goExe, append([]string{"mod", "edit"}, args...)...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to rewrite the replace directives: %s: %s", err, output)
+	}
+	return nil
+}
+
+// isRelativeModulePath reports whether the replacement path is a relative
+// directory, which go.mod requires to start with ./ or ../.
+func isRelativeModulePath(path string) bool {
+	for _, prefix := range []string{"./", "../", `.\`, `..\`} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredVersion returns the version of module required by the current module.
+func requiredVersion(module string) (string, error) {
+	output, err := exec.Command(goExe, "list", "-m", "-f", "{{.Version}}", module).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the current version of %s: %s", module, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// splitList splits a comma separated list, dropping empty elements.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// notifyDesktopDone sends a desktop notification with the result of a run
+// started at start that failed with err, if it took longer than
+// --notify-desktop. Failing to notify is only a warning.
+func (c config) notifyDesktopDone(start time.Time, err error) {
+	if c.NotifyDesktop <= 0 || time.Since(start) < c.NotifyDesktop {
+		return
+	}
+	title, message := "gobench finished", fmt.Sprintf("Done in %s.", time.Since(start).Round(time.Second))
+	switch {
+	case errors.Is(err, errNothingToRun):
+		message = "Nothing to run."
+	case err != nil:
+		title, message = "gobench failed", err.Error()
+	default:
+		if s := readSummaryJSON(filepath.Join(c.OutDir, summaryFilename), start); s != nil && s.Base != "" {
+			if !s.Passed {
+				title = "gobench failed"
+			}
+			message = fmt.Sprintf("%s vs %s: %s", s.Base, s.Current, s.Headline())
+		}
+	}
+	if err := notifyDesktop(title, message); err != nil {
+		fmt.Printf("Warning: failed to send desktop notification: %s\n", err)
+	}
+}
+
+// readSummaryJSON reads the summary.json written after since, nil if
+// there is none.
+func readSummaryJSON(filename string, since time.Time) *runSummary {
+	fi, err := os.Stat(filename)
+	if err != nil || fi.ModTime().Before(since) {
+		return nil
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	// encoding/json can't allocate the unexported embedded summary.
+	rs := runSummary{summary: &summary{}}
+	if err := json.Unmarshal(b, &rs); err != nil {
+		return nil
+	}
+	return &rs
+}
+
+// notifyDesktop shows a native desktop notification using osascript on
+// macOS, notify-send on Linux and PowerShell on Windows.
+func notifyDesktop(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		quote := func(s string) string {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+		}
+		cmd = exec.Command("osascript", "-e", "display notification "+quote(message)+" with title "+quote(title))
+	case "linux":
+		cmd = exec.Command("notify-send", "--app-name=gobench", title, message)
+	case "windows":
+		quote := func(s string) string {
+			return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+		}
+		script := fmt.Sprintf(`Add-Type -AssemblyName System.Windows.Forms
+$n = New-Object System.Windows.Forms.NotifyIcon
+$n.Icon = [System.Drawing.SystemIcons]::Information
+$n.Visible = $true
+$n.ShowBalloonTip(10000, %s, %s, 'Info')
+Start-Sleep -Seconds 10
+$n.Dispose()`, quote(title), quote(message))
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	default:
+		return fmt.Errorf("not supported on %s", runtime.GOOS)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
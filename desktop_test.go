@@ -0,0 +1,28 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadSummaryJSON(t *testing.T) {
+	start := time.Now().Add(-time.Second)
+	r := runner{config: config{OutDir: t.TempDir()}}
+	s := &summary{Base: "main", Current: "feature", Threshold: 5, Violations: []comparison{{Name: "BenchmarkFoo"}}}
+	if err := r.writeSummaryJSON("main", "feature", s); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(r.OutDir, summaryFilename)
+
+	rs := readSummaryJSON(filename, start)
+	if rs == nil {
+		t.Fatal("no summary")
+	}
+	if rs.Passed || rs.Base != "main" || len(rs.Violations) != 1 {
+		t.Errorf("got %+v", rs)
+	}
+	if rs := readSummaryJSON(filename, time.Now().Add(time.Minute)); rs != nil {
+		t.Error("expected no summary for a stale summary.json")
+	}
+}
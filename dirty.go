@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// dirtyModes are the valid --dirty values.
+var dirtyModes = []string{"stash", "copy"}
+
+// runDirtyCopy benchmarks HEAD in a git worktree against a snapshot of the
+// uncommitted changes in another, leaving the working directory alone.
+func (r *runner) runDirtyCopy(exe1, exe2, first, second string) error {
+	fmt.Println("Snapshot the uncommitted changes")
+	current := *r
+	dir, remove, err := snapshotWorktree()
+	if err != nil {
+		return err
+	}
+	defer remove()
+	current.workDir = dir
+
+	base := *r
+	dir, remove, err = r.addWorktree("HEAD")
+	if err != nil {
+		return err
+	}
+	defer remove()
+	base.workDir = dir
+
+	if err := base.runBenchmark(exe1, first, r.countBase(), r.EnvBase); err != nil {
+		return err
+	}
+	return current.runBenchmark(exe2, second, r.countCurrent(), r.EnvCurrent)
+}
+
+// snapshotWorktree adds a temporary git worktree at HEAD with the uncommitted
+// changes, staged or not, and the untracked files not ignored copied over.
+// It returns the same as addWorktree.
+func snapshotWorktree() (string, func(), error) {
+	toplevel, err := gitOutput("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", nil, err
+	}
+
+	// The sparse-checkout cone may not include all changed files.
+	dir, remove, err := addWorktree("HEAD", nil)
+	if err != nil {
+		return "", nil, err
+	}
+	root, err := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		remove()
+		return "", nil, err
+	}
+
+	diff, err := exec.Command("git", "-C", toplevel, "diff", "--binary", "HEAD").Output()
+	if err != nil {
+		remove()
+		return "", nil, fmt.Errorf("failed to diff the uncommitted changes: %s", err)
+	}
+	if len(diff) > 0 {
+		cmd := exec.Command("git", "apply", "--binary", "-")
+		cmd.Dir = root
+		cmd.Stdin = bytes.NewReader(diff)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			remove()
+			return "", nil, fmt.Errorf("failed to apply the uncommitted changes: %s: %s", err, output)
+		}
+	}
+
+	untracked, err := exec.Command("git", "-C", toplevel, "ls-files", "-z", "--others", "--exclude-standard").Output()
+	if err != nil {
+		remove()
+		return "", nil, fmt.Errorf("failed to list the untracked files: %s", err)
+	}
+	for _, filename := range strings.Split(string(untracked), "\x00") {
+		if filename == "" {
+			continue
+		}
+		if err := copyFile(filepath.Join(toplevel, filename), filepath.Join(root, filename)); err != nil {
+			remove()
+			return "", nil, err
+		}
+	}
+
+	return dir, remove, nil
+}
+
+// copyFile copies the file src to dst, creating the directories needed.
+func copyFile(src, dst string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
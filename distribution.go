@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// distributionPercentiles are the percentiles reported with --distribution.
+var distributionPercentiles = []float64{0, 25, 50, 75, 90, 100}
+
+// histogramBuckets is the number of buckets in the distribution histograms.
+const histogramBuckets = 12
+
+// histogramBars are the bars used to render the histograms, from empty to full.
+var histogramBars = []rune(" ▁▂▃▄▅▆▇█")
+
+// distribution holds all the samples of one benchmark and unit from the
+// count runs of the base and the current code.
+type distribution struct {
+	Name string `json:"name"`
+	Unit string `json:"unit"`
+
+	// The samples, sorted.
+	Base    []float64 `json:"base"`
+	Current []float64 `json:"current"`
+}
+
+func newDistribution(c comparison) distribution {
+	d := distribution{
+		Name:    c.Name,
+		Unit:    c.Unit,
+		Base:    append([]float64(nil), c.Old...),
+		Current: append([]float64(nil), c.New...),
+	}
+	sort.Float64s(d.Base)
+	sort.Float64s(d.Current)
+	return d
+}
+
+// percentile returns the p-th percentile of the sorted values, linearly
+// interpolated between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := p / 100 * float64(len(sorted)-1)
+	i := int(pos)
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (pos-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+// histogram renders the values as a row of bars, one per bucket between
+// lo and hi, with the heights relative to the fullest bucket.
+func histogram(values []float64, lo, hi float64, buckets int) string {
+	counts := make([]int, buckets)
+	var most int
+	for _, v := range values {
+		i := 0
+		if hi > lo {
+			i = int(float64(buckets) * (v - lo) / (hi - lo))
+		}
+		if i >= buckets {
+			i = buckets - 1
+		}
+		counts[i]++
+		if counts[i] > most {
+			most = counts[i]
+		}
+	}
+
+	var sb strings.Builder
+	for _, n := range counts {
+		bar := 0
+		if n > 0 {
+			// Any non-empty bucket gets at least the lowest bar.
+			bar = int(math.Ceil(float64(n) / float64(most) * float64(len(histogramBars)-1)))
+		}
+		sb.WriteRune(histogramBars[bar])
+	}
+	return sb.String()
+}
+
+// renderDistributions renders the percentiles and a histogram of the samples
+// for each comparison in s with any spread. The histograms for a benchmark share the same
+// range, so they can be compared at a glance.
+func renderDistributions(s *summary) string {
+	var sb strings.Builder
+	for _, c := range s.Comparisons {
+		d := newDistribution(c)
+		if len(d.Base) == 0 || len(d.Current) == 0 {
+			continue
+		}
+		lo := math.Min(d.Base[0], d.Current[0])
+		hi := math.Max(d.Base[len(d.Base)-1], d.Current[len(d.Current)-1])
+		if lo == hi {
+			// Nothing to see, e.g. allocs/op.
+			continue
+		}
+
+		fmt.Fprintf(&sb, "%s %s [%.4g, %.4g]\n", d.Name, d.Unit, lo, hi)
+		tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+		fmt.Fprint(tw, "\t\tn")
+		for _, p := range distributionPercentiles {
+			fmt.Fprintf(tw, "\t%s", percentileName(p))
+		}
+		fmt.Fprintln(tw)
+		for _, side := range []struct {
+			name    string
+			samples []float64
+		}{{s.Base, d.Base}, {s.Current, d.Current}} {
+			fmt.Fprintf(tw, "\t%s\t%d", side.name, len(side.samples))
+			for _, p := range distributionPercentiles {
+				fmt.Fprintf(tw, "\t%.4g", percentile(side.samples, p))
+			}
+			fmt.Fprintf(tw, "\t|%s|\n", histogram(side.samples, lo, hi, histogramBuckets))
+		}
+		tw.Flush()
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func percentileName(p float64) string {
+	switch p {
+	case 0:
+		return "min"
+	case 100:
+		return "max"
+	}
+	return fmt.Sprintf("p%g", p)
+}
+
+// writeDistributions writes the samples for each comparison in s as JSON to
+// distributions.json in the out dir.
+func (c config) writeDistributions(s *summary) error {
+	distributions := make([]distribution, 0, len(s.Comparisons))
+	for _, c := range s.Comparisons {
+		distributions = append(distributions, newDistribution(c))
+	}
+	b, err := json.MarshalIndent(distributions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.OutDir, "distributions.json"), b, 0o666)
+}
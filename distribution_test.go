@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+	for _, test := range []struct {
+		p, expected float64
+	}{
+		{0, 1},
+		{50, 3},
+		{90, 4.6},
+		{100, 5},
+	} {
+		if got := percentile(sorted, test.p); got < test.expected-1e-9 || got > test.expected+1e-9 {
+			t.Errorf("percentile(%v) = %v, expected %v", test.p, got, test.expected)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	if got := histogram([]float64{1, 1, 1, 1, 2, 10}, 1, 10, 4); got != "█  ▂" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+type doctorCmd struct{}
+
+// doctorCheck is a check of the environment gobench runs in.
+type doctorCheck struct {
+	name string
+
+	// Optional checks are for tools only needed by some flags.
+	optional bool
+
+	// run returns a short description of what was found, or an error.
+	run func() (string, error)
+
+	// fix suggests how to fix a failed check.
+	fix string
+}
+
+// runDoctor verifies that the tools gobench depends on are available and
+// prints suggestions for how to fix any problems found. It fails if any of
+// the required checks fail.
+func (r runner) runDoctor() error {
+	checks := []doctorCheck{
+		{
+			name: "git",
+			run:  func() (string, error) { return commandOutput("git", "version") },
+			fix:  "install git, see https://git-scm.com/downloads",
+		},
+		{
+			name: "git repository",
+			run:  func() (string, error) { return gitOutput("", "rev-parse", "--show-toplevel") },
+			fix:  "run gobench from within a git repository",
+		},
+		{
+			name: "go",
+			run:  func() (string, error) { return commandOutput(goExe, "version") },
+			fix:  "install Go from https://go.dev/dl/, or point GOEXE to a Go binary",
+		},
+		{
+			name: "benchstat",
+			run:  func() (string, error) { return lookPath("benchstat") },
+			fix:  "go install golang.org/x/perf/cmd/benchstat@latest, and make sure $(go env GOPATH)/bin is in your PATH",
+		},
+		{
+			name: "out dir",
+			run:  func() (string, error) { return r.OutDir, checkWritable(r.OutDir) },
+			fix:  "set --outdir to a directory you can write to",
+		},
+		{
+			name:     "graphviz (pprof graphs)",
+			optional: true,
+			run:      func() (string, error) { return lookPath("dot") },
+			fix:      "install Graphviz, see https://graphviz.org/download/",
+		},
+		{
+			name:     "callgrind viewer (--profcallgrind)",
+			optional: true,
+			run: func() (string, error) {
+				if viewer := callgrindViewer(); viewer != "" {
+					return viewer, nil
+				}
+				return "", fmt.Errorf("qcachegrind or kcachegrind not found")
+			},
+			fix: "install qcachegrind or kcachegrind, without them pprof's web UI is used",
+		},
+	}
+	if runtime.GOOS == "linux" {
+		checks = append(checks,
+			doctorCheck{
+				name:     "perf (--perf-stat, --instructions)",
+				optional: true,
+				run:      func() (string, error) { return lookPath("perf") },
+				fix:      "install perf, e.g. apt install linux-tools-generic, and allow access to the counters with sysctl kernel.perf_event_paranoid=1",
+			},
+			doctorCheck{
+				name:     "taskset (CPU pinning)",
+				optional: true,
+				run:      func() (string, error) { return lookPath("taskset") },
+				fix:      "install util-linux",
+			},
+		)
+	}
+
+	var failed int
+	for _, check := range checks {
+		found, err := check.run()
+		if err == nil {
+			fmt.Printf("ok    %s: %s\n", check.name, firstLine(found))
+			continue
+		}
+		status := "FAIL"
+		if check.optional {
+			status = "warn"
+		} else {
+			failed++
+		}
+		fmt.Printf("%s  %s: %s\n      Fix: %s\n", status, check.name, firstLine(err.Error()), check.fix)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+func commandOutput(name string, args ...string) (string, error) {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s %s failed: %s: %s", name, strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func lookPath(name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%s not found in PATH", name)
+	}
+	return path, nil
+}
+
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, "doctor")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(filepath.Join(dir, filepath.Base(f.Name())))
+}
+
+func firstLine(s string) string {
+	return strings.SplitN(s, "\n", 2)[0]
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// sendEmail sends the report for s to the configured recipients.
+func (r runner) sendEmail(s *summary) error {
+	to := splitList(r.EmailTo)
+
+	var body, contentType string
+	if r.EmailFormat == "html" {
+		html, err := renderHTML(s)
+		if err != nil {
+			return err
+		}
+		body, contentType = html, "text/html"
+	} else {
+		body, contentType = s.Report+"\n"+r.compactSummary(s), "text/plain"
+	}
+
+	subject := fmt.Sprintf("gobench: %s vs %s: %d regressions", s.Base, s.Current, len(s.regressions()))
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", r.EmailFrom)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: %s; charset=UTF-8\r\n\r\n", contentType)
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if r.SMTPUser != "" {
+		host, _, err := net.SplitHostPort(r.SMTPAddr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", r.SMTPUser, r.SMTPPassword, host)
+	}
+
+	return smtp.SendMail(r.SMTPAddr, auth, r.EmailFrom, to, msg.Bytes())
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+type envCmd struct {
+	Lock   *envLockCmd `arg:"subcommand:lock" help:"set the CPU frequency governor to performance and disable turbo boost, saving the previous settings"`
+	Unlock *envLockCmd `arg:"subcommand:unlock" help:"restore the settings saved by lock"`
+}
+
+type envLockCmd struct{}
+
+const (
+	noTurboFile = "/sys/devices/system/cpu/intel_pstate/no_turbo"
+	boostFile   = "/sys/devices/system/cpu/cpufreq/boost"
+)
+
+// runEnv runs the env lock and unlock commands.
+func (r runner) runEnv() error {
+	switch {
+	case r.EnvCmd.Lock != nil:
+		locked, err := lockEnv()
+		if err == nil && !locked {
+			err = errors.New("already locked, run gobench env unlock first")
+		}
+		return err
+	case r.EnvCmd.Unlock != nil:
+		return unlockEnv()
+	}
+	return errors.New("missing command, lock or unlock")
+}
+
+// envLockFilename is where the settings to restore on unlock are saved.
+func envLockFilename() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gobench", "env-lock.json"), nil
+}
+
+// envLockSettings returns the sysfs files and values to set to lock the
+// environment: the performance governor for all CPUs and no turbo boost,
+// with the intel_pstate driver or the generic boost switch.
+func envLockSettings() map[string]string {
+	settings := make(map[string]string)
+	governors, _ := filepath.Glob("/sys/devices/system/cpu/cpu*/cpufreq/scaling_governor")
+	for _, governor := range governors {
+		settings[governor] = "performance"
+	}
+	if readSysFile(noTurboFile) != "" {
+		settings[noTurboFile] = "1"
+	} else if readSysFile(boostFile) != "" {
+		settings[boostFile] = "0"
+	}
+	return settings
+}
+
+// lockEnv locks the environment for benchmarking, saving the current
+// settings. It returns false if it is already locked. Linux only.
+func lockEnv() (bool, error) {
+	if runtime.GOOS != "linux" {
+		return false, errors.New("locking the environment is only supported on Linux")
+	}
+	filename, err := envLockFilename()
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(filename); err == nil {
+		return false, nil
+	}
+
+	settings := envLockSettings()
+	if len(settings) == 0 {
+		return false, errors.New("no CPU frequency settings found in /sys")
+	}
+
+	saved := make(map[string]string)
+	for file := range settings {
+		saved[file] = readSysFile(file)
+	}
+	b, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o777); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(filename, b, 0o666); err != nil {
+		return false, err
+	}
+
+	fmt.Println("Set the CPU frequency governor to performance and disable turbo boost.")
+	if err := writeSysFiles(settings); err != nil {
+		// Restore what we may have changed.
+		unlockEnv()
+		return false, err
+	}
+	return true, nil
+}
+
+// unlockEnv restores the settings saved by lockEnv.
+func unlockEnv() error {
+	filename, err := envLockFilename()
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.New("not locked")
+		}
+		return err
+	}
+	var saved map[string]string
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return fmt.Errorf("invalid %s: %s", filename, err)
+	}
+
+	fmt.Println("Restore the CPU frequency governor and turbo boost settings.")
+	if err := writeSysFiles(saved); err != nil {
+		return err
+	}
+	return os.Remove(filename)
+}
+
+// writeSysFiles writes the values to the sysfs files, with sudo if not
+// running as root.
+func writeSysFiles(values map[string]string) error {
+	files := make([]string, 0, len(values))
+	for file := range values {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		value := values[file]
+		if os.Geteuid() == 0 {
+			if err := os.WriteFile(file, []byte(value), 0o644); err != nil {
+				return err
+			}
+			continue
+		}
+		cmd := exec.Command("sudo", "tee", file)
+		cmd.Stdin = strings.NewReader(value)
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to write %q to %s: %s", value, file, err)
+		}
+	}
+	return nil
+}
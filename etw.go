@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// etwProfiles maps the --etw values to built-in Windows Performance
+// Recorder profiles.
+var etwProfiles = map[string]string{
+	"cpu":     "CPU",
+	"heap":    "Heap",
+	"general": "GeneralProfile",
+}
+
+// runETW compiles the benchmark binary for the current code, captures an ETW
+// trace of a run of it with wpr using the --etw profile and opens the trace
+// in Windows Performance Analyzer. Windows only, and wpr needs an elevated
+// prompt.
+func (r runner) runETW() error {
+	if runtime.GOOS != "windows" {
+		return errors.New("--etw requires Windows")
+	}
+	if len(r.packageArgs()) != 1 {
+		return fmt.Errorf("--etw requires a single package, got %d", len(r.packageArgs()))
+	}
+
+	name := r.normalizeName(r.currentBranch)
+	binary := withExeSuffix(filepath.Join(r.OutDir, name+".test"))
+	trace := filepath.Join(r.OutDir, name+".etl")
+
+	if err := r.compileTestBinary(binary); err != nil {
+		return err
+	}
+
+	fmt.Printf("Record %s ETW trace to %s\n", etwProfiles[r.ETW], trace)
+	if err := wpr("-start", etwProfiles[r.ETW], "-filemode"); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(binary, "-test.run", "NONE", "-test.bench", r.Bench, "-test.benchmem")
+	cmd.Dir = r.workDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		// Don't leave the recording running.
+		wpr("-cancel")
+		return fmt.Errorf("failed to run the benchmarks: %s", err)
+	}
+
+	if err := wpr("-stop", trace); err != nil {
+		return err
+	}
+
+	return exec.Command("wpa", trace).Start()
+}
+
+func wpr(args ...string) error {
+	cmd := exec.Command("wpr", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("wpr %s failed: %s", args[0], err)
+	}
+	return nil
+}
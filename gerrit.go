@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// gerritReview is the ReviewInput of the Gerrit REST API.
+type gerritReview struct {
+	Message string         `json:"message"`
+	Tag     string         `json:"tag"`
+	Labels  map[string]int `json:"labels,omitempty"`
+}
+
+// postGerritReview posts the comparison in s as a review comment on the
+// --gerrit-change revision, with a --gerrit-label vote of -1 when the
+// threshold is violated and +1 otherwise.
+func (r runner) postGerritReview(s *summary) error {
+	change, revision := r.GerritChange, r.GerritRevision
+	if change == "" {
+		// Set by the Jenkins Gerrit Trigger plugin.
+		change = os.Getenv("GERRIT_CHANGE_NUMBER")
+	}
+	if change == "" {
+		return fmt.Errorf("no --gerrit-change set")
+	}
+	if revision == "" {
+		if revision = os.Getenv("GERRIT_PATCHSET_REVISION"); revision == "" {
+			revision = "current"
+		}
+	}
+
+	review := gerritReview{
+		Message: r.compactSummary(s),
+		// Autogenerated tags let reviewers hide the bot comments.
+		Tag: "autogenerated:gobench",
+	}
+	if r.GerritLabel != "" {
+		vote := 1
+		if len(s.Violations) > 0 {
+			vote = -1
+		}
+		review.Labels = map[string]int{r.GerritLabel: vote}
+	}
+
+	endpoint := fmt.Sprintf("%s/a/changes/%s/revisions/%s/review",
+		strings.TrimSuffix(r.GerritURL, "/"), url.PathEscape(change), url.PathEscape(revision))
+	return sendJSON("POST", endpoint, review, func(req *http.Request) {
+		req.SetBasicAuth(r.GerritUser, r.GerritPassword)
+	})
+}
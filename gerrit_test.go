@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostGerritReview(t *testing.T) {
+	var path, user string
+	var review gerritReview
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path = req.URL.EscapedPath()
+		user, _, _ = req.BasicAuth()
+		if err := json.NewDecoder(req.Body).Decode(&review); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	r := runner{config: config{GerritURL: srv.URL + "/", GerritChange: "proj~123", GerritLabel: "Perf-Review", GerritUser: "bot"}}
+	s := &summary{Base: "main", Current: "feature", Violations: []comparison{{Name: "BenchmarkFoo", Unit: "ns/op", Delta: 20}}}
+	if err := r.postGerritReview(s); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/a/changes/proj~123/revisions/current/review" || user != "bot" {
+		t.Fatalf("got path %q and user %q", path, user)
+	}
+	if review.Labels["Perf-Review"] != -1 || review.Message == "" {
+		t.Fatalf("got %+v", review)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+)
+
+type godebugCmd struct {
+	Settings []string `arg:"positional,required" help:"GODEBUG values to compare with the default, e.g. madvdontneed=1 or asyncpreemptoff=1,gctrace=1"`
+}
+
+// godebugDefault is the result name for the run without GODEBUG set.
+const godebugDefault = "default"
+
+// runGODEBUG benchmarks the current code without GODEBUG and with each of
+// the configured GODEBUG values, and compares the default with the rest.
+// The values are used as the result names.
+func (r runner) runGODEBUG() error {
+	names := append([]string{godebugDefault}, r.GODEBUG.Settings...)
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			return fmt.Errorf("GODEBUG value %s is listed more than once", name)
+		}
+		seen[name] = true
+	}
+
+	if r.Count == 0 {
+		r.Count = benchStatCountCompare
+	}
+	r.state = newRunState(r.config, names[0], names[len(names)-1])
+
+	for _, name := range names {
+		// An explicit empty GODEBUG also clears any set in the environment.
+		setting := ""
+		if name != godebugDefault {
+			setting = name
+		}
+		fmt.Printf("\nBenchmark with GODEBUG=%q\n", setting)
+		if err := r.runBenchmark(goExe, name, r.Count, []string{"GODEBUG=" + setting}); err != nil {
+			return err
+		}
+	}
+
+	// Make it stand out a little.
+	fmt.Print("\n\n")
+	for _, name := range names[1:] {
+		if err := r.runBenchStat(names[0], name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const historyFilename = "history.json"
+
+// historyEntry is the stored result of one comparison.
+type historyEntry struct {
+	Date    time.Time       `json:"date"`
+	Commit  string          `json:"commit"`
+	Base    string          `json:"base"`
+	Current string          `json:"current"`
+	Results []historyResult `json:"results"`
+}
+
+type historyResult struct {
+	Name  string  `json:"name"`
+	Unit  string  `json:"unit"`
+	Value float64 `json:"value"`
+	Delta float64 `json:"delta"`
+
+	// CV is the coefficient of variation of the samples in percent, to
+	// track the noise of the benchmark over time.
+	CV float64 `json:"cv,omitempty"`
+}
+
+func newHistoryEntry(commit string, s *summary) historyEntry {
+	e := historyEntry{
+		Date:    time.Now().UTC(),
+		Commit:  commit,
+		Base:    s.Base,
+		Current: s.Current,
+	}
+	for _, c := range s.Comparisons {
+		e.Results = append(e.Results, historyResult{Name: c.Name, Unit: c.Unit, Value: c.NewMean, Delta: c.Delta, CV: c.CV})
+	}
+	return e
+}
+
+// readHistory reads the history entries in filename, oldest first.
+// A missing file is an empty history.
+func readHistory(filename string) ([]historyEntry, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []historyEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func writeHistory(filename string, entries []historyEntry) error {
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0o644)
+}
+
+// maxHistoryCommits is the max number of commits to look at when collecting
+// the result history.
+const maxHistoryCommits = 500
+
+// writeHistoryBase collects the results stored as git notes for the last
+// window commits on branch (excluding HEAD) and writes a result file to
+// filename with the median of each run as one sample, so the base is the
+// rolling window rather than a single run.
+// It returns the number of commits used.
+func writeHistoryBase(filename, branch string, window int) (int, error) {
+	head, err := gitOutput("", "rev-parse", "HEAD")
+	if err != nil {
+		return 0, err
+	}
+	log, err := gitOutput("", "log", "--first-parent", "--format=%H", "-n", strconv.Itoa(maxHistoryCommits), branch)
+	if err != nil {
+		return 0, err
+	}
+
+	var lines []string
+	var n int
+	for _, commit := range strings.Fields(log) {
+		if n == window {
+			break
+		}
+		if commit == head {
+			continue
+		}
+		note, err := gitOutput("", "notes", "--ref="+notesRef, "show", commit)
+		if err != nil {
+			// No results for this commit.
+			continue
+		}
+		bf, err := parseBenchFile(strings.NewReader(note))
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			for _, key := range hardwareKeys {
+				if v, found := bf.Config[key]; found {
+					lines = append(lines, key+": "+v)
+				}
+			}
+		}
+		samples := bf.samples()
+		for _, key := range sortedKeys(samples) {
+			res := &benchResult{Name: key.name, Iterations: 1, Values: []benchValue{{Value: median(samples[key]), Unit: key.unit}}}
+			lines = append(lines, res.String())
+		}
+		n++
+	}
+
+	if n == 0 {
+		return 0, fmt.Errorf("no results found in %s for the last %d commits on %q", notesRef, maxHistoryCommits, branch)
+	}
+
+	return n, os.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+}
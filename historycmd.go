@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+type historyCmd struct {
+	List       *historyListCmd       `arg:"subcommand:list" help:"list the commits with results stored as git notes"`
+	Show       *historyShowCmd       `arg:"subcommand:show" help:"show the stored results for a commit, or compare the stored results for two commits"`
+	Quarantine *historyQuarantineCmd `arg:"subcommand:quarantine" help:"suggest the benchmarks to quarantine from the variation in the stored results"`
+}
+
+type historyListCmd struct {
+	Since  string `help:"only list commits from this date on, e.g. 2024-01-01"`
+	Branch string `help:"the branch to list, defaults to --history-branch"`
+}
+
+type historyShowCmd struct {
+	Commits []string `arg:"positional,required" help:"one commit to show, or two commits to compare, e.g. as listed by history list"`
+}
+
+// runHistory runs the history list, show and quarantine commands. All only
+// consider the benchmarks matching --bench.
+func (r runner) runHistory() error {
+	re, err := regexp.Compile(r.Bench)
+	if err != nil {
+		return fmt.Errorf("invalid --bench: %s", err)
+	}
+	switch {
+	case r.History.List != nil:
+		return r.historyList(re)
+	case r.History.Show != nil:
+		return r.historyShow(re)
+	case r.History.Quarantine != nil:
+		return r.historyQuarantine(re)
+	}
+	return fmt.Errorf("missing command, list, show or quarantine")
+}
+
+// historyList prints the commits on the branch with stored results, newest
+// first, with the number of matching benchmarks. If only one benchmark
+// matches, its median ns/op is printed instead.
+func (r runner) historyList(re *regexp.Regexp) error {
+	branch := r.History.List.Branch
+	if branch == "" {
+		branch = r.HistoryBranch
+	}
+	args := []string{"log", "--first-parent", "--format=%H %cs %s", "-n", strconv.Itoa(maxHistoryCommits)}
+	if r.History.List.Since != "" {
+		args = append(args, "--since="+r.History.List.Since)
+	}
+	log, err := gitOutput("", append(args, branch)...)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "commit\tdate\tresults\tsubject")
+	var n int
+	for _, line := range strings.Split(log, "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 2 {
+			continue
+		}
+		commit, date := fields[0], fields[1]
+		var subject string
+		if len(fields) == 3 {
+			subject = fields[2]
+		}
+		bf, found, err := readNote(commit)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		bf.keepBenchmarks(re)
+		if len(bf.Results) == 0 {
+			continue
+		}
+
+		results := fmt.Sprintf("%d benchmarks", len(benchmarkNames(bf)))
+		if len(benchmarkNames(bf)) == 1 {
+			samples := bf.samples()
+			for _, key := range sortedKeys(samples) {
+				if key.unit == "ns/op" {
+					results = fmt.Sprintf("%s %.4g ns/op", key.name, median(samples[key]))
+				}
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", commit[:12], date, results, subject)
+		n++
+	}
+	tw.Flush()
+
+	if n == 0 {
+		fmt.Printf("No results matching %q found in %s on %q.\n", r.Bench, notesRef, branch)
+	}
+	return nil
+}
+
+// historyShow shows the stored results for one commit, or compares the
+// stored results for two commits.
+func (r runner) historyShow(re *regexp.Regexp) error {
+	commits := r.History.Show.Commits
+	if len(commits) > 2 {
+		return fmt.Errorf("expected one or two commits, got %d", len(commits))
+	}
+
+	var names []string
+	for _, commit := range commits {
+		full, err := gitOutput("", "rev-parse", "--verify", commit+"^{commit}")
+		if err != nil {
+			return fmt.Errorf("unknown commit %q", commit)
+		}
+		bf, found, err := readNote(full)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("no results stored for %s", commit)
+		}
+		bf.keepBenchmarks(re)
+		name := full[:12]
+		if err := bf.writeFile(r.benchOutFilename(name)); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+
+	if len(names) == 1 {
+		return r.runBenchStat("", names[0])
+	}
+	return r.runBenchStat(names[0], names[1])
+}
+
+// readNote reads the results stored as a git note for commit.
+func readNote(commit string) (*benchFile, bool, error) {
+	note, err := gitOutput("", "notes", "--ref="+notesRef, "show", commit)
+	if err != nil {
+		// No results for this commit.
+		return nil, false, nil
+	}
+	bf, err := parseBenchFile(strings.NewReader(note))
+	if err != nil {
+		return nil, false, err
+	}
+	return bf, true, nil
+}
+
+// keepBenchmarks removes all results with a name not matching re from bf.
+func (bf *benchFile) keepBenchmarks(re *regexp.Regexp) {
+	var results []*benchResult
+	for _, r := range bf.Results {
+		if re.MatchString(r.Name) {
+			results = append(results, r)
+		}
+	}
+	bf.Results = results
+
+	var lines []benchLine
+	for _, line := range bf.lines {
+		if line.result != nil && !re.MatchString(line.result.Name) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	bf.lines = lines
+}
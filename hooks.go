@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// Hook stages.
+const (
+	stagePreCheckout  = "pre-checkout"
+	stagePostCheckout = "post-checkout"
+	stagePreRun       = "pre-run"
+	stagePostRun      = "post-run"
+)
+
+// hookCommand returns the configured shell command for the given stage.
+func (c config) hookCommand(stage string) string {
+	switch stage {
+	case stagePreCheckout:
+		return c.PreCheckout
+	case stagePostCheckout:
+		return c.PostCheckout
+	case stagePreRun:
+		return c.PreRun
+	case stagePostRun:
+		return c.PostRun
+	}
+	return ""
+}
+
+// runHook runs the shell command configured for the given stage, if any.
+// The command gets the current stage, ref and output paths in its environment.
+func (r runner) runHook(stage, ref string) error {
+	command := r.hookCommand(stage)
+	if command == "" {
+		return nil
+	}
+
+	fmt.Printf("Run %s hook for %q: %s\n", stage, ref, command)
+
+	cmd := shellCommand(command)
+	cmd.Dir = r.workDir
+	cmd.Env = append(os.Environ(),
+		"GOBENCH_STAGE="+stage,
+		"GOBENCH_REF="+ref,
+		"GOBENCH_PACKAGE="+r.Package,
+		"GOBENCH_OUTDIR="+r.OutDir,
+		"GOBENCH_BENCH_FILE="+r.benchOutFilename(ref),
+	)
+	if r.profilingEnabled() {
+		cmd.Env = append(cmd.Env, "GOBENCH_PROFILE_FILE="+r.profileOutFilename(ref))
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook failed: %s", stage, err)
+	}
+
+	return nil
+}
+
+// shellCommand returns a command running the given command line in the
+// system shell.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// shellCommandContext is like shellCommand, but the command and the
+// processes it started are killed when ctx is done.
+func shellCommandContext(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return commandContext(ctx, "cmd", "/C", command)
+	}
+	return commandContext(ctx, "sh", "-c", command)
+}
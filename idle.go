@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// idleStats is a sample of how busy the system is.
+type idleStats struct {
+	// The 1 minute load average divided by the number of CPUs.
+	load float64
+
+	// The CPU utilization in percent across all CPUs.
+	cpu float64
+}
+
+// waitIdle waits until the load and CPU utilization drop below the
+// --idle-load and --idle-cpu thresholds. If that does not happen within
+// --idle-timeout, it prints a warning and returns.
+func (c config) waitIdle() error {
+	deadline := time.Now().Add(c.IdleTimeout)
+	var lastPrinted time.Time
+	for {
+		stats, err := sampleIdle()
+		if err != nil {
+			return err
+		}
+		if stats.load <= c.IdleLoad && stats.cpu <= c.IdleCPU {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			fmt.Printf("Warning: the system did not become idle within %s (load %.2f per CPU, CPU %.0f%%), starting anyway.\n", c.IdleTimeout, stats.load, stats.cpu)
+			return nil
+		}
+		if time.Since(lastPrinted) > 10*time.Second {
+			fmt.Printf("Wait for the system to become idle: load %.2f per CPU (max %.2f), CPU %.0f%% (max %.0f%%)\n", stats.load, c.IdleLoad, stats.cpu, c.IdleCPU)
+			lastPrinted = time.Now()
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// sampleIdle samples the load and CPU utilization, which takes about
+// a second. Only Linux and macOS are supported.
+func sampleIdle() (idleStats, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return sampleIdleLinux()
+	case "darwin":
+		return sampleIdleDarwin()
+	}
+	return idleStats{}, errors.New("--wait-idle is only supported on Linux and macOS")
+}
+
+func sampleIdleLinux() (idleStats, error) {
+	var stats idleStats
+	b, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return stats, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return stats, errors.New("invalid /proc/loadavg")
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return stats, err
+	}
+	stats.load = load / float64(runtime.NumCPU())
+
+	busy1, total1, err := procStatCPU()
+	if err != nil {
+		return stats, err
+	}
+	time.Sleep(time.Second)
+	busy2, total2, err := procStatCPU()
+	if err != nil {
+		return stats, err
+	}
+	if total2 > total1 {
+		stats.cpu = 100 * (busy2 - busy1) / (total2 - total1)
+	}
+	return stats, nil
+}
+
+// procStatCPU returns the busy and total CPU time in /proc/stat.
+func procStatCPU() (float64, float64, error) {
+	b, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	line := strings.SplitN(string(b), "\n", 2)[0]
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, errors.New("invalid /proc/stat")
+	}
+	var busy, total float64
+	for i, f := range fields[1:] {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		total += v
+		// The fourth and fifth values are idle and iowait.
+		if i != 3 && i != 4 {
+			busy += v
+		}
+	}
+	return busy, total, nil
+}
+
+var topIdleRe = regexp.MustCompile(`CPU usage:.*?([\d.]+)% idle`)
+
+func sampleIdleDarwin() (idleStats, error) {
+	var stats idleStats
+	out, err := exec.Command("sysctl", "-n", "vm.loadavg").Output()
+	if err != nil {
+		return stats, err
+	}
+	fields := strings.Fields(strings.Trim(strings.TrimSpace(string(out)), "{}"))
+	if len(fields) == 0 {
+		return stats, fmt.Errorf("invalid vm.loadavg %q", out)
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return stats, err
+	}
+	stats.load = load / float64(runtime.NumCPU())
+
+	// The first sample from top is since boot, so use the second.
+	out, err = exec.Command("top", "-l", "2", "-n", "0", "-s", "1").Output()
+	if err != nil {
+		return stats, err
+	}
+	matches := topIdleRe.FindAllSubmatch(out, -1)
+	if len(matches) == 0 {
+		return stats, errors.New("no CPU usage found in top output")
+	}
+	idle, err := strconv.ParseFloat(string(matches[len(matches)-1][1]), 64)
+	if err != nil {
+		return stats, err
+	}
+	stats.cpu = 100 - idle
+	return stats, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type initCmd struct {
+	Dir string `arg:"positional" help:"the package directory to add benchmarks to" default:"."`
+}
+
+// runInit writes skeleton benchmarks for the exported functions and methods
+// in the package without benchmarks to a new gobench_test.go file.
+func (r runner) runInit() error {
+	dir := r.Init.Dir
+	filename := filepath.Join(dir, "gobench_test.go")
+	if _, err := os.Stat(filename); err == nil {
+		return fmt.Errorf("%s already exists", filename)
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+	if err != nil {
+		return err
+	}
+
+	var pkgName string
+	var funcs []string
+	existing := make(map[string]bool)
+	for name, pkg := range pkgs {
+		if strings.HasSuffix(name, "_test") {
+			continue
+		}
+		pkgName = name
+		for filename, f := range pkg.Files {
+			isTest := strings.HasSuffix(filename, "_test.go")
+			for _, decl := range f.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok {
+					continue
+				}
+				if isTest {
+					existing[fn.Name.Name] = true
+					continue
+				}
+				if name, ok := benchmarkTarget(fn); ok {
+					funcs = append(funcs, name)
+				}
+			}
+		}
+	}
+	if pkgName == "" {
+		return fmt.Errorf("no Go package found in %s", dir)
+	}
+
+	sort.Strings(funcs)
+	var missing []string
+	for _, name := range funcs {
+		if !hasBenchmark(existing, "Benchmark"+strings.Replace(name, ".", "_", 1)) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		fmt.Printf("All exported functions in %s have benchmarks.\n", dir)
+		return nil
+	}
+
+	src, err := benchmarkSkeletons(pkgName, missing)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filename, src, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d benchmarks to %s.\n", len(missing), filename)
+
+	return nil
+}
+
+// benchmarkTarget returns the name of fn, on the form Type.Method for
+// methods, if it's exported.
+func benchmarkTarget(fn *ast.FuncDecl) (string, bool) {
+	if !fn.Name.IsExported() {
+		return "", false
+	}
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name, true
+	}
+	typ := fn.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	id, ok := typ.(*ast.Ident)
+	if !ok || !id.IsExported() {
+		return "", false
+	}
+	return id.Name + "." + fn.Name.Name, true
+}
+
+// hasBenchmark reports whether name or a variant of it, e.g.
+// BenchmarkFoo_Parallel for BenchmarkFoo, exists. BenchmarkFooBar is a
+// benchmark of FooBar, not of Foo.
+func hasBenchmark(existing map[string]bool, name string) bool {
+	for fn := range existing {
+		if fn == name || strings.HasPrefix(fn, name+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// benchmarkSkeletons returns the formatted source of a test file with a
+// table driven benchmark for each of the given functions.
+func benchmarkSkeletons(pkgName string, funcs []string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s\n\nimport \"testing\"\n", pkgName)
+	for _, name := range funcs {
+		fmt.Fprintf(&buf, `
+func Benchmark%s(b *testing.B) {
+	benchmarks := []struct {
+		name string
+	}{
+		{name: "default"},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				// TODO: call %s.
+			}
+		})
+	}
+}
+`, strings.Replace(name, ".", "_", 1), name)
+	}
+	return format.Source(buf.Bytes())
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunInit(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"p.go": `package p
+
+func Foo()    {}
+func FooBar() {}
+func unexported() {}
+
+type T struct{}
+
+func (T) M()  {}
+func (*T) N() {}
+`,
+		"p_test.go": `package p
+
+import "testing"
+
+func BenchmarkFooBar(b *testing.B) {}
+func BenchmarkT_M_Parallel(b *testing.B) {}
+`,
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := runner{config: config{Init: &initCmd{Dir: dir}}}
+	var err error
+	out := captureOutput(func() { err = r.runInit() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContainsAll(t, out, "Wrote 2 benchmarks")
+
+	b, err := os.ReadFile(filepath.Join(dir, "gobench_test.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(b)
+	assertContainsAll(t, content, "package p\n", "func BenchmarkFoo(b *testing.B) {", "func BenchmarkT_N(b *testing.B) {", "// TODO: call T.N.")
+	assertNotContainsAll(t, content, "BenchmarkFooBar", "BenchmarkT_M", "unexported")
+
+	if err := r.runInit(); err == nil {
+		t.Fatal("expected an error for an existing gobench_test.go")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+)
+
+type inlineCmd struct {
+	NoOpt bool `arg:"--no-opt" help:"also compare with a build with all optimizations disabled (-gcflags=all=-l -N)"`
+}
+
+// buildVariant is a build of the current code with the given -gcflags.
+type buildVariant struct {
+	name    string
+	gcflags string
+}
+
+// runInline benchmarks the current code built normally and with inlining
+// disabled, and optionally with all optimizations disabled, and compares
+// the normal build with the rest.
+func (r runner) runInline() error {
+	variants := []buildVariant{
+		{name: "inline"},
+		{name: "noinline", gcflags: "all=-l"},
+	}
+	if r.Inline.NoOpt {
+		variants = append(variants, buildVariant{name: "noopt", gcflags: "all=-l -N"})
+	}
+
+	if r.Count == 0 {
+		r.Count = benchStatCountCompare
+	}
+	r.state = newRunState(r.config, variants[0].name, variants[len(variants)-1].name)
+
+	for _, variant := range variants {
+		if variant.gcflags == "" {
+			fmt.Printf("\nBenchmark %s build\n", variant.name)
+		} else {
+			fmt.Printf("\nBenchmark %s build: -gcflags=%q\n", variant.name, variant.gcflags)
+		}
+		vr := r
+		vr.gcflags = variant.gcflags
+		if err := vr.runBenchmark(goExe, variant.name, r.Count, nil); err != nil {
+			return err
+		}
+	}
+
+	// Make it stand out a little.
+	fmt.Print("\n\n")
+	for _, variant := range variants[1:] {
+		if err := r.runBenchStat(variants[0].name, variant.name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// instructionsUnit is the unit compared with --instructions.
+const instructionsUnit = "instructions/op"
+
+// instructionsExec returns the go test -exec value counting the
+// instructions retired by the test binary.
+func (c config) instructionsExec() string {
+	return fmt.Sprintf("perf stat -x , -e instructions -o '%s'", c.perfStatFilename())
+}
+
+// runInstructions runs the benchmarks with --instructions, see runCounted,
+// and writes their results to output with the instructions retired per op
+// added.
+func (r runner) runInstructions(exeName string, args, env []string, output, errOutput io.Writer) error {
+	// Instruction counts have no noise to speak of, so any change is significant.
+	if _, err := fmt.Fprintf(output, "Unit %s assume=exact\n", instructionsUnit); err != nil {
+		return err
+	}
+	return r.runCounted(exeName, args, env, r.InstructionsIterations, r.instructionsExec(), []string{"instructions"}, output, errOutput)
+}
+
+// runCounted runs each benchmark matching --bench in its own go test
+// invocation with a fixed number of iterations under the perf stat command
+// execCmd and writes its results to output with the given events per op
+// added. Benchmarks with sub-benchmarks are run again once per
+// sub-benchmark, as the events are counted for the whole invocation.
+// The go test arguments in args are used as is, apart from -bench.
+func (r runner) runCounted(exeName string, args, env []string, iterations int, execCmd string, events []string, output, errOutput io.Writer) error {
+	names, err := r.listBenchmarks(exeName, env)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no benchmarks matching %q found in %s", r.Bench, r.Package)
+	}
+
+	count := func(pattern string) (*bytes.Buffer, []benchValue, error) {
+		return r.countEvents(exeName, args, env, pattern, iterations, execCmd, events, output, errOutput)
+	}
+	for _, name := range names {
+		buf, counters, err := count(benchNamePattern(name))
+		if err != nil {
+			return err
+		}
+		subs := resultNames(buf.String())
+		if len(subs) < 2 {
+			if err := addCounters(output, buf, counters); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, sub := range subs {
+			buf, counters, err := count(benchNamePattern(sub))
+			if err != nil {
+				return err
+			}
+			if err := addCounters(output, buf, counters); err != nil {
+				return err
+			}
+		}
+	}
+
+	return os.Remove(r.perfStatFilename())
+}
+
+// countEvents runs the benchmarks matching the -bench pattern under the
+// perf stat command execCmd, returning their output and the totals of the
+// given events counted. The output is written to output on failure.
+func (r runner) countEvents(exeName string, args, env []string, pattern string, iterations int, execCmd string, events []string, output, errOutput io.Writer) (*bytes.Buffer, []benchValue, error) {
+	var buf bytes.Buffer
+	cmd := r.benchCommand(exeName, instructionsArgs(args, pattern, iterations, execCmd))
+	cmd.Dir = r.workDir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout = &buf
+	cmd.Stderr = errOutput
+
+	os.Remove(r.perfStatFilename())
+	if err := cmd.Run(); err != nil {
+		output.Write(buf.Bytes())
+		return nil, nil, err
+	}
+
+	f, err := os.Open(r.perfStatFilename())
+	if err != nil {
+		return nil, nil, err
+	}
+	counters, err := parsePerfStat(f)
+	f.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	var values []benchValue
+	for _, event := range events {
+		if v, found := counters[event]; found {
+			values = append(values, benchValue{Value: v, Unit: event})
+		}
+	}
+	if len(values) == 0 {
+		return nil, nil, fmt.Errorf("no %s count for %s in the perf stat output, check that perf has access to the hardware counters", strings.Join(events, " or "), pattern)
+	}
+	return &buf, values, nil
+}
+
+// resultNames returns the distinct benchmark names, without the GOMAXPROCS
+// suffix, of the result lines in output, in order.
+func resultNames(output string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		if res, ok := parseBenchResult(line); ok {
+			name := trimProcsSuffix(res.Name)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// benchNamePattern returns a -bench pattern matching exactly the benchmark
+// name, e.g. ^BenchmarkB$/^small$ for the sub-benchmark BenchmarkB/small.
+func benchNamePattern(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = "^" + regexp.QuoteMeta(part) + "$"
+	}
+	return strings.Join(parts, "/")
+}
+
+// instructionsArgs returns args running only the benchmarks matching the
+// -bench pattern with a fixed number of iterations under the given -exec
+// command.
+func instructionsArgs(args []string, pattern string, iterations int, execCmd string) []string {
+	out := []string{args[0],
+		fmt.Sprintf("-benchtime=%dx", iterations),
+		"-exec", execCmd,
+	}
+	for i := 1; i < len(args); i++ {
+		out = append(out, args[i])
+		if args[i] == "-bench" && i+1 < len(args) {
+			out = append(out, pattern)
+			i++
+		}
+	}
+	return out
+}
+
+// addCounters copies the go test output in r to w, adding the counters per
+// op, e.g. instructions/op, to each result line. The counters are for the
+// whole test binary process, so they are shared evenly between the
+// results of the -count runs.
+func addCounters(w io.Writer, r io.Reader, counters []benchValue) error {
+	var lines []string
+	var ops int
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if res, ok := parseBenchResult(line); ok {
+			ops += res.Iterations
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		if res, ok := parseBenchResult(line); ok {
+			for _, c := range counters {
+				res.Values = append(res.Values, benchValue{Value: c.Value / float64(ops), Unit: c.Unit + "/op"})
+			}
+			line = res.String()
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listBenchmarks returns the top level benchmarks in --package matching --bench.
+func (r runner) listBenchmarks(exeName string, env []string) ([]string, error) {
+	args := []string{"test", "-list", r.Bench}
+	if r.Tags != "" {
+		args = append(args, "-tags", r.Tags)
+	}
+	cmd := commandContext(r.context(), exeName, append(args, r.Package)...)
+	cmd.Dir = r.workDir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list benchmarks: %s: %s", err, output)
+	}
+
+	var names []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "Benchmark") && !strings.ContainsAny(line, " \t") {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInstructionsArgs(t *testing.T) {
+	got := instructionsArgs([]string{"test", "-run", "NONE", "-bench", "Bench*", "-count=2", "./b"}, benchNamePattern("BenchmarkB"), 100, "perf")
+	expected := []string{"test", "-benchtime=100x", "-exec", "perf", "-run", "NONE", "-bench", "^BenchmarkB$", "-count=2", "./b"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestResultNames(t *testing.T) {
+	names := resultNames("pkg: example.com/b\nBenchmarkB/small-4\t100\t10.0 ns/op\nBenchmarkB/large-4\t100\t30.0 ns/op\nBenchmarkB/small-4\t100\t11.0 ns/op\nPASS\n")
+	if !reflect.DeepEqual(names, []string{"BenchmarkB/small", "BenchmarkB/large"}) {
+		t.Fatalf("got %v", names)
+	}
+	if got := benchNamePattern("BenchmarkB/size=1.5"); got != `^BenchmarkB$/^size=1\.5$` {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestAddCounters(t *testing.T) {
+	var sb strings.Builder
+	err := addCounters(&sb, strings.NewReader(`pkg: example.com/b
+BenchmarkB/small-4	100	10.0 ns/op
+BenchmarkB/large-4	100	30.0 ns/op
+PASS
+`), []benchValue{{Value: 4000, Unit: "instructions"}, {Value: 8000, Unit: "cycles"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `pkg: example.com/b
+BenchmarkB/small-4	100	10 ns/op	20 instructions/op	40 cycles/op
+BenchmarkB/large-4	100	30 ns/op	20 instructions/op	40 cycles/op
+PASS
+`
+	if got := sb.String(); got != expected {
+		t.Fatalf("got %q", got)
+	}
+}
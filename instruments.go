@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// xctraceTemplates maps the --xctrace values to Instruments templates.
+var xctraceTemplates = map[string]string{
+	"time-profiler": "Time Profiler",
+	"allocations":   "Allocations",
+}
+
+// runInstruments compiles the benchmark binary for the current code, records
+// a run of it with xctrace using the --xctrace template and opens the trace
+// in Instruments. macOS only.
+func (r runner) runInstruments() error {
+	if runtime.GOOS != "darwin" {
+		return errors.New("--xctrace requires macOS")
+	}
+	if len(r.packageArgs()) != 1 {
+		return fmt.Errorf("--xctrace requires a single package, got %d", len(r.packageArgs()))
+	}
+
+	name := r.normalizeName(r.currentBranch)
+	binary := filepath.Join(r.OutDir, name+".test")
+	trace := filepath.Join(r.OutDir, name+".trace")
+
+	if err := r.compileTestBinary(binary); err != nil {
+		return err
+	}
+
+	// Instruments refuses to overwrite an existing trace.
+	if err := os.RemoveAll(trace); err != nil {
+		return err
+	}
+
+	fmt.Printf("Record %s trace to %s\n", xctraceTemplates[r.Xctrace], trace)
+	cmd := exec.Command("xcrun", "xctrace", "record",
+		"--template", xctraceTemplates[r.Xctrace],
+		"--output", trace,
+		"--launch", "--", binary, "-test.run", "NONE", "-test.bench", r.Bench, "-test.benchmem")
+	cmd.Dir = r.workDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("xctrace failed: %s", err)
+	}
+
+	return exec.Command("open", trace).Run()
+}
+
+// compileTestBinary compiles the test binary for the single package to
+// benchmark, e.g. the one affected package with --affected, to binary.
+func (r runner) compileTestBinary(binary string) error {
+	args := []string{"test", "-c", "-o", binary}
+	if r.Tags != "" {
+		args = append(args, "-tags", r.Tags)
+	}
+	args = append(args, r.packageArgs()[0])
+	cmd := exec.Command(goExe, args...)
+	cmd.Dir = r.workDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to compile the test binary: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes s as a JUnit XML report to filename, with one test case
+// per benchmark and threshold violations as failures.
+func writeJUnit(filename string, s *summary) error {
+	suite := junitTestSuite{Name: fmt.Sprintf("gobench %s vs %s", s.Base, s.Current)}
+
+	violations := make(map[string][]comparison)
+	for _, c := range s.Violations {
+		violations[c.Name] = append(violations[c.Name], c)
+	}
+
+	var (
+		names []string
+		lines = make(map[string][]string)
+	)
+	for _, c := range s.Comparisons {
+		if _, found := lines[c.Name]; !found {
+			names = append(names, c.Name)
+		}
+		lines[c.Name] = append(lines[c.Name], formatComparison(c))
+	}
+
+	for _, name := range names {
+		tc := junitTestCase{
+			Name:      name,
+			ClassName: "gobench",
+			SystemOut: strings.Join(lines[name], "\n"),
+		}
+		if vs := violations[name]; len(vs) > 0 {
+			var msgs []string
+			for _, c := range vs {
+				msgs = append(msgs, fmt.Sprintf("%s %+.2f%%", c.Unit, c.Delta))
+			}
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("regressed more than %g%%: %s", s.Threshold, strings.Join(msgs, ", ")),
+				Text:    tc.SystemOut,
+			}
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Tests = len(suite.TestCases)
+
+	b, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append([]byte(xml.Header), b...), 0o644)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// failedPackageRe matches the go test lines for failed packages, e.g.
+// "FAIL	example.com/foo [build failed]" or "FAIL	example.com/foo	0.010s".
+var failedPackageRe = regexp.MustCompile(`(?m)^FAIL\s+(\S+)`)
+
+// failedPackages returns the packages reported as failed in go test output.
+func failedPackages(output string) []string {
+	var packages []string
+	for _, m := range failedPackageRe.FindAllStringSubmatch(output, -1) {
+		if !contains(packages, m[1]) {
+			packages = append(packages, m[1])
+		}
+	}
+	return packages
+}
+
+// listPackages resolves the package patterns to benchmark to import paths,
+// so failed packages can be left out of later runs with --keep-going and
+// the packages split into groups with --parallel.
+func (r runner) listPackages(exeName string, env []string) ([]string, error) {
+	args := []string{"list"}
+	if r.Tags != "" {
+		args = append(args, "-tags", r.Tags)
+	}
+	cmd := exec.Command(exeName, append(args, r.packageArgs()...)...)
+	cmd.Dir = r.workDir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages: %s", err)
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// readFrom returns the content of the file from offset.
+func readFrom(filename string, offset int64) (string, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	return string(b[offset:]), nil
+}
+
+// without returns the elements in list not in remove.
+func without(list, remove []string) []string {
+	var kept []string
+	for _, v := range list {
+		if !contains(remove, v) {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// keepGoingError returns an error listing the packages that failed and were
+// skipped with --keep-going, nil if none.
+func (r runner) keepGoingError() error {
+	var failed []string
+	for _, name := range []string{r.state.First, r.state.Second} {
+		for _, pkg := range r.state.FailedPackages[name] {
+			failed = append(failed, fmt.Sprintf("%s (%s)", pkg, name))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d packages failed:\n  %s", len(failed), strings.Join(failed, "\n  "))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// hardwareKeys are the benchmark configuration keys that describe the machine
+// the benchmarks ran on.
+var hardwareKeys = []string{"goos", "goarch", "cpu"}
+
+// hardwareMismatches returns a description of each hardware configuration
+// value that differs between the two files.
+func hardwareMismatches(bf1, bf2 *benchFile) []string {
+	var mismatches []string
+	for _, key := range hardwareKeys {
+		v1, v2 := bf1.Config[key], bf2.Config[key]
+		if v1 != v2 {
+			mismatches = append(mismatches, fmt.Sprintf("%s: %q vs %q", key, v1, v2))
+		}
+	}
+	return mismatches
+}
+
+// isTimeUnit reports whether unit is a time per operation unit that's affected
+// by the speed of the machine.
+func isTimeUnit(unit string) bool {
+	return unit == "ns/op" || unit == "sec/op"
+}
+
+// normalize scales the time values in bf2 so that the calibration benchmark
+// in bf2 matches the one in bf1. It returns the factor used.
+func normalize(bf1, bf2 *benchFile, calibration string) (float64, error) {
+	name1, ok := findBenchmark(bf1, calibration)
+	if !ok {
+		return 0, fmt.Errorf("calibration benchmark %q not found in base results", calibration)
+	}
+	name2, ok := findBenchmark(bf2, calibration)
+	if !ok {
+		return 0, fmt.Errorf("calibration benchmark %q not found in current results", calibration)
+	}
+	v1, ok1 := bf1.mean(name1, "ns/op")
+	v2, ok2 := bf2.mean(name2, "ns/op")
+	if !ok1 || !ok2 || v2 == 0 {
+		return 0, fmt.Errorf("calibration benchmark %q has no ns/op values", calibration)
+	}
+
+	factor := v1 / v2
+	for _, r := range bf2.Results {
+		for i, v := range r.Values {
+			if isTimeUnit(v.Unit) {
+				r.Values[i].Value = v.Value * factor
+			}
+		}
+	}
+
+	return factor, nil
+}
+
+// findBenchmark finds the full name of the benchmark with the given name,
+// ignoring the Benchmark prefix and the -N GOMAXPROCS suffix.
+func findBenchmark(bf *benchFile, name string) (string, bool) {
+	name = strings.TrimPrefix(name, "Benchmark")
+	for _, r := range bf.Results {
+		n := strings.TrimPrefix(r.Name, "Benchmark")
+		if n == name || trimProcsSuffix(n) == name {
+			return r.Name, true
+		}
+	}
+	return "", false
+}
+
+// trimProcsSuffix removes the -N GOMAXPROCS suffix from a benchmark name.
+func trimProcsSuffix(name string) string {
+	i := strings.LastIndex(name, "-")
+	if i == -1 {
+		return name
+	}
+	for _, r := range name[i+1:] {
+		if r < '0' || r > '9' {
+			return name
+		}
+	}
+	if i == len(name)-1 {
+		return name
+	}
+	return name[:i]
+}
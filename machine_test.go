@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	bf1, _ := parseBenchFile(strings.NewReader(`cpu: A
+BenchmarkCalibrate-4	10	100 ns/op
+BenchmarkFoo-4	10	1000 ns/op	16 B/op
+`))
+	bf2, _ := parseBenchFile(strings.NewReader(`cpu: B
+BenchmarkCalibrate-8	10	50 ns/op
+BenchmarkFoo-8	10	600 ns/op	16 B/op
+`))
+
+	if mismatches := hardwareMismatches(bf1, bf2); len(mismatches) != 1 {
+		t.Fatalf("expected 1 mismatch, got %v", mismatches)
+	}
+
+	factor, err := normalize(bf1, bf2, "Calibrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if factor != 2 {
+		t.Fatalf("got factor %v", factor)
+	}
+	if v, _ := bf2.mean("BenchmarkFoo-8", "ns/op"); v != 1200 {
+		t.Fatalf("got ns/op %v", v)
+	}
+	if v, _ := bf2.mean("BenchmarkFoo-8", "B/op"); v != 16 {
+		t.Fatalf("got B/op %v", v)
+	}
+
+	if _, err := normalize(bf1, bf2, "BenchmarkMissing"); err == nil {
+		t.Fatal("expected error")
+	}
+}
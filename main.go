@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -8,7 +10,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"time"
 
 	arg "github.com/alexflint/go-arg"
 )
@@ -24,149 +28,1363 @@ var goExe = "go"
 
 func init() {
 	if exe := os.Getenv("GOEXE"); exe != "" {
-		goExe = exe
+		goExe = withExeSuffix(exe)
 	}
 }
 
 type config struct {
-	Bench           string `help:"run only those benchmarks matching a regular expression"`
-	Count           int    `help:"run benchmark count times"`
-	Package         string `arg:"" help:"package to test (e.g. ./lib)" default:"."`
-	Base            string `help:"Git version (tag, branch etc.) to compare with. Leave empty to run on current branch only."`
-	BaseGoExe       string `help:"The Go binary to use for the first run."`
-	NoStash         bool   `help:"Don't stash uncommited changes (just run the benchmark against the current code)."`
-	Tags            string `help:"Build -tags"`
-	Race            bool   `help:"Run with -race flag"`
-	IncludeRuntime  bool   `help:"Include runtime in the profile."`
-	Cpu             string `help:"a comma separated list of CPU counts, e.g. -cpu 1,2,3,4"`
-	ProfType        string `help:"write a profile of the given type and run pprof; valid types are 'cpu', 'mem', 'block'."`
-	ProfCallgrind   bool   `help:"write a cpu profile and callgrind data and run qcachegrind"`
-	ProfSampleIndex string `help:"pprof sample index"`
+	Bench              string        `help:"run only those benchmarks matching a regular expression"`
+	Count              int           `help:"run benchmark count times"`
+	Command            string        `help:"run this shell command for each ref instead of go test, e.g. a wrk or hyperfine wrapper, and compare its results. It must print them in the Go benchmark format and is run in the checkout with GOBENCH_REF, GOBENCH_COUNT and GOBENCH_BENCH set"`
+	Set                string        `help:"use the named set of benchmarks in the config file, e.g. smoke, for the --bench, --package, --count and --budget not given"`
+	CountBase          int           `arg:"--count-base" help:"run the base benchmark count times, defaults to --count"`
+	CountCurrent       int           `arg:"--count-current" help:"run the current benchmark count times, defaults to --count"`
+	Alternate          int           `help:"run the counts in chunks of this size, alternating between the base and the current ref, with the base in a git worktree"`
+	Sparse             bool          `help:"limit the git worktrees for other refs (see --alternate and --parallel-build) to a sparse-checkout cone of the benchmarked packages and their dependencies in the repository"`
+	Package            string        `arg:"" help:"package to test (e.g. ./lib)" default:"."`
+	Base               string        `help:"Git version (tag, branch etc.) to compare with. Leave empty to run on current branch only."`
+	BaseGoExe          string        `help:"The Go binary to use for the first run."`
+	Fetch              string        `help:"whether to fetch --base from --fetch-remote if it's missing, and deepen shallow clones until the merge base of it and HEAD is found: auto or never, e.g. in air-gapped environments" default:"auto"`
+	FetchRemote        string        `arg:"--fetch-remote" help:"the git remote to fetch missing refs from" default:"origin"`
+	FetchDepth         int           `arg:"--fetch-depth" help:"in shallow clones, the number of commits to fetch and to deepen by" default:"50"`
+	BaseFile           string        `help:"existing .bench file (e.g. produced on another machine) to compare with instead of running the base. Multiple files (comma separated or glob) are merged. May be an HTTP(S) URL, e.g. of the latest results on main in CI"`
+	BaseFromServer     string        `arg:"--base-from-server" help:"compare with the results for this branch, optionally with @commit, stored on the --server instead of running the base, e.g. main or main@1a2b3c4"`
+	Server             string        `arg:"--server,env:GOBENCH_SERVER" help:"URL of the baseline server to store results on with gobench push and read them from with --base-from-server"`
+	ServerToken        string        `arg:"--server-token,env:GOBENCH_SERVER_TOKEN" help:"bearer token for the --server"`
+	SignKey            string        `arg:"--sign-key" help:"sign the result files with this private key, writing a .sig file next to each. With gobench push, a manifest of the results for the branch and commit is signed instead"`
+	VerifyKey          string        `arg:"--verify-key" help:"require the --basefile URLs and --base-from-server results to be signed by a key in this file, an ssh allowed signers file or a minisign public key"`
+	SignTool           string        `arg:"--sign-tool" help:"the tool to sign and verify results with: ssh (ssh-keygen -Y) or minisign" default:"ssh"`
+	BaseFileSHA256     string        `arg:"--basefile-sha256" help:"the SHA-256 checksum of the --basefile URL to verify the download with. Defaults to the checksum in <url>.sha256 if found"`
+	RequireChecksum    bool          `arg:"--require-checksum" help:"fail if there is no checksum to verify a --basefile URL with, rather than warn"`
+	Env                []string      `arg:"--env,separate" help:"environment variable (KEY=VAL) to set for all benchmark runs, can be repeated"`
+	EnvBase            []string      `arg:"--env-base,separate" help:"environment variable (KEY=VAL) to set for the base run only, can be repeated"`
+	EnvCurrent         []string      `arg:"--env-current,separate" help:"environment variable (KEY=VAL) to set for the current run only, can be repeated"`
+	Shard              string        `help:"run only shard index of total of the benchmarks, e.g. 2/5, partitioned by a hash of their names, for running them in parallel CI jobs. The benchmarks are listed from the current code only, so the removed ones aren't run. The shard metadata is written to shard.json in --outdir, see gobench merge"`
+	Budget             time.Duration `help:"total time budget for the benchmark runs, e.g. 20m. A calibration run estimates the cost of each benchmark, and the counts per benchmark are chosen to make them as even (up to 30) as the budget allows. Overrides the counts in the config file"`
+	MaxDuration        time.Duration `arg:"--max-duration" help:"max total duration of the benchmark runs, e.g. 30m. When reached, the remaining runs are skipped and the report is based on the results so far."`
+	Retries            int           `help:"number of times to retry a failing go test run before giving up."`
+	KeepGoing          bool          `arg:"--keep-going" help:"when benchmarking multiple packages, keep going without the packages that fail to build or whose benchmarks fail, list them at the end and exit non-zero"`
+	Verify             bool          `help:"run the tests of the current code with go test -count=1 before benchmarking, and abort if they fail"`
+	Preflight          bool          `help:"build the test binaries for both refs in parallel before the timed runs, which fails the run right away if either doesn't compile. The base is built in a git worktree, which doesn't warm the build cache for its measured run, so this adds to the total time"`
+	ParallelBuild      bool          `arg:"--parallel-build" help:"build the base and current test binaries concurrently, the base in a git worktree, before running the benchmarks for both back-to-back"`
+	Parallel           int           `help:"on Linux, build and benchmark up to this many groups of packages concurrently, each pinned to its own disjoint set of CPUs with taskset. Runs with --perf-stat, --instructions or --cachegrind are still sequential"`
+	OnThrottle         string        `arg:"--on-throttle" help:"what to do with go test runs where thermal throttling of the CPU was detected (Linux and macOS): warn, retry (up to --retries times) or discard the results and run again" default:"warn"`
+	Resume             bool          `help:"resume an interrupted run using the state stored in --outdir."`
+	Merge              bool          `help:"append to existing result files in --outdir, merging the results with those from previous sessions."`
+	NormalizeNames     bool          `arg:"--normalize-names" help:"strip the -N GOMAXPROCS suffix from the benchmark names before comparing, so the results pair up when the base and current ran with different core counts. See also names in the config file."`
+	Renames            string        `help:"file with lines on the form 'BenchmarkOld => BenchmarkNew' mapping renamed benchmarks in the base to their current names before comparing"`
+	Normalize          string        `help:"name of a calibration benchmark present in both result sets; time values of the current run are scaled relative to it."`
+	HistoryWindow      int           `arg:"--history-window" help:"compare with the median of the results stored as git notes for the last N commits on --history-branch instead of running the base"`
+	HistoryBranch      string        `arg:"--history-branch" help:"the branch to read the result history from" default:"main"`
+	Affected           bool          `help:"only benchmark the packages with changes compared to the base, or with dependencies with changes"`
+	CallGraph          bool          `arg:"--callgraph" help:"with --affected, only run the benchmarks matching --bench that can reach changed code in a name based reference graph of the module. All benchmarks of the affected packages are run if methods or non-Go files changed, as calls through interfaces and changed dependencies can't be followed"`
+	Dirty              string        `help:"how to compare uncommitted changes with HEAD: stash (stash them while benchmarking HEAD in the working directory) or copy (benchmark a snapshot of them and HEAD in temporary git worktrees, leaving the working directory alone)" default:"stash"`
+	NoStash            bool          `help:"Don't stash uncommited changes (just run the benchmark against the current code)."`
+	Reproducible       bool          `help:"record and pin the module environment (GOFLAGS, GOPROXY etc.) and refuse to run if go.mod or go.sum differ between the refs"`
+	Mod                string        `help:"passed to go test as -mod (mod, vendor or readonly). -mod=vendor falls back to -mod=mod for refs without a vendor directory."`
+	Tags               string        `help:"Build -tags"`
+	Deterministic      bool          `help:"build with -trimpath and an empty build ID, so builds are stable across checkouts in different directories"`
+	Race               bool          `help:"Run with -race flag"`
+	IncludeRuntime     bool          `help:"Include runtime in the profile."`
+	Cpu                string        `help:"a comma separated list of CPU counts, e.g. -cpu 1,2,3,4"`
+	Cores              string        `help:"on macOS, steer the benchmark processes onto the performance or efficiency cores with taskpolicy: performance or efficiency. Recorded as cores in the results"`
+	RequireAC          bool          `arg:"--require-ac" help:"refuse to run on battery, in a low power mode or with a power saving CPU frequency setting, e.g. the powersave governor of acpi-cpufreq or the power energy performance preference of intel_pstate, instead of printing a warning"`
+	LockWait           time.Duration `arg:"--lock-wait" help:"how long to wait for another gobench running in the same repository to finish, e.g. 10m. Fails right away by default"`
+	LockEnv            bool          `arg:"--lock-env" help:"lock the machine for benchmarking as with gobench env lock for the duration of the run, and restore the settings afterwards"`
+	WaitIdle           bool          `arg:"--wait-idle" help:"wait until the system is idle (see --idle-load and --idle-cpu) before starting the benchmarks"`
+	NoUpdateCheck      bool          `arg:"--no-update-check,env:GOBENCH_NO_UPDATE_CHECK" help:"don't check for a new gobench release on startup (at most once a day, never in CI or when stdout isn't a terminal)"`
+	IdleLoad           float64       `arg:"--idle-load" help:"with --wait-idle, the max 1 minute load average per CPU" default:"0.5"`
+	IdleCPU            float64       `arg:"--idle-cpu" help:"with --wait-idle, the max CPU utilization in percent" default:"10"`
+	IdleTimeout        time.Duration `arg:"--idle-timeout" help:"with --wait-idle, the max time to wait before starting anyway" default:"10m"`
+	ProfType           string        `help:"write a profile of the given type and run pprof; valid types are 'cpu', 'mem', 'block'. With mem and no --profsampleindex, top reports for both alloc_objects and inuse_space are written to --outdir."`
+	ProfCallgrind      bool          `help:"write a cpu profile and callgrind data and run qcachegrind"`
+	ProfSampleIndex    string        `help:"pprof sample index"`
+	Open               bool          `help:"when the run completes, open the HTML report (with --format html) or, with --profType, the pprof web UI in the default browser"`
+	Xctrace            string        `help:"on macOS, record a trace of the current code's benchmarks with Instruments using the given template: time-profiler or allocations, and open it"`
+	ETW                string        `arg:"--etw" help:"on Windows, capture an ETW trace of the current code's benchmarks with wpr using the given profile: cpu, heap or general, and open it in WPA. Requires an elevated prompt"`
+	PerfStat           bool          `arg:"--perf-stat" help:"run the test binaries under perf stat (Linux) and compare the cycles, instructions, branch-misses and cache-misses per op. Each benchmark runs in its own go test invocation with a fixed number of iterations, the counters are for the whole process divided by the ops"`
+	PerfStatIterations int           `arg:"--perf-stat-iterations" help:"the fixed number of iterations per benchmark with --perf-stat" default:"1000"`
+
+	Instructions           bool   `help:"compare the instructions retired per op, counted with perf stat (Linux), instead of timings. Each benchmark runs in its own go test invocation with a fixed number of iterations. Instruction counts are nearly deterministic, so this is useful for gating on noisy shared CI runners"`
+	InstructionsIterations int    `arg:"--instructions-iterations" help:"the fixed number of iterations per benchmark with --instructions" default:"1000"`
+	Cachegrind             bool   `help:"run the test binaries under valgrind --tool=cachegrind with a fixed number of iterations, merge the results for all test binaries with cg_merge and show the difference in the simulated cache and branch behaviour between the base and current code with cg_diff and cg_annotate"`
+	CachegrindIterations   int    `arg:"--cachegrind-iterations" help:"the fixed number of iterations per benchmark with --cachegrind" default:"100"`
+	BCE                    bool   `arg:"--bce" help:"build the packages with the compiler's bounds check diagnostics (-d=ssa/check_bce/debug=1) and list the bounds checks added and removed between the base and current code"`
+	Distribution           bool   `help:"print the percentiles and a histogram of the count runs per benchmark, and write all samples to distributions.json in --outdir. Means hide bimodal behaviour, e.g. from GC or contention"`
+	Plots                  bool   `help:"show box plots of the spread of the count runs for the base and the current code next to the comparison, in the text and markdown formats"`
+	Charts                 string `help:"directory to write an SVG bar chart per benchmark and unit to, with the range of the count runs as error bars, e.g. for embedding in docs and pull requests"`
 
 	OutDir string `help:"directory to write files to. Defaults to a temp dir."`
+
+	Generate        bool   `help:"run go generate ./... (or --generate-command) for each ref before benchmarking"`
+	GenerateCommand string `arg:"--generate-command" help:"shell command to run instead of go generate ./... when --generate is set"`
+
+	Format         string  `help:"the report format: text (benchstat), markdown, html, json, tap or teamcity" default:"text"`
+	Collapse       bool    `help:"only list the geomean per parent benchmark for sub-benchmarks in the markdown report"`
+	Threshold      float64 `help:"max allowed regression in percent; significant regressions above it are violations and make gobench exit with a non-zero status"`
+	PowerDelta     percent `arg:"--power-delta" help:"report the count needed per benchmark to detect a change of this size, e.g. 2%, estimated from the variance in the results, and suggest one for the next run"`
+	NoiseFloor     percent `arg:"--noise-floor" help:"min change to report, e.g. 2%; smaller changes are shown as ~ in the reports, listed below the benchstat output in the text format, and never violate the threshold, whatever their significance"`
+	Metrics        string  `help:"comma separated list of metrics to report and check the threshold for: time, bytes, allocs or any other unit, e.g. MB/s. Defaults to all."`
+	HigherIsBetter string  `arg:"--higher-is-better" help:"comma separated list of custom units (see b.ReportMetric) where higher values are better, e.g. requests/sec,cache-hits/op. Units ending in /s are by default. Overrides unit metadata in the results and the config file."`
+	FailOnRemoved  bool    `arg:"--fail-on-removed" help:"fail if benchmarks in the base are missing in the current results"`
+	Unmatched      string  `help:"how to handle benchmarks only found in the base or the current results, which are always listed as removed and added: keep (pass them on to benchstat), exclude (leave them out of the benchstat output and its geomeans) or fail (exclude, and fail as with --fail-on-removed)" default:"keep"`
+	Gate           string  `help:"which metrics can fail the run: all, or allocs to only check B/op and allocs/op against the threshold and report timing changes as informational" default:"all"`
+
+	JUnit     string `arg:"--junit" help:"write a JUnit XML report to this file, with threshold violations as failures"`
+	Badge     string `help:"write a badge summarizing the comparison to this file, as SVG if it ends with .svg, else as shields.io endpoint JSON"`
+	Buildkite bool   `help:"create a Buildkite annotation with the markdown report using buildkite-agent"`
+	Azure     bool   `help:"print Azure Pipelines logging commands for regressions and attach the markdown report to the build summary"`
+
+	Bitbucket      bool   `help:"attach the comparison to the commit as a Bitbucket Code Insights report and post the markdown report as a comment on --bitbucket-pr"`
+	BitbucketURL   string `arg:"--bitbucket-url" help:"the Bitbucket API URL, the Bitbucket Server or Data Center URL if not Bitbucket Cloud" default:"https://api.bitbucket.org"`
+	BitbucketRepo  string `arg:"--bitbucket-repo" help:"the repository as workspace/repo (Cloud) or PROJECT/repo (Server), defaults to BITBUCKET_REPO_FULL_NAME"`
+	BitbucketPR    string `arg:"--bitbucket-pr" help:"the pull request ID to comment on, defaults to BITBUCKET_PR_ID"`
+	BitbucketToken string `arg:"--bitbucket-token,env:GOBENCH_BITBUCKET_TOKEN" help:"the Bitbucket access token"`
+
+	GerritURL      string `arg:"--gerrit-url" help:"Gerrit server URL to post the comparison to as a review comment on --gerrit-change, e.g. https://gerrit.example.com"`
+	GerritChange   string `arg:"--gerrit-change" help:"the Gerrit change to review, defaults to GERRIT_CHANGE_NUMBER"`
+	GerritRevision string `arg:"--gerrit-revision" help:"the Gerrit revision to review, defaults to GERRIT_PATCHSET_REVISION or the current revision"`
+	GerritLabel    string `arg:"--gerrit-label" help:"label to vote on, -1 for threshold violations and +1 otherwise, e.g. Perf-Review"`
+	GerritUser     string `arg:"--gerrit-user" help:"the Gerrit user name"`
+	GerritPassword string `arg:"--gerrit-password,env:GOBENCH_GERRIT_PASSWORD" help:"the Gerrit HTTP password"`
+
+	PushBranch string `arg:"--push-branch" help:"commit the results, HTML report and a JSON history file to this git branch, e.g. gh-pages"`
+	PushDir    string `arg:"--push-dir" help:"the directory in --push-branch to store the results in" default:"benchmarks"`
+	PushRemote string `arg:"--push-remote" help:"push --push-branch to this remote, e.g. origin"`
+
+	GitNotes bool `arg:"--git-notes" help:"attach the results to the current commit as a git note in refs/notes/benchmarks"`
+
+	NotifySlack string `arg:"--notify-slack" help:"Slack webhook URL to post a summary to when the run completes"`
+	NotifyURL   string `arg:"--notify-url" help:"URL to POST the JSON result summary to when the run completes"`
+	NotifyOn    string `arg:"--notify-on" help:"when to notify: always or violation" default:"always"`
+
+	NotifyDesktop time.Duration `arg:"--notify-desktop" help:"send a desktop notification with the result when a run taking longer than this finishes, e.g. 10m, so you can do something else meanwhile"`
+
+	EmailTo      string `arg:"--email-to" help:"comma separated list of email addresses to send the report to"`
+	EmailFrom    string `arg:"--email-from" help:"the sender address of the report email"`
+	EmailFormat  string `arg:"--email-format" help:"the report email format: text or html" default:"text"`
+	SMTPAddr     string `arg:"--smtp-addr" help:"the SMTP server to send the report email with, e.g. smtp.example.com:587"`
+	SMTPUser     string `arg:"--smtp-user" help:"the SMTP user name"`
+	SMTPPassword string `arg:"--smtp-password,env:GOBENCH_SMTP_PASSWORD" help:"the SMTP password"`
+
+	PreCheckout  string `arg:"--pre-checkout" help:"shell command to run before each git checkout"`
+	PostCheckout string `arg:"--post-checkout" help:"shell command to run after each git checkout"`
+	PreRun       string `arg:"--pre-run" help:"shell command to run before benchmarking each ref"`
+	PostRun      string `arg:"--post-run" help:"shell command to run after benchmarking each ref, also on failure"`
+
+	Config string `help:"JSON config file with settings not available as flags, e.g. unit semantics. Defaults to gobench.json if it exists."`
+
+	Compare    *compareCmd    `arg:"subcommand:compare" help:"compare existing .bench files without running any benchmarks"`
+	Report     *reportCmd     `arg:"subcommand:report" help:"regenerate the report for a previous run from the results in its --outdir, e.g. in another --format"`
+	Push       *pushCmd       `arg:"subcommand:push" help:"store the current results of a previous run on the --server, for use as the baseline with --base-from-server"`
+	MergeCmd   *mergeCmd      `arg:"subcommand:merge" help:"merge the results of the shards of a run with --shard, or of partial runs, and report the comparison"`
+	History    *historyCmd    `arg:"subcommand:history" help:"list and compare the results stored as git notes"`
+	Dep        *depCmd        `arg:"subcommand:dep" help:"benchmark the current code against different versions of a dependency"`
+	Replace    *replaceCmd    `arg:"subcommand:replace" help:"benchmark the current code with and without a replace directive for a dependency"`
+	GODEBUG    *godebugCmd    `arg:"subcommand:godebug" help:"benchmark the current code with different GODEBUG settings"`
+	Inline     *inlineCmd     `arg:"subcommand:inline" help:"benchmark the current code built normally and with inlining disabled"`
+	Init       *initCmd       `arg:"subcommand:init" help:"write skeleton benchmarks for the exported functions and methods in a package without benchmarks"`
+	EnvCmd     *envCmd        `arg:"subcommand:env" help:"lock the machine for benchmarking (CPU frequency governor and turbo boost) and unlock it again"`
+	SelfUpdate *selfUpdateCmd `arg:"subcommand:self-update" help:"update gobench to the latest release"`
+	Doctor     *doctorCmd     `arg:"subcommand:doctor" help:"check that the tools gobench depends on are available"`
+
+	// Settings from the config file.
+	file fileConfig
+
+	// The -gcflags to build with, set per build variant.
+	gcflags string
+
+	// tempOutDir is set if --outdir was not set and the results are
+	// written to a temp dir, so the run can't be resumed.
+	tempOutDir bool
 }
 
+// defaultBench is the default --bench pattern.
+const defaultBench = "Bench*"
+
 // Number of runs when comparing branches (if not set).
 const benchStatCountCompare = 4
 
-func main() {
-	var cfg config
+func main() {
+	var cfg config
+
+	// Defaults
+	cfg.Bench = defaultBench
+
+	p := arg.MustParse(&cfg)
+
+	if cfg.ProfType != "" {
+		if cfg.ProfType != "mem" && cfg.ProfType != "cpu" && cfg.ProfType != "block" {
+			p.Fail(fmt.Sprintf("invalid profile type %q. Must be one of %v", cfg.ProfType, []string{"mem", "cpu", "block"}))
+		}
+	}
+
+	if cfg.Mod != "" && !contains(validModFlags, cfg.Mod) {
+		p.Fail(fmt.Sprintf("invalid --mod %q. Must be one of %v", cfg.Mod, validModFlags))
+	}
+
+	if cfg.NotifyOn != "always" && cfg.NotifyOn != "violation" {
+		p.Fail(fmt.Sprintf("invalid --notify-on %q. Must be one of %v", cfg.NotifyOn, []string{"always", "violation"}))
+	}
+
+	if !contains(gateModes, cfg.Gate) {
+		p.Fail(fmt.Sprintf("invalid --gate %q. Must be one of %v", cfg.Gate, gateModes))
+	}
+
+	if !contains(reportFormats, cfg.Format) {
+		p.Fail(fmt.Sprintf("invalid --format %q. Must be one of %v", cfg.Format, reportFormats))
+	}
+
+	if cfg.EmailTo != "" && (cfg.EmailFrom == "" || cfg.SMTPAddr == "") {
+		p.Fail("--email-to requires --email-from and --smtp-addr")
+	}
+
+	if cfg.Open && cfg.Format != "html" && cfg.ProfType == "" {
+		p.Fail("--open requires --format html or --profType")
+	}
+
+	if cfg.EmailFormat != "text" && cfg.EmailFormat != "html" {
+		p.Fail(fmt.Sprintf("invalid --email-format %q. Must be one of %v", cfg.EmailFormat, []string{"text", "html"}))
+	}
+
+	if cfg.BaseFile != "" && cfg.Base != "" {
+		p.Fail("--basefile and --base can not be used together")
+	}
+
+	if cfg.BaseFileSHA256 != "" {
+		var urls int
+		for _, s := range strings.Split(cfg.BaseFile, ",") {
+			if isURL(strings.TrimSpace(s)) {
+				urls++
+			}
+		}
+		if urls != 1 {
+			p.Fail("--basefile-sha256 requires a --basefile with exactly one URL")
+		}
+	}
+
+	if cfg.Command != "" {
+		if flag := cfg.adapterConflict(); flag != "" {
+			p.Fail(fmt.Sprintf("--command can not be used with %s", flag))
+		}
+	}
+
+	if !contains(signTools, cfg.SignTool) {
+		p.Fail(fmt.Sprintf("invalid --sign-tool %q. Must be one of %v", cfg.SignTool, signTools))
+	}
+
+	if cfg.BaseFromServer != "" && (cfg.Base != "" || cfg.BaseFile != "" || cfg.HistoryWindow > 0) {
+		p.Fail("--base-from-server can not be used with --base, --basefile or --history-window")
+	}
+	if (cfg.BaseFromServer != "" || cfg.Push != nil) && cfg.Server == "" {
+		p.Fail("--base-from-server and push require --server")
+	}
+
+	if cfg.HistoryWindow > 0 && (cfg.Base != "" || cfg.BaseFile != "") {
+		p.Fail("--history-window can not be used with --base or --basefile")
+	}
+
+	for _, env := range append(append(cfg.Env, cfg.EnvBase...), cfg.EnvCurrent...) {
+		if !strings.Contains(env, "=") || strings.HasPrefix(env, "=") {
+			p.Fail(fmt.Sprintf("invalid environment variable %q, must be on the form KEY=VAL", env))
+		}
+	}
+
+	if cfg.Reproducible && cfg.externalBase() {
+		p.Fail("--reproducible can not be used with --basefile, --base-from-server or --history-window")
+	}
+
+	if cpus, err := cpuCounts(cfg.Cpu); err != nil {
+		p.Fail(err.Error())
+	} else if len(cpus) > 1 && cfg.NormalizeNames {
+		// The suffix is what tells the CPU counts apart.
+		p.Fail("--normalize-names can not be used with multiple --cpu values")
+	}
+
+	if cfg.Alternate > 0 && (cfg.ProfType != "" || cfg.ProfCallgrind) {
+		p.Fail("--alternate can not be used with profiling")
+	}
+
+	if _, found := xctraceTemplates[cfg.Xctrace]; cfg.Xctrace != "" && !found {
+		p.Fail(fmt.Sprintf("invalid --xctrace %q. Must be one of %v", cfg.Xctrace, []string{"time-profiler", "allocations"}))
+	}
+
+	if _, found := etwProfiles[cfg.ETW]; cfg.ETW != "" && !found {
+		p.Fail(fmt.Sprintf("invalid --etw %q. Must be one of %v", cfg.ETW, []string{"cpu", "heap", "general"}))
+	}
+
+	if _, found := coreClasses[cfg.Cores]; cfg.Cores != "" {
+		if !found {
+			p.Fail(fmt.Sprintf("invalid --cores %q. Must be one of %v", cfg.Cores, []string{"performance", "efficiency"}))
+		}
+		if runtime.GOOS != "darwin" {
+			p.Fail("--cores requires macOS")
+		}
+	}
+
+	if !contains(throttleModes, cfg.OnThrottle) {
+		p.Fail(fmt.Sprintf("invalid --on-throttle %q. Must be one of %v", cfg.OnThrottle, throttleModes))
+	}
+	if cfg.OnThrottle == "retry" && cfg.Retries < 1 {
+		p.Fail("--on-throttle retry requires --retries")
+	}
+
+	if cfg.CallGraph && !cfg.Affected {
+		p.Fail("--callgraph requires --affected")
+	}
+
+	if cfg.PerfStat {
+		if cfg.Affected {
+			p.Fail("--perf-stat can not be used with --affected")
+		}
+		if cfg.PerfStatIterations < 1 {
+			p.Fail("--perf-stat-iterations must be at least 1")
+		}
+		if cpus, _ := cpuCounts(cfg.Cpu); len(cpus) > 1 {
+			// The counters for the CPU counts would be shared.
+			p.Fail("--perf-stat can not be used with more than one --cpu")
+		}
+	}
+
+	if cfg.Instructions {
+		if cfg.PerfStat {
+			p.Fail("--instructions can not be used with --perf-stat")
+		}
+		if cfg.Affected {
+			p.Fail("--instructions can not be used with --affected")
+		}
+		if cfg.Gate != "all" {
+			p.Fail("--instructions can not be used with --gate " + cfg.Gate)
+		}
+		if cfg.InstructionsIterations < 1 {
+			p.Fail("--instructions-iterations must be at least 1")
+		}
+		if cpus, _ := cpuCounts(cfg.Cpu); len(cpus) > 1 {
+			// The counts for the CPU counts would be shared.
+			p.Fail("--instructions can not be used with more than one --cpu")
+		}
+	}
+
+	if cfg.Cachegrind {
+		if cfg.PerfStat || cfg.Instructions {
+			p.Fail("--cachegrind can not be used with --perf-stat or --instructions")
+		}
+		if cfg.Affected {
+			p.Fail("--cachegrind can not be used with --affected")
+		}
+		if cfg.CachegrindIterations < 1 {
+			p.Fail("--cachegrind-iterations must be at least 1")
+		}
+	}
+
+	if cfg.ParallelBuild {
+		if cfg.Alternate > 0 || cfg.Generate {
+			p.Fail("--parallel-build can not be used with --alternate or --generate")
+		}
+		if runtime.GOOS == "windows" {
+			p.Fail("--parallel-build is not supported on Windows")
+		}
+	}
+
+	if cfg.Parallel > 1 {
+		if runtime.GOOS != "linux" {
+			p.Fail("--parallel requires Linux")
+		}
+		if cpus, err := allowedCPUs(); err == nil && cfg.Parallel > len(cpus) {
+			p.Fail(fmt.Sprintf("--parallel %d exceeds the number of CPUs available (%d)", cfg.Parallel, len(cpus)))
+		}
+	}
+
+	if cfg.Shard != "" {
+		if _, _, err := parseShard(cfg.Shard); err != nil {
+			p.Fail(err.Error())
+		}
+		// The shards are picked from the benchmarks of the current code, so
+		// the removed ones are in no shard.
+		if cfg.FailOnRemoved || cfg.Unmatched == "fail" {
+			p.Fail("--shard can't be combined with --fail-on-removed or --unmatched fail, the removed benchmarks are in no shard")
+		}
+	}
+
+	if !contains(unmatchedModes, cfg.Unmatched) {
+		p.Fail(fmt.Sprintf("invalid --unmatched %q. Must be one of %v", cfg.Unmatched, unmatchedModes))
+	}
+	if cfg.Unmatched == "fail" {
+		cfg.FailOnRemoved = true
+	}
+
+	if !contains(dirtyModes, cfg.Dirty) {
+		p.Fail(fmt.Sprintf("invalid --dirty %q. Must be one of %v", cfg.Dirty, dirtyModes))
+	}
+
+	if !contains(fetchModes, cfg.Fetch) {
+		p.Fail(fmt.Sprintf("invalid --fetch %q. Must be one of %v", cfg.Fetch, fetchModes))
+	}
+	if cfg.FetchDepth < 1 {
+		p.Fail("--fetch-depth must be at least 1")
+	}
+
+	if cfg.Resume && cfg.OutDir == "" {
+		p.Fail("--resume requires --outdir")
+	}
+
+	if err := run(cfg); err != nil {
+		log.Fatal("Error: ", err)
+	}
+}
+
+// errNothingToRun is returned when there are no benchmarks to run,
+// which is not a failure.
+var errNothingToRun = errors.New("nothing to run")
+
+// run runs gobench with the validated configuration. Any cleanup, e.g.
+// restoring the checked out branch, is done before it returns.
+func run(cfg config) (err error) {
+	cfg.file, err = loadFileConfig(cfg.Config)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	if cfg.Set != "" {
+		if err := cfg.applySet(); err != nil {
+			return err
+		}
+	}
+
+	if cfg.OutDir == "" {
+		cfg.OutDir, err = os.MkdirTemp("", "gobench")
+		if err != nil {
+			return fmt.Errorf("create temp dir: %w", err)
+		}
+		defer os.Remove(cfg.OutDir)
+		cfg.tempOutDir = true
+	}
+	cfg.OutDir, err = filepath.Abs(cfg.OutDir)
+	if err != nil {
+		return fmt.Errorf("resolve out dir: %w", err)
+	}
+	if err := os.MkdirAll(cfg.OutDir, 0o777); err != nil {
+		return fmt.Errorf("create out dir: %w", err)
+	}
+
+	if cfg.Init != nil {
+		r := runner{config: cfg}
+		if err := r.runInit(); err != nil {
+			return fmt.Errorf("init: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.SelfUpdate != nil {
+		if err := runSelfUpdate(); err != nil {
+			return fmt.Errorf("self-update: %w", err)
+		}
+		return nil
+	}
+
+	if !cfg.NoUpdateCheck {
+		checkForUpdate()
+	}
+
+	if cfg.Doctor != nil {
+		r := runner{config: cfg}
+		if err := r.runDoctor(); err != nil {
+			return fmt.Errorf("doctor: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.EnvCmd != nil {
+		r := runner{config: cfg}
+		if err := r.runEnv(); err != nil {
+			return fmt.Errorf("env: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.Report != nil {
+		r := runner{config: cfg}
+		if err := r.runReport(); err != nil {
+			return fmt.Errorf("report: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.Push != nil {
+		r := runner{config: cfg}
+		if err := r.runPush(); err != nil {
+			return fmt.Errorf("push: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.MergeCmd != nil {
+		r := runner{config: cfg}
+		if err := r.runMerge(); err != nil {
+			return fmt.Errorf("merge: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.History != nil {
+		r := runner{config: cfg}
+		if err := r.runHistory(); err != nil {
+			return fmt.Errorf("history: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.Compare != nil {
+		r := runner{config: cfg}
+		if err := r.runCompare(); err != nil {
+			return fmt.Errorf("compare: %w", err)
+		}
+		return nil
+	}
+
+	unlockRepo, err := cfg.lockRepo()
+	if err != nil {
+		return fmt.Errorf("lock repository: %w", err)
+	}
+	defer unlockRepo()
+
+	if cfg.NotifyDesktop > 0 {
+		start := time.Now()
+		defer func() { cfg.notifyDesktopDone(start, err) }()
+	}
+
+	if cfg.LockEnv {
+		locked, err := lockEnv()
+		if err != nil {
+			return fmt.Errorf("lock env: %w", err)
+		}
+		if locked {
+			defer func() {
+				if uerr := unlockEnv(); uerr != nil && err == nil {
+					err = fmt.Errorf("unlock env: %w", uerr)
+				}
+			}()
+		}
+	}
+
+	if err := cfg.checkPower(); err != nil {
+		return err
+	}
+
+	if cfg.WaitIdle {
+		if err := cfg.waitIdle(); err != nil {
+			return fmt.Errorf("wait for idle: %w", err)
+		}
+	}
+
+	ctx, cancel := newRunContext(cfg.MaxDuration)
+	defer cancel()
+
+	currentBranch, err := getCurrentBranch()
+	if err != nil {
+		return err
+	}
+	r := runner{currentBranch: currentBranch, ctx: ctx, config: cfg}
+
+	if cfg.Dep != nil {
+		if err := r.runDep(); err != nil {
+			return fmt.Errorf("dep: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.GODEBUG != nil {
+		if err := r.runGODEBUG(); err != nil {
+			return fmt.Errorf("godebug: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.Inline != nil {
+		if err := r.runInline(); err != nil {
+			return fmt.Errorf("inline: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.Replace != nil {
+		if err := r.runReplace(); err != nil {
+			return fmt.Errorf("replace: %w", err)
+		}
+		return nil
+	}
+
+	if r.BaseFromServer != "" {
+		if r.BaseFile, err = r.pullBaseline(r.BaseFromServer); err != nil {
+			return fmt.Errorf("base from server: %w", err)
+		}
+		fmt.Printf("Benchmark branch %q and compare with %q from the server.\n", r.currentBranch, r.BaseFromServer)
+	} else if r.BaseFile != "" {
+		fmt.Printf("Benchmark branch %q and compare with %q.\n", r.currentBranch, r.BaseFile)
+	} else if r.HistoryWindow > 0 {
+		fmt.Printf("Benchmark branch %q and compare with the last %d results on %q.\n", r.currentBranch, r.HistoryWindow, r.HistoryBranch)
+	} else if r.Base != "" {
+		fmt.Printf("Benchmark and compare branch %q and %q.\n", r.Base, r.currentBranch)
+	} else {
+		fmt.Printf("Benchmark branch %q\n", r.currentBranch)
+	}
+
+	if err := r.runBenchmarks(); err != nil {
+		if errors.Is(err, errNothingToRun) {
+			return nil
+		}
+		return err
+	}
+
+	if cpus := r.profileCPUs(); cpus != nil {
+		if err := r.reportCPUProfiles(cpus); err != nil {
+			return fmt.Errorf("pprof: %w", err)
+		}
+	}
+
+	if r.profilingEnabled() {
+		if err := r.runPprof(); err != nil {
+			return fmt.Errorf("pprof: %w", err)
+		}
+	}
+
+	if r.Xctrace != "" {
+		if err := r.runInstruments(); err != nil {
+			return fmt.Errorf("instruments: %w", err)
+		}
+	}
+
+	if r.ETW != "" {
+		if err := r.runETW(); err != nil {
+			return fmt.Errorf("etw: %w", err)
+		}
+	}
+
+	return nil
+}
+
+type runner struct {
+	currentBranch string
+	state         *runState
+
+	// The directory to run in, defaults to the current directory.
+	workDir string
+
+	// The packages to benchmark, defaults to --package.
+	packages []string
+
+	// Done when the remaining benchmark runs should be aborted.
+	ctx context.Context
+
+	config
+}
+
+func (r runner) packageArgs() []string {
+	if r.packages != nil {
+		return r.packages
+	}
+	return []string{r.Package}
+}
+
+func (r *runner) runBenchmarks() error {
+	var hasUncommitted bool
+
+	if r.Base != "" && !r.externalBase() {
+		if err := r.ensureRef(r.Base); err != nil {
+			return fmt.Errorf("base: %w", err)
+		}
+	}
+
+	if !r.NoStash && !r.externalBase() {
+		var err error
+		hasUncommitted, err = hasUncommittedChanges()
+		if err != nil {
+			return err
+		}
+
+		if hasUncommitted && r.Base != "" {
+			return errors.New("--base set, but there are uncommited changes")
+		}
+
+		if r.Base == "" && hasUncommitted {
+			// Compare to a stashed version.
+			r.Base = "stash"
+		}
+	}
+
+	// Compare the current ref with itself using different environments.
+	envCompare := len(r.EnvBase) > 0 || len(r.EnvCurrent) > 0
+
+	if r.Count == 0 {
+		r.Count = 1
+		if r.Base != "" || r.BaseGoExe != "" || r.externalBase() || envCompare {
+			r.Count = benchStatCountCompare
+		}
+	}
+
+	first, second := r.Base, r.currentBranch
+	exe1, exe2 := withExeSuffix(r.BaseGoExe), goExe
+	if exe1 == "" {
+		exe1 = exe2
+	}
+
+	var baseFiles []string
+	if r.BaseFile != "" {
+		var err error
+		baseFiles, err = r.baseFiles(r.BaseFile)
+		if err != nil {
+			return fmt.Errorf("base file: %w", err)
+		}
+		first = r.baseFileName(baseFiles[0], second)
+	} else if r.HistoryWindow > 0 {
+		first = "history-" + r.HistoryBranch
+	} else if first == "" && (r.BaseGoExe != "" || envCompare) {
+		first = r.currentBranch
+	}
+
+	baseRef := first
+	if first != "" && first == second {
+		// Same ref, but with a different Go binary or environment.
+		first += "-base"
+	}
+
+	if r.Reproducible {
+		moduleRef := baseRef
+		if hasUncommitted {
+			// The stash is relative to HEAD.
+			moduleRef = "HEAD"
+		}
+		if err := r.checkReproducible(moduleRef); err != nil {
+			return fmt.Errorf("reproducible: %w", err)
+		}
+	}
+
+	if r.Affected {
+		if err := r.selectAffected(hasUncommitted); err != nil {
+			return err
+		}
+	}
+
+	if r.Shard != "" {
+		if err := r.selectShard(exe2, first, second); err != nil {
+			return err
+		}
+	}
+
+	if r.Resume {
+		var err error
+		r.state, err = loadRunState(r.config, first, second)
+		if err != nil {
+			return fmt.Errorf("resume: %w", err)
+		}
+	} else {
+		r.state = newRunState(r.config, first, second)
+	}
+
+	if r.Verify {
+		if err := r.verifyTests(exe2, second); err != nil {
+			return fmt.Errorf("verify: %w", err)
+		}
+	}
+
+	if r.runsPreflight(hasUncommitted || r.Base != "" || r.BaseGoExe != "" || envCompare) {
+		ref := baseRef
+		if hasUncommitted {
+			// The base is the committed code.
+			ref = "HEAD"
+		}
+		if err := r.preflight(exe1, exe2, first, second, ref); err != nil {
+			return fmt.Errorf("preflight: %w", err)
+		}
+	}
+
+	if r.Budget > 0 {
+		refs := 1
+		if first != "" && r.BaseFile == "" && r.HistoryWindow == 0 {
+			refs = 2
+		}
+		if err := r.planBudget(exe2, second, refs); err != nil {
+			return fmt.Errorf("budget: %w", err)
+		}
+	}
+
+	var ranCurrent bool
+	if r.BaseFile != "" {
+		if err := mergeBenchFiles(r.benchOutFilename(first), baseFiles); err != nil {
+			return fmt.Errorf("merge base files: %w", err)
+		}
+	} else if r.HistoryWindow > 0 {
+		n, err := writeHistoryBase(r.benchOutFilename(first), r.HistoryBranch, r.HistoryWindow)
+		if err != nil {
+			return fmt.Errorf("read history: %w", err)
+		}
+		fmt.Printf("Using the results for %d commits on %q as the base.\n", n, r.HistoryBranch)
+	} else if r.Alternate > 0 && (hasUncommitted || r.Base != "" || r.BaseGoExe != "" || envCompare) {
+		if hasUncommitted {
+			// The base is the committed code.
+			baseRef = "HEAD"
+		}
+		if err := ignoreAborted(r.runAlternating(exe1, exe2, first, second, baseRef)); err != nil {
+			return fmt.Errorf("run benchmarks: %w", err)
+		}
+		ranCurrent = true
+	} else if r.ParallelBuild && (hasUncommitted || r.Base != "" || r.BaseGoExe != "" || envCompare) {
+		if hasUncommitted {
+			// The base is the committed code.
+			baseRef = "HEAD"
+		}
+		if err := ignoreAborted(r.runPrebuilt(exe1, exe2, first, second, baseRef)); err != nil {
+			return fmt.Errorf("run benchmarks: %w", err)
+		}
+		ranCurrent = true
+	} else if hasUncommitted && r.Dirty == "copy" {
+		if err := ignoreAborted(r.runDirtyCopy(exe1, exe2, first, second)); err != nil {
+			return fmt.Errorf("run benchmarks: %w", err)
+		}
+		ranCurrent = true
+	} else if hasUncommitted {
+		if err := r.runStashed(exe1, first); err != nil {
+			return err
+		}
+	} else if r.Base != "" || r.BaseGoExe != "" || envCompare {
+		if err := r.runCheckedOut(exe1, first, baseRef, second); err != nil {
+			return err
+		}
+	}
+
+	if !ranCurrent {
+		if err := ignoreAborted(r.runBenchmark(exe2, second, r.countCurrent(), r.EnvCurrent)); err != nil {
+			return fmt.Errorf("run benchmark: %w", err)
+		}
+	}
+
+	r.printAborted()
+	if r.aborted() && r.state.Completed[second] == 0 {
+		return fmt.Errorf("no results for %q to report", second)
+	}
+
+	// Make it stand out a little.
+	fmt.Print("\n\n")
+	if err := r.runBenchStat(first, second); err != nil {
+		return fmt.Errorf("run benchstat: %w", err)
+	}
+
+	if err := r.keepGoingError(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// runStashed stashes the uncommitted changes, runs the base benchmark and
+// pops the stash, also on failure.
+func (r runner) runStashed(exeName, name string) (err error) {
+	fmt.Println("Stash changes")
+	if err := stash("push"); err != nil {
+		return err
+	}
+	defer func() {
+		if perr := stash("pop"); perr != nil && err == nil {
+			err = perr
+		}
+	}()
+
+	if err := ignoreAborted(r.runBenchmark(exeName, name, r.countBase(), r.EnvBase)); err != nil {
+		return fmt.Errorf("run benchmark: %w", err)
+	}
+	return nil
+}
+
+// runCheckedOut checks out baseRef, runs the base benchmark and checks out
+// the current branch again, also on failure.
+func (r runner) runCheckedOut(exeName, name, baseRef, current string) (err error) {
+	if current != baseRef {
+		defer func() {
+			if cerr := r.checkout(current); cerr != nil && err == nil {
+				err = fmt.Errorf("checkout current branch: %w", cerr)
+			}
+		}()
+	}
+
+	// Start with the "left" branch
+	if err := r.checkout(baseRef); err != nil {
+		return fmt.Errorf("checkout base: %w", err)
+	}
+	if err := ignoreAborted(r.runBenchmark(exeName, name, r.countBase(), r.EnvBase)); err != nil {
+		return fmt.Errorf("run benchmark: %w", err)
+	}
+	return nil
+}
+
+// selectAffected restricts the packages, and with --callgraph the
+// benchmarks, to run to those affected by the changes.
+func (r *runner) selectAffected(hasUncommitted bool) error {
+	ref, err := r.affectedRef(hasUncommitted)
+	if err != nil {
+		return err
+	}
+	r.packages, err = r.affectedPackages(ref)
+	if err != nil {
+		return fmt.Errorf("find affected packages: %w", err)
+	}
+	if r.CallGraph && len(r.packages) > 0 {
+		if err := r.selectImpacted(ref); err != nil {
+			return err
+		}
+	}
+	if len(r.packages) == 0 {
+		fmt.Printf("No packages affected by the changes since %q, nothing to benchmark.\n", ref)
+		return errNothingToRun
+	}
+	if len(r.packages) > 1 && r.profilingEnabled() {
+		return fmt.Errorf("profiling requires a single package, but %d packages are affected", len(r.packages))
+	}
+	fmt.Printf("Benchmark the packages affected by the changes since %q: %s\n", ref, strings.Join(r.packages, " "))
+	return nil
+}
+
+// selectImpacted restricts the packages and benchmarks to run to those that
+// can reach code changed since ref, within --bench. If other than Go files
+// or any methods changed, all benchmarks of the packages are kept, as the
+// call graph doesn't cover e.g. a go.mod dependency bump or calls through
+// interfaces.
+func (r *runner) selectImpacted(ref string) error {
+	nonGo, err := changedNonGoFiles(r.workDir, ref)
+	if err != nil {
+		return fmt.Errorf("find changed files: %w", err)
+	}
+	if len(nonGo) > 0 {
+		if len(nonGo) > 3 {
+			nonGo = append(nonGo[:3], "...")
+		}
+		fmt.Printf("Non-Go files changed (%s), run all benchmarks of the affected packages.\n", strings.Join(nonGo, ", "))
+		return nil
+	}
+
+	benchmarks, methods, err := r.impactedBenchmarks(ref, r.packages)
+	if err != nil {
+		return fmt.Errorf("find impacted benchmarks: %w", err)
+	}
+	if len(methods) > 0 {
+		if len(methods) > 3 {
+			methods = append(methods[:3], "...")
+		}
+		fmt.Printf("Methods changed (%s), which may be called through interfaces, run all benchmarks of the affected packages.\n", strings.Join(methods, ", "))
+		return nil
+	}
+	var impacted []string
+	for _, pkg := range r.packages {
+		if len(benchmarks[pkg]) > 0 {
+			impacted = append(impacted, pkg)
+		}
+	}
+	r.packages = impacted
+	if len(benchmarks) > 0 {
+		// Keep the sub-benchmark levels of --bench.
+		_, sub := splitBenchPattern(r.Bench)
+		r.Bench = benchPattern(benchmarks) + sub
+	}
+	return nil
+}
+
+// addRunCounts adds the retries and throttled runs of the results for
+// names in this session to s.
+func (r runner) addRunCounts(s *summary, names ...string) {
+	if r.state == nil {
+		return
+	}
+	for _, name := range names {
+		if n := r.state.Retries[name]; n > 0 {
+			if s.Retries == nil {
+				s.Retries = make(map[string]int)
+			}
+			s.Retries[name] = n
+		}
+		if n := r.state.Throttled[name]; n > 0 {
+			if s.Throttled == nil {
+				s.Throttled = make(map[string]int)
+			}
+			s.Throttled[name] = n
+		}
+	}
+}
+
+// RunNotes returns the notes about the retried and throttled runs, in the
+// order of the base and current results.
+func (s *summary) RunNotes() []string {
+	var notes []string
+	for _, name := range []string{s.Base, s.Current} {
+		if n := s.Retries[name]; n > 0 {
+			notes = append(notes, fmt.Sprintf("%d failed runs for %q were retried.", n, name))
+		}
+		if n := s.Throttled[name]; n > 0 {
+			notes = append(notes, fmt.Sprintf("%d runs for %q were throttled.", n, name))
+		}
+	}
+	return notes
+}
+
+// runNotes returns RunNotes as lines, or as a markdown section if markdown
+// is set. It's empty if there are none.
+func (s *summary) runNotes(markdown bool) string {
+	notes := s.RunNotes()
+	if len(notes) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	if markdown {
+		sb.WriteString("\n#### Retries\n\n")
+		for _, note := range notes {
+			fmt.Fprintf(&sb, "- %s\n", note)
+		}
+		return sb.String()
+	}
+	sb.WriteString("\n")
+	for _, note := range notes {
+		fmt.Fprintf(&sb, "Note: %s\n", note)
+	}
+	return sb.String()
+}
+
+func (r runner) runBenchmark(exeName, name string, count int, env []string) (err error) {
+	if r.aborted() {
+		return errAborted
+	}
 
-	// Defaults
-	cfg.Bench = "Bench*"
+	if done := r.state.Completed[name]; done >= count {
+		fmt.Printf("Skip benchmark for %q, %d of %d runs already completed.\n", name, done, count)
+		return nil
+	}
 
-	p := arg.MustParse(&cfg)
+	teardown, err := r.setupRun(exeName, name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if terr := teardown(); terr != nil && err == nil {
+			err = terr
+		}
+	}()
 
-	if cfg.ProfType != "" {
-		if cfg.ProfType != "mem" && cfg.ProfType != "cpu" && cfg.ProfType != "block" {
-			p.Fail(fmt.Sprintf("invalid profile type %q. Must be one of %v", cfg.ProfType, []string{"mem", "cpu", "block"}))
+	return r.runMeasured(exeName, name, count, env)
+}
+
+// setupRun does the setup for the benchmark runs for name that is done once
+// per ref: --generate, the BCE capture, the compose services and the pre-run
+// hook. The returned teardown runs the post-run hook and stops the services.
+func (r runner) setupRun(exeName, name string) (teardown func() error, err error) {
+	var stops []func() error
+	teardown = func() error {
+		var err error
+		for i := len(stops) - 1; i >= 0; i-- {
+			if serr := stops[i](); serr != nil && err == nil {
+				err = serr
+			}
 		}
+		return err
 	}
+	defer func() {
+		if err != nil {
+			teardown()
+		}
+	}()
 
-	if cfg.OutDir == "" {
-		var err error
-		cfg.OutDir, err = os.MkdirTemp("", "gobench")
-		checkErr("create temp dir", err)
-		defer os.Remove(cfg.OutDir)
+	if r.Generate {
+		if err := r.generate(exeName); err != nil {
+			return nil, err
+		}
 	}
 
-	r := runner{currentBranch: getCurrentBranch(), config: cfg}
+	if r.BCE {
+		if err := r.captureBCE(exeName, name); err != nil {
+			return nil, err
+		}
+	}
 
-	if r.Base != "" {
-		fmt.Printf("Benchmark and compare branch %q and %q.\n", r.Base, r.currentBranch)
-	} else {
-		fmt.Printf("Benchmark branch %q\n", r.currentBranch)
+	if r.file.Compose != nil {
+		down, err := r.composeUp(name)
+		if err != nil {
+			return nil, err
+		}
+		stops = append(stops, down)
 	}
 
-	r.runBenchmarks()
+	if err := r.runHook(stagePreRun, name); err != nil {
+		return nil, err
+	}
+	stops = append(stops, func() error { return r.runHook(stagePostRun, name) })
 
-	if r.profilingEnabled() {
-		r.runPprof()
+	if r.Command == "" {
+		b, _ := exec.Command(exeName, "version").CombinedOutput()
+		fmt.Println("\n", string(b))
 	}
-}
 
-type runner struct {
-	currentBranch string
-	config
+	return teardown, nil
 }
 
-func (r *runner) runBenchmarks() {
-	var hasUncommitted bool
+// runMeasured runs the go test (or --command) step for name until count runs
+// are completed, without the per-ref setup in setupRun.
+func (r runner) runMeasured(exeName, name string, count int, env []string) error {
+	if r.aborted() {
+		return errAborted
+	}
 
-	if !r.NoStash {
-		hasUncommitted = hasUncommittedChanges()
+	done := r.state.Completed[name]
 
-		if hasUncommitted && r.Base != "" {
-			log.Fatal("error: --base set, but there are uncommited changes.")
-		}
+	f, err := r.createBenchOutputFile(name, r.state.Offsets[name])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-		if r.Base == "" && hasUncommitted {
-			// Compare to a stashed version.
-			r.Base = "stash"
+	if _, found := r.state.Offsets[name]; !found {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
 		}
+		r.state.Offsets[name] = fi.Size()
 	}
 
-	if r.Count == 0 {
-		r.Count = 1
-		if r.Base != "" || r.BaseGoExe != "" {
-			r.Count = benchStatCountCompare
+	output := io.MultiWriter(f, os.Stdout)
+
+	// The per-ref environment takes precedence over the global one.
+	env = append(append([]string(nil), r.Env...), env...)
+
+	mod := r.modFlag(exeName)
+
+	packages := r.packageArgs()
+	// Patterns like ./... are expanded so the packages can be left out
+	// with --keep-going or split into groups with --parallel.
+	if r.KeepGoing || r.Parallel > 1 {
+		if packages, err = r.listPackages(exeName, env); err != nil {
+			return err
 		}
+		// Failed in an earlier, resumed session.
+		packages = without(packages, r.state.FailedPackages[name])
 	}
 
-	first, second := r.Base, r.currentBranch
-	exe1, exe2 := r.BaseGoExe, goExe
-	if exe1 == "" {
-		exe1 = exe2
+	groups, err := r.countGroups(exeName, env)
+	if err != nil {
+		return err
+	}
+
+	if r.Cachegrind && !r.Merge && done == 0 {
+		// Like the result file, start over.
+		if err := os.Remove(r.cachegrindOutFilename(name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
 	}
-	if hasUncommitted {
-		// Stash and compare
-		fmt.Println("Stash changes")
-		stash("save")
-		checkErr("run benchmark", r.runBenchmark(exe1, first))
-		stash("pop")
-	} else if r.Base != "" || r.BaseGoExe != "" {
-		if first == "" {
-			first = r.currentBranch
+
+	// Run the counts in chunks so the progress can be saved in between.
+	chunk := r.countPerRun(count)
+	for done < count {
+		n := chunk
+		if count-done < n {
+			n = count - done
+		}
+
+		// Run each group of benchmarks with its share of the chunk.
+		runGroups := func(errOutput io.Writer) error {
+			for _, g := range groups {
+				gn := g.chunkCount(done, n, count)
+				if gn == 0 {
+					continue
+				}
+				gr := r
+				gr.Bench = g.bench
+				if r.Command != "" {
+					if err := gr.runAdapter(name, gn, env, output, errOutput); err != nil {
+						return err
+					}
+					continue
+				}
+				err := gr.runCPUGroups(name, func(gr runner, profileName string) error {
+					args := gr.asBenchArgs(profileName, gn)
+					if mod != "" {
+						args = append(args, "-mod="+mod)
+					}
+					return gr.runChunk(exeName, args, packages, env, output, errOutput)
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		var discarded int
+		for attempt := 1; ; attempt++ {
+			if r.Cachegrind {
+				// From an earlier failed or discarded attempt.
+				if err := r.removeCachegrindRuns(name); err != nil {
+					return err
+				}
+			}
+			var stderr bytes.Buffer
+			monitor := startThrottleMonitor()
+			err = runGroups(io.MultiWriter(os.Stderr, &stderr))
+			var chunkOutput string
+			if err != nil && !r.aborted() {
+				var rerr error
+				if chunkOutput, rerr = readFrom(f.Name(), r.state.Offsets[name]); rerr != nil {
+					return rerr
+				}
+			}
+			if err != nil && r.KeepGoing && !r.aborted() {
+				if failed := failedPackages(chunkOutput); len(failed) > 0 && len(failed) < len(packages) {
+					fmt.Printf("Benchmarks for %s failed, keep going without them.\n", strings.Join(failed, ", "))
+					r.state.failedPackages(name, failed)
+					packages = without(packages, failed)
+					err = nil
+				}
+			}
+			if monitor.stop() && err == nil {
+				r.state.throttled(name)
+				if r.OnThrottle == "retry" && attempt <= r.Retries {
+					fmt.Printf("Benchmark run for %q was throttled. Retry %d of %d.\n", name, attempt, r.Retries)
+					r.state.retried(name)
+					if err := f.Truncate(r.state.Offsets[name]); err != nil {
+						return err
+					}
+					continue
+				}
+				if r.OnThrottle == "discard" {
+					discarded++
+					if discarded > maxThrottleDiscards {
+						return fmt.Errorf("benchmark run for %q was throttled %d times in a row, let the machine cool down and try again", name, discarded)
+					}
+					fmt.Printf("Benchmark run for %q was throttled, discarding its results and running it again.\n", name)
+					if err := f.Truncate(r.state.Offsets[name]); err != nil {
+						return err
+					}
+					// A discarded run is not a retry.
+					attempt--
+					continue
+				}
+				fmt.Printf("Warning: benchmark run for %q was throttled, the results may be skewed.\n", name)
+			}
+			if err == nil {
+				break
+			}
+			if r.aborted() {
+				fmt.Printf("Benchmark run for %q aborted, %d of %d runs completed.\n", name, done, count)
+				// Discard any partial output from the aborted run.
+				if err := f.Truncate(r.state.Offsets[name]); err != nil {
+					return err
+				}
+				return errAborted
+			}
+			if attempt > r.Retries && r.Command != "" {
+				return fmt.Errorf("--command failed for %q: %s", name, err)
+			}
+			if attempt > r.Retries || buildFailed(chunkOutput) {
+				// Build failures will not go away by retrying.
+				return goTestError(name, err, chunkOutput, stderr.String())
+			}
+
+			fmt.Printf("Benchmark run for %q failed: %s. Retry %d of %d.\n", name, err, attempt, r.Retries)
+			r.state.retried(name)
+
+			// Discard any partial output from the failed run.
+			if err := f.Truncate(r.state.Offsets[name]); err != nil {
+				return err
+			}
+		}
+
+		if r.Cachegrind {
+			if err := r.mergeCachegrind(name); err != nil {
+				return err
+			}
+		}
+
+		fi, err := f.Stat()
+		if err != nil {
+			return err
 		}
-		// Start with the "left" branch
-		checkErr("checkout base", r.checkout(first))
-		checkErr("run benchmark", r.runBenchmark(exe1, first))
-		if second != first {
-			checkErr("checkout current branch", r.checkout(second))
+		if err := r.state.complete(name, n, fi.Size()); err != nil {
+			return err
 		}
+		done += n
 	}
 
-	checkErr("run benchmark", r.runBenchmark(exe2, second))
+	return nil
+}
+
+// maxErrorLines is the max number of lines of go test output to include in
+// the error for a failed run.
+const maxErrorLines = 30
 
-	// Make it stand out a little.
-	fmt.Print("\n\n")
-	checkErr("run benchstat", r.runBenchStat(first, second))
+// buildFailed reports whether the go test output reports a package that
+// failed to build.
+func buildFailed(output string) bool {
+	return strings.Contains(output, "[build failed]") || strings.Contains(output, "[setup failed]")
 }
 
-func (r runner) runBenchmark(exeName, name string) error {
-	args := append(r.asBenchArgs(name), r.Package)
+// goTestError returns the error for a failed go test run for name, with the
+// failed packages and the last lines written to stderr, e.g. compiler errors.
+func goTestError(name string, err error, output, stderr string) error {
+	msg := fmt.Sprintf("go test failed for %q: %s", name, err)
+	if failed := failedPackages(output); len(failed) > 0 {
+		msg += "\n\nFailed packages:\n  " + strings.Join(failed, "\n  ")
+	}
+	if lines := strings.Split(strings.TrimSpace(stderr), "\n"); lines[0] != "" {
+		if len(lines) > maxErrorLines {
+			lines = append([]string{"..."}, lines[len(lines)-maxErrorLines:]...)
+		}
+		msg += "\n\nOutput:\n  " + strings.Join(lines, "\n  ")
+	}
+	return errors.New(msg)
+}
 
-	b, _ := exec.Command(exeName, "version").CombinedOutput()
-	fmt.Println("\n", string(b))
+// runChunk runs go test with args for packages once, or once per value of the
+// configured parameter sweep.
+func (r runner) runChunk(exeName string, args, packages, env []string, output, errOutput io.Writer) error {
+	run := func(env []string, output io.Writer) error {
+		if err := r.writeCores(output); err != nil {
+			return err
+		}
 
-	cmd := exec.Command(exeName, args...)
+		if r.runsParallel(packages) {
+			return r.runParallel(exeName, args, packages, env, output, errOutput)
+		}
 
-	f, err := r.createBenchOutputFile(name)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+		args := append(append([]string(nil), args...), packages...)
+		if r.Instructions {
+			return r.runInstructions(exeName, args, env, output, errOutput)
+		}
+		if r.PerfStat {
+			return r.runPerfStat(exeName, args, env, output, errOutput)
+		}
 
-	output := io.MultiWriter(f, os.Stdout)
+		cmd := r.benchCommand(exeName, args)
+		cmd.Dir = r.workDir
+		if len(env) > 0 {
+			cmd.Env = append(os.Environ(), env...)
+		}
+		cmd.Stdout = output
+		cmd.Stderr = errOutput
+		return cmd.Run()
+	}
 
-	cmd.Stdout = output
-	cmd.Stderr = os.Stderr
+	return r.withSweep(env, output, run)
+}
 
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("failed to execute %q: %s", exeName, err)
+// withSweep calls run once, or with the sweep in the config file once per
+// value with the value set in env and its results labeled with it.
+func (r runner) withSweep(env []string, output io.Writer, run func(env []string, output io.Writer) error) error {
+	s := r.file.Sweep
+	if s == nil {
+		return run(env, output)
 	}
 
+	for _, value := range s.Values {
+		fmt.Printf("Run with %s=%s\n", s.Env, value)
+		lw := &labelWriter{w: output, label: s.label(value)}
+		if err := run(append(append([]string(nil), env...), s.Env+"="+value), lw); err != nil {
+			return err
+		}
+		if err := lw.flush(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -174,35 +1392,294 @@ func (r runner) runBenchStat(name1, name2 string) error {
 	if name2 == "" {
 		return errors.New("no second name")
 	}
-	const cmdName = "benchstat"
 
+	base, current := name1, name2
 	name2 = r.benchOutName(name2)
 
-	args := []string{"-sort", "name"}
+	var bf1, bf2 *benchFile
 	if name1 != "" {
-		name1 = r.benchOutName(name1)
-		args = []string{name1, name2}
-	} else {
-		args = []string{name2}
+		var err error
+		bf1, bf2, name1, name2, err = r.prepareCompare(r.benchOutName(name1), name2)
+		if err != nil {
+			return err
+		}
+	}
+
+	var report string
+	if bf1 == nil || r.Format == "text" || r.Format == "html" {
+		args := []string{name2}
+		if name1 != "" {
+			args = []string{name1, name2}
+		}
+		output, err := r.benchstat(args...)
+		if err != nil {
+			return err
+		}
+		if bf1 == nil || r.Format == "text" {
+			fmt.Println(output)
+		}
+		// The HTML page embeds the benchstat output.
+		report = output
+	}
+
+	if s := r.file.Sweep; s != nil {
+		for i, name := range []string{name1, name2} {
+			if name == "" {
+				continue
+			}
+			bf, err := readBenchFile(filepath.Join(r.OutDir, name))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s by %s:\n\n%s\n", []string{base, current}[i], s.Env, renderSweepTable(bf, *s))
+		}
+	}
+
+	if r.BCE && name1 != "" {
+		if err := r.diffBCE(base, current); err != nil {
+			return err
+		}
+	}
+
+	if r.Cachegrind && name1 != "" {
+		if err := r.diffCachegrind(base, current); err != nil {
+			return err
+		}
+	}
+
+	if r.GitNotes && r.standardRun() {
+		if err := r.addGitNotes(current); err != nil {
+			return fmt.Errorf("failed to add git notes: %s", err)
+		}
+	}
+
+	if r.SignKey != "" && r.standardRun() {
+		names := []string{current}
+		if !r.externalBase() {
+			names = append(names, base)
+		}
+		if err := r.signResults(names...); err != nil {
+			return err
+		}
+	}
+
+	if bf1 == nil {
+		// Nothing to compare.
+		s := &summary{Current: current}
+		r.addRunCounts(s, current)
+		fmt.Print(s.runNotes(false))
+		if err := r.writeSummaryJSON(base, current, nil); err != nil {
+			return fmt.Errorf("failed to write %s: %s", summaryFilename, err)
+		}
+		return nil
+	}
+
+	s := newSummary(base, current, bf1, bf2, r.unitMetas(bf1, bf2))
+	r.addRunCounts(s, base, current)
+	s.applyNoiseFloor(float64(r.NoiseFloor))
+	s.applyPower(float64(r.PowerDelta))
+	s.applyQuarantine(r.file.Quarantine)
+	s.applyThreshold(r.Threshold, r.gateUnits())
+	s.Collapse = r.Collapse
+	s.Plots = r.Plots
+
+	switch r.Format {
+	case "text":
+		fmt.Println(s.Headline())
+		fmt.Print(s.missing())
+		fmt.Print(s.noiseWarnings())
+		fmt.Print(s.noiseFloorNotes())
+		fmt.Print(s.quarantineNotes(false))
+		fmt.Print(s.countAdvice(false))
+		fmt.Print(s.runNotes(false))
+		if r.Plots {
+			fmt.Printf("\n%s", renderBoxPlots(s))
+		}
+	case "html":
+		s.Report = report
+		page, err := renderHTML(s)
+		if err != nil {
+			return err
+		}
+		fmt.Print(page)
+		if r.Open {
+			if err := r.openHTMLReport(page); err != nil {
+				return fmt.Errorf("failed to open HTML report: %s", err)
+			}
+		}
+	default:
+		var err error
+		report, err = renderReport(r.Format, s)
+		if err != nil {
+			return err
+		}
+		fmt.Print(report)
+	}
+
+	if r.Charts != "" {
+		if err := r.writeCharts(r.Charts, s); err != nil {
+			return fmt.Errorf("failed to write charts: %s", err)
+		}
+	}
+
+	if r.Distribution {
+		fmt.Printf("\nDistributions:\n\n%s", renderDistributions(s))
+		if err := r.writeDistributions(s); err != nil {
+			return err
+		}
+	}
+
+	if cpus, _ := cpuCounts(r.Cpu); len(cpus) > 1 {
+		m := newCPUMatrix(s, cpus)
+		switch r.Format {
+		case "text":
+			fmt.Printf("\n%s", m.text())
+		case "markdown":
+			matrix := "\n" + m.markdown()
+			fmt.Print(matrix)
+			report += matrix
+		}
+	}
+	s.Report = report
+
+	if err := r.publish(s); err != nil {
+		return err
+	}
+
+	if err := r.writeSummaryJSON(base, current, s); err != nil {
+		return fmt.Errorf("failed to write %s: %s", summaryFilename, err)
+	}
+
+	if len(s.Violations) > 0 {
+		return fmt.Errorf("%d benchmarks regressed more than %g%%", len(s.Violations), r.Threshold)
+	}
+
+	if r.FailOnRemoved && len(s.Removed) > 0 {
+		return fmt.Errorf("%d benchmarks are missing in %s: %s", len(s.Removed), current, strings.Join(s.Removed, ", "))
 	}
 
-	cmd := exec.Command(cmdName, args...)
+	return nil
+}
+
+// benchstat runs benchstat on the given files in the out dir
+// and returns its output.
+func (r runner) benchstat(filenames ...string) (string, error) {
+	const cmdName = "benchstat"
+
+	cmd := exec.Command(cmdName, filenames...)
 	cmd.Dir = r.OutDir
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	fmt.Println(string(output))
+	return string(output), nil
+}
 
-	return nil
+// prepareCompare checks that the two result files were produced on the same
+// kind of hardware, normalizes the second if configured to do so, applies
+// the --renames mapping to the first and removes the metrics not selected
+// with --metrics.
+// It returns the parsed results and the names of the files to use for the
+// two result sets.
+func (r runner) prepareCompare(name1, name2 string) (*benchFile, *benchFile, string, string, error) {
+	bf1, err := readBenchFile(filepath.Join(r.OutDir, name1))
+	if err != nil {
+		return nil, nil, "", "", err
+	}
+	bf2, err := readBenchFile(filepath.Join(r.OutDir, name2))
+	if err != nil {
+		return nil, nil, "", "", err
+	}
+
+	if mismatches := hardwareMismatches(bf1, bf2); len(mismatches) > 0 {
+		fmt.Println("Warning: the results were produced on different hardware:")
+		for _, m := range mismatches {
+			fmt.Println("  ", m)
+		}
+		if r.Normalize == "" {
+			fmt.Println("Consider using --normalize with a calibration benchmark.")
+		}
+		fmt.Println()
+	}
+
+	if r.Normalize != "" {
+		factor, err := normalize(bf1, bf2, r.Normalize)
+		if err != nil {
+			return nil, nil, "", "", err
+		}
+		fmt.Printf("Normalized time values in %s by a factor of %.3f using %q.\n\n", name2, factor, r.Normalize)
+
+		name2 = strings.TrimSuffix(name2, ".bench") + "-normalized.bench"
+		if err := bf2.writeFile(filepath.Join(r.OutDir, name2)); err != nil {
+			return nil, nil, "", "", err
+		}
+	}
+
+	if r.Renames != "" {
+		m, err := readRenames(r.Renames)
+		if err != nil {
+			return nil, nil, "", "", err
+		}
+		fmt.Printf("Renamed %d results in %s using %s.\n\n", m.apply(bf1), name1, r.Renames)
+
+		name1 = strings.TrimSuffix(name1, ".bench") + "-renamed.bench"
+		if err := bf1.writeFile(filepath.Join(r.OutDir, name1)); err != nil {
+			return nil, nil, "", "", err
+		}
+	}
+
+	if r.NormalizeNames || len(r.file.Names) > 0 {
+		n1 := normalizeNames(bf1, r.NormalizeNames, r.file.Names)
+		n2 := normalizeNames(bf2, r.NormalizeNames, r.file.Names)
+		fmt.Printf("Normalized %d benchmark names in %s and %d in %s.\n\n", n1, name1, n2, name2)
+
+		name1 = strings.TrimSuffix(name1, ".bench") + "-names.bench"
+		name2 = strings.TrimSuffix(name2, ".bench") + "-names.bench"
+		if err := bf1.writeFile(filepath.Join(r.OutDir, name1)); err != nil {
+			return nil, nil, "", "", err
+		}
+		if err := bf2.writeFile(filepath.Join(r.OutDir, name2)); err != nil {
+			return nil, nil, "", "", err
+		}
+	}
+
+	if units := r.compareUnits(); units != nil {
+		bf1.keepUnits(units)
+		bf2.keepUnits(units)
+
+		name1 = strings.TrimSuffix(name1, ".bench") + "-metrics.bench"
+		name2 = strings.TrimSuffix(name2, ".bench") + "-metrics.bench"
+		if err := bf1.writeFile(filepath.Join(r.OutDir, name1)); err != nil {
+			return nil, nil, "", "", err
+		}
+		if err := bf2.writeFile(filepath.Join(r.OutDir, name2)); err != nil {
+			return nil, nil, "", "", err
+		}
+	}
+
+	if r.Unmatched != "keep" {
+		// Keep the benchmarks only found on one side in bf1 and bf2, so
+		// they're listed as removed and added.
+		common := benchmarkNames(bf1).intersect(benchmarkNames(bf2))
+		name1 = strings.TrimSuffix(name1, ".bench") + "-common.bench"
+		name2 = strings.TrimSuffix(name2, ".bench") + "-common.bench"
+		if err := bf1.writeCommon(filepath.Join(r.OutDir, name1), common); err != nil {
+			return nil, nil, "", "", err
+		}
+		if err := bf2.writeCommon(filepath.Join(r.OutDir, name2), common); err != nil {
+			return nil, nil, "", "", err
+		}
+	}
+
+	return bf1, bf2, name1, name2, nil
 }
 
 func (r runner) runPprof() error {
 	args := []string{"tool", "pprof"}
-	if r.Base != "" {
-		args = append(args, "-diff_base", r.profileOutFilename(r.Base))
+	if base := r.state.First; base != "" && !r.externalBase() {
+		args = append(args, "-diff_base", r.profileOutFilename(base))
 	}
 
 	if !r.IncludeRuntime {
@@ -210,6 +1687,9 @@ func (r runner) runPprof() error {
 	}
 
 	if r.ProfType == "mem" && r.ProfSampleIndex == "" {
+		if err := r.writeMemReports(args); err != nil {
+			return err
+		}
 		args = append(args, "--alloc_objects")
 	}
 
@@ -218,9 +1698,18 @@ func (r runner) runPprof() error {
 	}
 
 	// go tool pprof -callgrind -output callgrind.out innercpu.pprof
+	viewer := callgrindViewer()
 	if r.ProfCallgrind {
-		cf := r.callgrindOutFilename()
-		args = append(args, "-callgrind", "-output", cf)
+		if viewer != "" {
+			cf := r.callgrindOutFilename()
+			args = append(args, "-callgrind", "-output", cf)
+		} else {
+			fmt.Println("No callgrind viewer (qcachegrind or kcachegrind) found, opening the pprof web UI instead.")
+			args = append(args, "-http=localhost:0")
+		}
+	} else if r.Open {
+		// pprof opens the web UI in the browser.
+		args = append(args, "-http=localhost:0")
 	}
 
 	args = append(args, r.profileOutFilename(r.currentBranch))
@@ -236,11 +1725,11 @@ func (r runner) runPprof() error {
 	}
 
 	if err := cmd.Wait(); err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	if r.ProfCallgrind {
-		cmd := exec.Command("qcachegrind", r.callgrindOutFilename())
+	if r.ProfCallgrind && viewer != "" {
+		cmd := exec.Command(viewer, r.callgrindOutFilename())
 
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -255,53 +1744,84 @@ func (r runner) runPprof() error {
 	return nil
 }
 
+// generate runs the code generation step for the currently checked out ref.
+func (r runner) generate(exeName string) error {
+	var cmd *exec.Cmd
+	if r.GenerateCommand != "" {
+		fmt.Println("Run", r.GenerateCommand)
+		cmd = shellCommand(r.GenerateCommand)
+	} else {
+		fmt.Println("Run go generate ./...")
+		cmd = exec.Command(exeName, "generate", "./...")
+	}
+	cmd.Dir = r.workDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("generate failed: %s", err)
+	}
+	return nil
+}
+
 func (r runner) checkout(branch string) error {
+	if err := r.runHook(stagePreCheckout, branch); err != nil {
+		return err
+	}
 	output, err := exec.Command("git", "checkout", branch).CombinedOutput()
 	if err != nil {
 		return err
 	}
 	fmt.Println(string(output))
-	return nil
+	return r.runHook(stagePostCheckout, branch)
 }
 
-func getCurrentBranch() string {
+func getCurrentBranch() (string, error) {
 	output, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output()
-	checkErr("get current branch", err)
-	return strings.TrimSpace(string(output))
+	if err != nil {
+		return "", fmt.Errorf("get current branch: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
 }
 
-func stash(command string) string {
-	output, err := exec.Command("git", "stash", command).Output()
-	checkErr("stash", err)
-	return strings.TrimSpace(string(output))
+func stash(command string) error {
+	if output, err := exec.Command("git", "stash", command).CombinedOutput(); err != nil {
+		return fmt.Errorf("git stash %s: %w: %s", command, err, output)
+	}
+	return nil
 }
 
-func hasUncommittedChanges() bool {
+func hasUncommittedChanges() (bool, error) {
+	// Refresh the index first, or files only touched, e.g. by line ending
+	// conversion on Windows, are reported as changed.
+	exec.Command("git", "update-index", "-q", "--refresh").Run()
+
 	_, err := exec.Command("git", "diff-index", "--quiet", "HEAD", "--").Output()
 
 	if err == nil {
-		return false
+		return false, nil
 	}
 	if _, ok := err.(*exec.ExitError); ok {
-		return true
+		return true, nil
 	}
 
-	log.Fatal(err)
-	return true
+	return false, fmt.Errorf("check for uncommitted changes: %w", err)
 }
 
-func checkErr(what string, err error) {
-	if err != nil {
-		log.Fatal(what+": ", "Error: ", err)
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
 	}
+	return false
 }
 
-func (c config) asBenchArgs(name string) []string {
+func (c config) asBenchArgs(name string, count int) []string {
 	args := []string{
 		"test",
 		"-run", "NONE",
 		"-bench", c.Bench,
-		fmt.Sprintf("-count=%d", c.Count),
+		fmt.Sprintf("-count=%d", count),
 		"-test.benchmem=true",
 		"-timeout", "40m",
 	}
@@ -309,10 +1829,18 @@ func (c config) asBenchArgs(name string) []string {
 		args = append(args, "-race")
 	}
 
+	if c.Deterministic {
+		args = append(args, "-trimpath", "-ldflags=-buildid=")
+	}
+
 	if c.Tags != "" {
 		args = append(args, "-tags", c.Tags)
 	}
 
+	if c.gcflags != "" {
+		args = append(args, "-gcflags="+c.gcflags)
+	}
+
 	if c.ProfType != "" {
 		args = append(args, fmt.Sprintf("-%sprofile", c.ProfType), c.profileOutFilename(name))
 	}
@@ -321,12 +1849,17 @@ func (c config) asBenchArgs(name string) []string {
 		args = append(args, "-cpu", c.Cpu)
 	}
 
+	if c.Cachegrind {
+		// The totals are per test binary run, so fix the iterations to
+		// make them comparable.
+		args = append(args, fmt.Sprintf("-benchtime=%dx", c.CachegrindIterations), "-exec", c.cachegrindExec(name))
+	}
+
 	return args
 }
 
 func (c config) normalizeName(name string) string {
-	// Slashes in branch names.
-	return strings.ReplaceAll(name, "/", "-")
+	return fileNameReplacer.Replace(name)
 }
 
 func (c config) benchOutFilename(name string) string {
@@ -345,15 +1878,79 @@ func (c config) callgrindOutFilename() string {
 	return filepath.Join(c.OutDir, ("callgrind.out"))
 }
 
+// externalBase reports whether the base results are read from somewhere
+// else rather than produced by running the benchmarks.
+func (c config) externalBase() bool {
+	return c.BaseFile != "" || c.BaseFromServer != "" || c.HistoryWindow > 0
+}
+
+// baseFileName returns the name to use for the base results in filename.
+func (c config) baseFileName(filename, current string) string {
+	name := resultName(filename)
+	if c.normalizeName(name) == c.normalizeName(current) {
+		name = "base-" + name
+	}
+	return name
+}
+
+// resultName returns the name to use for the results in the given file.
+func resultName(filename string) string {
+	return strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+}
+
 func (c config) profilingEnabled() bool {
 	return c.ProfType != ""
 }
 
-func (c config) createBenchOutputFile(name string) (io.WriteCloser, error) {
-	f, err := os.Create(c.benchOutFilename(name))
+// countPerRun returns the number of counts to run per go test invocation.
+// The counts are run one at a time only if the progress is saved in between
+// to resume from, or the run may be cut short by --max-duration, as each
+// invocation adds the build and startup overhead.
+func (c config) countPerRun(count int) int {
+	if c.profilingEnabled() {
+		// The profile is written per invocation.
+		return count
+	}
+	if c.tempOutDir && c.MaxDuration == 0 {
+		return count
+	}
+	return 1
+}
+
+// countBase returns the count for the base run.
+func (c config) countBase() int {
+	if c.CountBase > 0 {
+		return c.CountBase
+	}
+	return c.Count
+}
+
+// countCurrent returns the count for the current run.
+func (c config) countCurrent() int {
+	if c.CountCurrent > 0 {
+		return c.CountCurrent
+	}
+	return c.Count
+}
+
+// createBenchOutputFile creates the result file for name. If offset is set,
+// the existing file is truncated to offset and appended to.
+func (c config) createBenchOutputFile(name string, offset int64) (*os.File, error) {
+	// Always append, so writes continue at the end after a truncate.
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !c.Merge && offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(c.benchOutFilename(name), flags, 0o666)
 	if err != nil {
 		return nil, err
 	}
+	if offset > 0 {
+		if err := f.Truncate(offset); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
 	return f, nil
 }
 
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestBenchmarkCompareToBranch(t *testing.T) {
@@ -51,6 +53,31 @@ func TestBenchmarkCompareToStashed(t *testing.T) {
 		`Stash changes`)
 }
 
+func TestGoTestError(t *testing.T) {
+	output := "ok  \texample.com/a\t0.1s\nFAIL\texample.com/c [setup failed]\nFAIL\n"
+	if !buildFailed(output) {
+		t.Fatal("expected build failure")
+	}
+	err := goTestError("base", errors.New("exit status 1"), output, "# example.com/c\nc_test.go:4:1: expected declaration\n")
+	assertContainsAll(t, err.Error(), `go test failed for "base"`, "  example.com/c\n", "  c_test.go:4:1: expected declaration")
+}
+
+func TestCountPerRun(t *testing.T) {
+	for _, test := range []struct {
+		cfg  config
+		want int
+	}{
+		{config{tempOutDir: true}, 5},
+		{config{}, 1},
+		{config{tempOutDir: true, MaxDuration: time.Minute}, 1},
+		{config{ProfType: "cpu"}, 5},
+	} {
+		if got := test.cfg.countPerRun(5); got != test.want {
+			t.Errorf("%+v: got %d, want %d", test.cfg, got, test.want)
+		}
+	}
+}
+
 func assertContainsAll(t *testing.T, content string, values ...string) {
 	for _, value := range values {
 		if !strings.Contains(content, value) {
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// memSampleIndexes are the memory profile views reported with --profType
+// mem: the allocation rate and what's retained.
+var memSampleIndexes = []string{"alloc_objects", "inuse_space"}
+
+// memReportFilename returns the filename of the pprof top report for the
+// memory profile sample index.
+func (c config) memReportFilename(index string) string {
+	return filepath.Join(c.OutDir, "mem-"+index+".txt")
+}
+
+// writeMemReports writes and prints a pprof top report of the memory
+// profile for each of memSampleIndexes, running go with the pprof args.
+func (r runner) writeMemReports(args []string) error {
+	for _, index := range memSampleIndexes {
+		filename := r.memReportFilename(index)
+		args := append(append([]string(nil), args...), "-top", "-sample_index="+index, "-output", filename, r.profileOutFilename(r.currentBranch))
+		if output, err := exec.Command(goExe, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to write %s report: %s: %s", index, err, strings.TrimSpace(string(output)))
+		}
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\nMemory profile, %s:\n\n%s", index, b)
+	}
+	return nil
+}
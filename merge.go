@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type mergeCmd struct {
+	Dirs []string `arg:"positional,required" help:"the --outdir of each shard or partial run, e.g. shard-*/"`
+}
+
+// mergePart is the result of one shard or partial run to merge.
+type mergePart struct {
+	dir string
+
+	// shard is nil for a run without --shard.
+	shard *shardInfo
+
+	base, current string
+}
+
+// runMerge merges the results of the runs in the given out dirs, usually
+// the shards of a run with --shard, into --outdir and reports the
+// comparison of the merged results. No benchmarks are run.
+func (r runner) runMerge() error {
+	var parts []mergePart
+	for _, dir := range r.MergeCmd.Dirs {
+		part, err := readMergePart(dir)
+		if err != nil {
+			return err
+		}
+		if filepath.Clean(part.dir) == r.OutDir {
+			return fmt.Errorf("--outdir %s is one of the dirs to merge", r.OutDir)
+		}
+		parts = append(parts, part)
+	}
+	warnings, err := checkMergeParts(parts)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		fmt.Println("Warning:", w)
+	}
+
+	first, second := parts[0].base, parts[0].current
+	for _, name := range []string{first, second} {
+		if name == "" {
+			continue
+		}
+		var filenames []string
+		for _, part := range parts {
+			filename := filepath.Join(part.dir, r.benchOutName(name))
+			if _, err := os.Stat(filename); err != nil {
+				if os.IsNotExist(err) {
+					// A shard without benchmarks writes no results.
+					continue
+				}
+				return err
+			}
+			filenames = append(filenames, filename)
+		}
+		if err := mergeBenchFiles(r.benchOutFilename(name), filenames); err != nil {
+			return err
+		}
+	}
+
+	if r.Format == "text" {
+		fmt.Printf("Merged %d results into %s.\n\n", len(parts), r.OutDir)
+	}
+
+	return r.runBenchStat(first, second)
+}
+
+// readMergePart reads the shard metadata in dir, falling back to the run
+// state for runs without --shard.
+func readMergePart(dir string) (mergePart, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return mergePart{}, err
+	}
+	part := mergePart{dir: dir}
+
+	filename := filepath.Join(dir, shardFilename)
+	b, err := os.ReadFile(filename)
+	if err == nil {
+		var info shardInfo
+		if err := json.Unmarshal(b, &info); err != nil {
+			return part, fmt.Errorf("failed to read %s: %s", filename, err)
+		}
+		part.shard = &info
+		part.base, part.current = info.Base, info.Current
+		return part, nil
+	}
+	if !os.IsNotExist(err) {
+		return part, err
+	}
+
+	filename = filepath.Join(dir, stateFilename)
+	b, err = os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return part, fmt.Errorf("no shard metadata or run state found in %s", dir)
+		}
+		return part, err
+	}
+	var state runState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return part, fmt.Errorf("failed to read %s: %s", filename, err)
+	}
+	if state.Second == "" {
+		return part, fmt.Errorf("no results recorded in %s", filename)
+	}
+	part.base, part.current = state.First, state.Second
+	return part, nil
+}
+
+// checkMergeParts checks that the parts are results of the same refs and,
+// for shards, of the same commits and benchmark selection with one result
+// per shard. It returns warnings for missing shards.
+func checkMergeParts(parts []mergePart) ([]string, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("nothing to merge")
+	}
+	first := parts[0]
+	seen := make(map[int]string)
+	for _, part := range parts {
+		if part.base != first.base || part.current != first.current {
+			return nil, fmt.Errorf("%s has results for %q vs %q, %s for %q vs %q", part.dir, part.base, part.current, first.dir, first.base, first.current)
+		}
+		if (part.shard == nil) != (first.shard == nil) {
+			return nil, fmt.Errorf("can't merge the shards with the results of a run without --shard")
+		}
+		if part.shard == nil {
+			continue
+		}
+
+		s, s0 := part.shard, first.shard
+		var diffs []string
+		if s.Total != s0.Total {
+			diffs = append(diffs, fmt.Sprintf("shard total %d vs %d", s.Total, s0.Total))
+		}
+		if s.BaseCommit != s0.BaseCommit {
+			diffs = append(diffs, fmt.Sprintf("base commit %s vs %s", s.BaseCommit, s0.BaseCommit))
+		}
+		if s.CurrentCommit != s0.CurrentCommit {
+			diffs = append(diffs, fmt.Sprintf("current commit %s vs %s", s.CurrentCommit, s0.CurrentCommit))
+		}
+		if s.Bench != s0.Bench {
+			diffs = append(diffs, fmt.Sprintf("--bench %q vs %q", s.Bench, s0.Bench))
+		}
+		if s.Package != s0.Package {
+			diffs = append(diffs, fmt.Sprintf("--package %q vs %q", s.Package, s0.Package))
+		}
+		if len(diffs) > 0 {
+			return nil, fmt.Errorf("%s is not a shard of the same run as %s: %s", part.dir, first.dir, strings.Join(diffs, ", "))
+		}
+		if dir, found := seen[s.Index]; found {
+			return nil, fmt.Errorf("shard %d/%d found in both %s and %s", s.Index, s.Total, dir, part.dir)
+		}
+		seen[s.Index] = part.dir
+	}
+
+	if first.shard == nil {
+		return nil, nil
+	}
+	var missing []string
+	for i := 1; i <= first.shard.Total; i++ {
+		if _, found := seen[i]; !found {
+			missing = append(missing, fmt.Sprintf("%d/%d", i, first.shard.Total))
+		}
+	}
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	return []string{fmt.Sprintf("missing shards %s, the merged results are incomplete", strings.Join(missing, ", "))}, nil
+}
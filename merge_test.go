@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckMergeParts(t *testing.T) {
+	shard := func(dir string, index int, commit string) mergePart {
+		return mergePart{
+			dir:   dir,
+			shard: &shardInfo{Index: index, Total: 3, Base: "main", Current: "feature", CurrentCommit: commit},
+			base:  "main", current: "feature",
+		}
+	}
+
+	warnings, err := checkMergeParts([]mergePart{shard("a", 1, "abc"), shard("b", 3, "abc")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "missing shards 2/3") {
+		t.Errorf("got warnings %q", warnings)
+	}
+
+	if _, err := checkMergeParts([]mergePart{shard("a", 1, "abc"), shard("b", 1, "abc")}); err == nil {
+		t.Error("expected error for duplicate shard")
+	}
+	if _, err := checkMergeParts([]mergePart{shard("a", 1, "abc"), shard("b", 2, "def")}); err == nil || !strings.Contains(err.Error(), "current commit") {
+		t.Errorf("expected error for different commits, got %v", err)
+	}
+	partial := mergePart{dir: "c", base: "main", current: "feature"}
+	if _, err := checkMergeParts([]mergePart{shard("a", 1, "abc"), partial}); err == nil {
+		t.Error("expected error for mixing shards and partial runs")
+	}
+	if _, err := checkMergeParts([]mergePart{partial, {dir: "d", base: "main", current: "HEAD"}}); err == nil {
+		t.Error("expected error for different refs")
+	}
+	if warnings, err := checkMergeParts([]mergePart{partial, partial}); err != nil || len(warnings) != 0 {
+		t.Errorf("got %q, %v", warnings, err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+// metricAliases maps the short metric names accepted by --metrics to
+// benchmark units.
+var metricAliases = map[string]string{
+	"time":   "ns/op",
+	"bytes":  "B/op",
+	"allocs": "allocs/op",
+}
+
+// allocUnits are the units checked against the threshold with --gate allocs.
+// Allocations are deterministic, so they are much less noisy than timings
+// on shared CI runners.
+var allocUnits = []string{"B/op", "allocs/op"}
+
+// gateModes are the valid values for --gate.
+var gateModes = []string{"all", "allocs"}
+
+// gateUnits returns the units that can fail the run, nil meaning all.
+// With --instructions, only the instruction counts can.
+func (c config) gateUnits() []string {
+	if c.Instructions {
+		return []string{instructionsUnit}
+	}
+	if c.Gate == "allocs" {
+		return allocUnits
+	}
+	return nil
+}
+
+// metricUnits returns the units for a comma separated list of metrics,
+// either aliases (time, bytes, allocs) or units, e.g. MB/s.
+// It returns nil if metrics is empty, meaning all units.
+func metricUnits(metrics string) []string {
+	var units []string
+	for _, m := range splitList(metrics) {
+		if unit, found := metricAliases[m]; found {
+			m = unit
+		}
+		units = append(units, m)
+	}
+	return units
+}
+
+// compareUnits returns the units to compare, nil meaning all. It defaults
+// to the instruction counts with --instructions, as the timings of the fixed
+// iteration runs are of little use.
+func (c config) compareUnits() []string {
+	if c.Metrics == "" && c.Instructions {
+		return []string{instructionsUnit}
+	}
+	return metricUnits(c.Metrics)
+}
+
+// keepUnits removes all values with a unit not in units from bf.
+// Results left without any values are removed.
+func (bf *benchFile) keepUnits(units []string) {
+	var results []*benchResult
+	for _, r := range bf.Results {
+		var values []benchValue
+		for _, v := range r.Values {
+			if contains(units, v.Unit) {
+				values = append(values, v)
+			}
+		}
+		r.Values = values
+		if len(values) > 0 {
+			results = append(results, r)
+		}
+	}
+	bf.Results = results
+
+	var lines []benchLine
+	for _, line := range bf.lines {
+		if line.result != nil && len(line.result.Values) == 0 {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	bf.lines = lines
+}
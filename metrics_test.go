@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestKeepUnits(t *testing.T) {
+	units := metricUnits("allocs, MB/s")
+	if len(units) != 2 || units[0] != "allocs/op" || units[1] != "MB/s" {
+		t.Fatalf("got units %v", units)
+	}
+
+	bf, _ := parseBenchFile(strings.NewReader(`BenchmarkFoo-4	10	1000 ns/op	16 B/op	1 allocs/op
+BenchmarkBar-4	10	1000 ns/op
+`))
+	bf.keepUnits(units)
+
+	if len(bf.Results) != 1 || len(bf.Results[0].Values) != 1 {
+		t.Fatalf("unexpected results: %v", bf.Results)
+	}
+	var buf bytes.Buffer
+	if err := bf.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "BenchmarkFoo-4\t10\t1 allocs/op\n" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// nameRewrite is a regular expression replacement applied to the benchmark
+// names in both result sets before comparing, e.g. to reconcile sub-benchmark
+// names derived from the machine.
+type nameRewrite struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+
+	re *regexp.Regexp
+}
+
+func (n *nameRewrite) compile() error {
+	var err error
+	if n.re, err = regexp.Compile(n.Pattern); err != nil {
+		return fmt.Errorf("invalid name pattern %q: %s", n.Pattern, err)
+	}
+	return nil
+}
+
+// normalizeNames strips the -N GOMAXPROCS suffix from the benchmark names in
+// bf if trimProcs is set, and applies the rewrites. It returns the number of
+// names changed.
+func normalizeNames(bf *benchFile, trimProcs bool, rewrites []nameRewrite) int {
+	var n int
+	for _, r := range bf.Results {
+		name := r.Name
+		if trimProcs {
+			name = trimProcsSuffix(name)
+		}
+		for _, rw := range rewrites {
+			name = rw.re.ReplaceAllString(name, rw.Replace)
+		}
+		if name != r.Name {
+			r.Name = name
+			n++
+		}
+	}
+	return n
+}
+
+// unmatchedModes are the valid --unmatched values.
+var unmatchedModes = []string{"keep", "exclude", "fail"}
+
+// writeCommon writes the results in bf for the benchmarks in common to
+// filename, leaving bf as is.
+func (bf *benchFile) writeCommon(filename string, common nameSet) error {
+	filtered := *bf
+	filtered.lines = nil
+	for _, line := range bf.lines {
+		if line.result != nil && !common[line.result.Name] {
+			continue
+		}
+		filtered.lines = append(filtered.lines, line)
+	}
+	return filtered.writeFile(filename)
+}
+
+// intersect returns the names in both s and other.
+func (s nameSet) intersect(other nameSet) nameSet {
+	common := make(nameSet)
+	for name := range s {
+		if other[name] {
+			common[name] = true
+		}
+	}
+	return common
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeNames(t *testing.T) {
+	bf, err := parseBenchFile(strings.NewReader(`BenchmarkFoo/host=a-8	100	10 ns/op
+BenchmarkBar-8	100	20 ns/op
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := nameRewrite{Pattern: "/host=[^/-]+"}
+	if err := rw.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if n := normalizeNames(bf, true, []nameRewrite{rw}); n != 2 {
+		t.Fatalf("got %d renamed", n)
+	}
+	if bf.Results[0].Name != "BenchmarkFoo" || bf.Results[1].Name != "BenchmarkBar" {
+		t.Fatalf("got %q and %q", bf.Results[0].Name, bf.Results[1].Name)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// tQuantiles holds the 97.5% quantiles of Student's t-distribution for 1 to
+// 30 degrees of freedom, for two-sided 95% confidence intervals.
+var tQuantiles = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tQuantile returns the 97.5% quantile of the t-distribution with df degrees
+// of freedom, approximated by the normal quantile above 30.
+func tQuantile(df int) float64 {
+	if df > len(tQuantiles) {
+		return zConfidence
+	}
+	return tQuantiles[df-1]
+}
+
+// ci returns the half width of the 95% confidence interval of the change in
+// c in percent of the base mean, 0 if there are too few samples.
+func (c comparison) ci() float64 {
+	n1, n2 := len(c.Old), len(c.New)
+	if n1 < 2 || n2 < 2 || c.OldMean == 0 {
+		return 0
+	}
+	s1, s2 := stddev(c.Old), stddev(c.New)
+	se := math.Sqrt(s1*s1/float64(n1) + s2*s2/float64(n2))
+	return tQuantile(n1+n2-2) * se / math.Abs(c.OldMean) * 100
+}
+
+// noisy reports whether c is a reported change smaller than the variation
+// of the samples, which shouldn't be read too much into.
+func (c comparison) noisy() bool {
+	return c.Significant && !c.Exact && c.CV > math.Abs(c.Delta)
+}
+
+// noisy returns the reported changes in s smaller than their variation.
+func (s *summary) noisy() []comparison {
+	var noisy []comparison
+	for _, c := range s.Comparisons {
+		if c.noisy() {
+			noisy = append(noisy, c)
+		}
+	}
+	return noisy
+}
+
+// formatNoise formats the change, its confidence interval and the
+// variation in c, e.g. "+2.10% ±4.20%, CV 6.5%".
+func formatNoise(c comparison) string {
+	return fmt.Sprintf("%+.2f%% ±%.2f%%, CV %.1f%%", c.Delta, c.CI, c.CV)
+}
+
+// noiseWarnings returns the lines warning about the noisy changes in s,
+// empty if none.
+func (s *summary) noiseWarnings() string {
+	noisy := s.noisy()
+	if len(noisy) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\nNoisy results, the variation exceeds the change:\n")
+	for _, c := range noisy {
+		fmt.Fprintf(&sb, "  %s %s: %s\n", c.Name, c.Unit, formatNoise(c))
+	}
+	return sb.String()
+}
@@ -0,0 +1,33 @@
+package main
+
+import "fmt"
+
+// notesRef is the git notes ref the results are stored in.
+const notesRef = "refs/notes/benchmarks"
+
+// addGitNotes attaches the results for name to the current commit
+// as a git note, replacing any existing note.
+// The notes can be read with git notes --ref=benchmarks show <commit>.
+func (r runner) addGitNotes(name string) error {
+	if r.Base == "stash" {
+		fmt.Println("Skip git notes, the results are for uncommitted changes.")
+		return nil
+	}
+	commit, err := gitOutput("", "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	if _, err := gitOutput("", "notes", "--ref="+notesRef, "add", "-f", "-F", r.benchOutFilename(name), commit); err != nil {
+		return err
+	}
+	fmt.Printf("Added results for %q as a note to %s in %s.\n", name, commit, notesRef)
+	return nil
+}
+
+// standardRun reports whether this is a run of the current checkout, i.e.
+// not a compare, report, merge, history or variant run, so the results
+// belong to HEAD.
+func (r runner) standardRun() bool {
+	return r.Compare == nil && r.Report == nil && r.MergeCmd == nil && r.History == nil &&
+		r.Dep == nil && r.Replace == nil && r.GODEBUG == nil && r.Inline == nil
+}
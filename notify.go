@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// notifySlack posts text to the Slack incoming webhook at url.
+func notifySlack(url, text string) error {
+	return postJSON(url, map[string]string{"text": "```\n" + text + "```"})
+}
+
+// postJSON posts v as JSON to url.
+func postJSON(url string, v interface{}) error {
+	return sendJSON("POST", url, v, nil)
+}
+
+// sendJSON sends v as JSON to url with method, with the request modified by
+// auth, e.g. to set credentials, if not nil.
+func sendJSON(method, url string, v interface{}, auth func(req *http.Request)) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if auth != nil {
+		auth(req)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// htmlReportFilename is the name of the HTML report written to --outdir
+// with --open.
+const htmlReportFilename = "report.html"
+
+// openHTMLReport writes the HTML report page to --outdir and opens it in
+// the default browser.
+func (r runner) openHTMLReport(page string) error {
+	filename := filepath.Join(r.OutDir, htmlReportFilename)
+	if err := os.WriteFile(filename, []byte(page), 0o644); err != nil {
+		return err
+	}
+	return openBrowser(filename)
+}
+
+// openBrowser opens the file or URL in the default browser.
+func openBrowser(target string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", target)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		cmd = exec.Command("xdg-open", target)
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// parallelGroup is a group of packages benchmarked in one go test invocation
+// pinned to a set of CPUs.
+type parallelGroup struct {
+	cpus     string
+	packages []string
+
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+	err    error
+}
+
+// parallelGroups splits the packages into at most n groups, each with its
+// own disjoint set of the allowed CPUs, in the order of their ids.
+func parallelGroups(packages []string, n int, cpus []int) []*parallelGroup {
+	if n > len(packages) {
+		n = len(packages)
+	}
+	if n > len(cpus) {
+		n = len(cpus)
+	}
+	size := len(cpus) / n
+	groups := make([]*parallelGroup, n)
+	for i := range groups {
+		groups[i] = &parallelGroup{cpus: cpuList(cpus[i*size : (i+1)*size])}
+	}
+	for i, pkg := range packages {
+		g := groups[i%n]
+		g.packages = append(g.packages, pkg)
+	}
+	return groups
+}
+
+// cpuList formats the CPU ids as a taskset CPU list, e.g. "0-3,6".
+func cpuList(cpus []int) string {
+	var parts []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if j == i {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// runsParallel reports whether the benchmarks for packages can be run
+// concurrently with --parallel. Runs measured with perf stat or valgrind
+// count the whole go test process, so they are always serialized.
+func (r runner) runsParallel(packages []string) bool {
+	return r.Parallel > 1 && len(packages) > 1 && !r.PerfStat && !r.Instructions && !r.Cachegrind
+}
+
+// runParallel builds and runs the benchmarks for the package groups
+// concurrently, each go test invocation pinned to its CPU set with taskset.
+// The output is written per group when all are done, so it's not interleaved.
+func (r runner) runParallel(exeName string, args, packages, env []string, output, errOutput io.Writer) error {
+	allowed, err := allowedCPUs()
+	if err != nil {
+		return fmt.Errorf("failed to get the CPU affinity: %s", err)
+	}
+	groups := parallelGroups(packages, r.Parallel, allowed)
+	var cpus []string
+	for _, g := range groups {
+		cpus = append(cpus, g.cpus)
+	}
+	fmt.Printf("Run %d groups of packages in parallel on CPUs %s\n", len(groups), strings.Join(cpus, ", "))
+
+	var wg sync.WaitGroup
+	for _, g := range groups {
+		wg.Add(1)
+		go func(g *parallelGroup) {
+			defer wg.Done()
+			args := append(append([]string(nil), args...), g.packages...)
+			cmd := commandContext(r.context(), "taskset", append([]string{"-c", g.cpus, exeName}, args...)...)
+			cmd.Dir = r.workDir
+			if len(env) > 0 {
+				cmd.Env = append(os.Environ(), env...)
+			}
+			cmd.Stdout = &g.stdout
+			cmd.Stderr = &g.stderr
+			g.err = cmd.Run()
+		}(g)
+	}
+	wg.Wait()
+
+	for _, g := range groups {
+		if _, werr := g.stdout.WriteTo(output); werr != nil {
+			return werr
+		}
+		if _, werr := g.stderr.WriteTo(errOutput); werr != nil {
+			return werr
+		}
+		if g.err != nil && err == nil {
+			err = g.err
+		}
+	}
+	return err
+}
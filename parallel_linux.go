@@ -0,0 +1,26 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// allowedCPUs returns the ids of the CPUs the process may run on, from
+// sched_getaffinity, so --parallel respects e.g. taskset, cgroup cpusets and
+// offline CPUs.
+func allowedCPUs() ([]int, error) {
+	var mask [1024 / 64]uint64
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return nil, errno
+	}
+	var cpus []int
+	for i, word := range mask {
+		for bit := 0; bit < 64; bit++ {
+			if word&(1<<uint(bit)) != 0 {
+				cpus = append(cpus, i*64+bit)
+			}
+		}
+	}
+	return cpus, nil
+}
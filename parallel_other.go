@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "runtime"
+
+// allowedCPUs returns the ids of the CPUs the process may run on. Outside
+// Linux they're assumed to be all of them.
+func allowedCPUs() ([]int, error) {
+	cpus := make([]int, runtime.NumCPU())
+	for i := range cpus {
+		cpus[i] = i
+	}
+	return cpus, nil
+}
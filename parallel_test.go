@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParallelGroups(t *testing.T) {
+	groups := parallelGroups([]string{"a", "b", "c"}, 2, []int{0, 1, 2, 3, 4, 5, 6, 7})
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups", len(groups))
+	}
+	if groups[0].cpus != "0-3" || groups[1].cpus != "4-7" {
+		t.Fatalf("got CPUs %s and %s", groups[0].cpus, groups[1].cpus)
+	}
+	if !reflect.DeepEqual(groups[0].packages, []string{"a", "c"}) || !reflect.DeepEqual(groups[1].packages, []string{"b"}) {
+		t.Fatalf("got packages %v and %v", groups[0].packages, groups[1].packages)
+	}
+
+	if groups := parallelGroups([]string{"a", "b"}, 4, []int{0, 1, 2, 3, 4, 5}); len(groups) != 2 || groups[1].cpus != "3-5" {
+		t.Fatalf("got %d groups", len(groups))
+	}
+
+	// E.g. restricted with taskset -c 2,3,5-7.
+	groups = parallelGroups([]string{"a", "b"}, 2, []int{2, 3, 5, 6, 7})
+	if groups[0].cpus != "2-3" || groups[1].cpus != "5-6" {
+		t.Fatalf("got CPUs %s and %s", groups[0].cpus, groups[1].cpus)
+	}
+}
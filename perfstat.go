@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// perfStatEvents are the hardware counters collected with --perf-stat.
+var perfStatEvents = []string{"cycles", "instructions", "branch-misses", "cache-misses"}
+
+func (c config) perfStatFilename() string {
+	return filepath.Join(c.OutDir, "perf-stat.csv")
+}
+
+// perfStatExec returns the go test -exec value running the test binaries
+// under perf stat, appending the counters to the perf stat file.
+func (c config) perfStatExec() string {
+	return fmt.Sprintf("perf stat -x , --append -e %s -o '%s'", strings.Join(perfStatEvents, ","), c.perfStatFilename())
+}
+
+// runPerfStat runs the benchmarks with --perf-stat, see runCounted, and
+// writes their results to output with the hardware counters per op added.
+// The counters are for the whole test binary process, including its
+// start-up, so more --perf-stat-iterations make them closer to the cost of
+// an op.
+func (r runner) runPerfStat(exeName string, args, env []string, output, errOutput io.Writer) error {
+	return r.runCounted(exeName, args, env, r.PerfStatIterations, r.perfStatExec(), perfStatEvents, output, errOutput)
+}
+
+// parsePerfStat parses the CSV output of perf stat -x, summing the counters
+// for all test binaries. Unsupported and uncounted events are skipped.
+func parsePerfStat(r io.Reader) (map[string]float64, error) {
+	sums := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) < 3 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			// E.g. <not supported>.
+			continue
+		}
+		// Events restricted to user space are reported as e.g. cycles:u.
+		event := strings.Split(fields[2], ":")[0]
+		sums[event] += v
+	}
+	return sums, scanner.Err()
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePerfStat(t *testing.T) {
+	res, err := parsePerfStat(strings.NewReader(`# started on Mon Oct 12 10:00:00 2026
+
+1000,,cycles:u,2000,100.00,,
+500,,instructions:u,2000,100.00,0.50,insn per cycle
+<not supported>,,branch-misses:u,0,100.00,,
+
+# started on Mon Oct 12 10:00:01 2026
+
+1000,,cycles:u,2000,100.00,,
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res["cycles"] != 2000 || res["instructions"] != 500 {
+		t.Fatalf("got %v", res)
+	}
+}
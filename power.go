@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// powerWarnings returns a description of each power state that is known to
+// slow down the benchmarks, e.g. running on battery, in a low power mode or
+// with the powersave CPU frequency governor of a driver like acpi-cpufreq.
+// Only Linux and macOS are checked.
+func powerWarnings() []string {
+	switch runtime.GOOS {
+	case "linux":
+		return linuxPowerWarnings("/")
+	case "darwin":
+		return darwinPowerWarnings()
+	}
+	return nil
+}
+
+// activePstateDrivers are the CPU frequency drivers selecting the frequency
+// themselves, where powersave is the normal governor and the energy
+// performance preference decides how aggressive they are.
+var activePstateDrivers = map[string]bool{
+	"intel_pstate":   true,
+	"amd-pstate-epp": true,
+}
+
+// linuxPowerWarnings is powerWarnings for the sysfs under root.
+func linuxPowerWarnings(root string) []string {
+	var warnings []string
+
+	supplies, _ := filepath.Glob(filepath.Join(root, "sys/class/power_supply/*"))
+	var hasBattery, online bool
+	for _, supply := range supplies {
+		switch readSysFile(filepath.Join(supply, "type")) {
+		case "Battery":
+			hasBattery = true
+		case "Mains", "USB":
+			if readSysFile(filepath.Join(supply, "online")) == "1" {
+				online = true
+			}
+		}
+	}
+	if hasBattery && !online {
+		warnings = append(warnings, "running on battery")
+	}
+
+	if profile := readSysFile(filepath.Join(root, "sys/firmware/acpi/platform_profile")); profile == "low-power" || profile == "quiet" {
+		warnings = append(warnings, fmt.Sprintf("the platform profile is %s", profile))
+	}
+
+	cpufreqs, _ := filepath.Glob(filepath.Join(root, "sys/devices/system/cpu/cpu*/cpufreq"))
+	for _, cpufreq := range cpufreqs {
+		if activePstateDrivers[readSysFile(filepath.Join(cpufreq, "scaling_driver"))] {
+			if epp := readSysFile(filepath.Join(cpufreq, "energy_performance_preference")); epp == "power" || epp == "balance_power" {
+				warnings = append(warnings, fmt.Sprintf("the CPU energy performance preference is %s", epp))
+				break
+			}
+			continue
+		}
+		if readSysFile(filepath.Join(cpufreq, "scaling_governor")) == "powersave" {
+			warnings = append(warnings, "the CPU frequency governor is powersave")
+			break
+		}
+	}
+
+	return warnings
+}
+
+func darwinPowerWarnings() []string {
+	var warnings []string
+	if out, err := exec.Command("pmset", "-g", "batt").Output(); err == nil && strings.Contains(string(out), "'Battery Power'") {
+		warnings = append(warnings, "running on battery")
+	}
+	if out, err := exec.Command("pmset", "-g").Output(); err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "lowpowermode" && fields[1] == "1" {
+				warnings = append(warnings, "low power mode is on")
+			}
+		}
+	}
+	return warnings
+}
+
+// readSysFile returns the trimmed content of a sysfs file, empty if it can
+// not be read.
+func readSysFile(filename string) string {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// checkPower prints a warning for each power state that will skew the
+// results, or fails with --require-ac.
+func (c config) checkPower() error {
+	warnings := powerWarnings()
+	if len(warnings) == 0 {
+		return nil
+	}
+	if c.RequireAC {
+		return errors.New("refusing to run with --require-ac: " + strings.Join(warnings, ", "))
+	}
+	for _, warning := range warnings {
+		fmt.Printf("Warning: %s, the results will not be comparable with results from a machine at full power.\n", warning)
+	}
+	return nil
+}
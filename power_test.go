@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLinuxPowerWarnings(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		files    map[string]string
+		expected []string
+	}{
+		{"acpi-cpufreq performance", map[string]string{
+			"cpu0/cpufreq/scaling_driver":   "acpi-cpufreq",
+			"cpu0/cpufreq/scaling_governor": "performance",
+		}, nil},
+		{"acpi-cpufreq powersave", map[string]string{
+			"cpu0/cpufreq/scaling_driver":   "acpi-cpufreq",
+			"cpu0/cpufreq/scaling_governor": "powersave",
+			"cpu1/cpufreq/scaling_driver":   "acpi-cpufreq",
+			"cpu1/cpufreq/scaling_governor": "powersave",
+		}, []string{"the CPU frequency governor is powersave"}},
+		{"intel_pstate passive powersave", map[string]string{
+			"cpu0/cpufreq/scaling_driver":   "intel_cpufreq",
+			"cpu0/cpufreq/scaling_governor": "powersave",
+		}, []string{"the CPU frequency governor is powersave"}},
+		{"intel_pstate balance_performance", map[string]string{
+			"cpu0/cpufreq/scaling_driver":                "intel_pstate",
+			"cpu0/cpufreq/scaling_governor":              "powersave",
+			"cpu0/cpufreq/energy_performance_preference": "balance_performance",
+		}, nil},
+		{"intel_pstate balance_power", map[string]string{
+			"cpu0/cpufreq/scaling_driver":                "intel_pstate",
+			"cpu0/cpufreq/scaling_governor":              "powersave",
+			"cpu0/cpufreq/energy_performance_preference": "balance_power",
+		}, []string{"the CPU energy performance preference is balance_power"}},
+		{"amd-pstate-epp power", map[string]string{
+			"cpu0/cpufreq/scaling_driver":                "amd-pstate-epp",
+			"cpu0/cpufreq/scaling_governor":              "powersave",
+			"cpu0/cpufreq/energy_performance_preference": "power",
+		}, []string{"the CPU energy performance preference is power"}},
+		{"no cpufreq", nil, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, content := range test.files {
+				filename := filepath.Join(root, "sys/devices/system/cpu", name)
+				if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filename, []byte(content+"\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := linuxPowerWarnings(root); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got %q, want %q", got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// runPrebuilt builds the test binaries for the base and the current ref
+// concurrently, the base in a git worktree, and then runs the benchmarks for
+// both back-to-back. The measured runs get the test binaries from the build
+// cache, and only they are sequential.
+func (r *runner) runPrebuilt(exe1, exe2, first, second, baseRef string) error {
+	base := *r
+	if baseRef != second {
+		dir, remove, err := r.addWorktree(baseRef)
+		if err != nil {
+			return err
+		}
+		defer remove()
+		base.workDir = dir
+	}
+
+	if err := r.buildBoth(base, exe1, exe2, first, second); err != nil {
+		return err
+	}
+
+	if err := base.runBenchmark(exe1, first, r.countBase(), r.EnvBase); err != nil {
+		return err
+	}
+	return r.runBenchmark(exe2, second, r.countCurrent(), r.EnvCurrent)
+}
+
+// preflight builds the test binaries for the base and the current ref
+// concurrently, the base in a git worktree, before any timed runs, so a
+// ref that doesn't compile fails the run right away. The build cache keys
+// include the directory, so the base is built again for its measured run
+// in the repository.
+func (r *runner) preflight(exe1, exe2, first, second, baseRef string) error {
+	base := *r
+	if baseRef != second {
+		dir, remove, err := r.addWorktree(baseRef)
+		if err != nil {
+			return err
+		}
+		defer remove()
+		base.workDir = dir
+	}
+	return r.buildBoth(base, exe1, exe2, first, second)
+}
+
+// buildBoth builds the test binaries for first with base and second with r
+// concurrently. With --keep-going, build failures are only warnings.
+func (r *runner) buildBoth(base runner, exe1, exe2, first, second string) error {
+	fmt.Printf("Build %q and %q in parallel.\n", first, second)
+	var wg sync.WaitGroup
+	var baseErr, currentErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		baseErr = base.prebuild(exe1, first, r.EnvBase)
+	}()
+	go func() {
+		defer wg.Done()
+		currentErr = r.prebuild(exe2, second, r.EnvCurrent)
+	}()
+	wg.Wait()
+	for _, err := range []error{baseErr, currentErr} {
+		if err == nil {
+			continue
+		}
+		if !r.KeepGoing {
+			return err
+		}
+		// Let the measured run sort out the failed packages.
+		fmt.Printf("Warning: %s\n", err)
+	}
+	return nil
+}
+
+// prebuild builds the test binaries for name into the build cache with the
+// same flags as the measured runs, without running them.
+func (r runner) prebuild(exeName, name string, env []string) error {
+	args := r.asBenchArgs(name, 1)
+	if mod := r.modFlag(exeName); mod != "" {
+		args = append(args, "-mod="+mod)
+	}
+	// The last -exec wins, and true exits without running the test binary.
+	args = append(args, "-run", "^$", "-exec", "true")
+	args = append(args, r.packageArgs()...)
+
+	cmd := commandContext(r.context(), exeName, args...)
+	cmd.Dir = r.workDir
+	if env = append(append([]string(nil), r.Env...), env...); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return goTestError(name, err, string(output), string(output))
+	}
+	return nil
+}
+
+// runsPreflight reports whether to build both refs before the timed runs
+// with --preflight when comparing two builds. It's not needed for
+// --parallel-build, which builds both first anyway, and not possible when
+// the code is generated or not built with go test.
+func (r runner) runsPreflight(comparing bool) bool {
+	if !comparing || !r.Preflight || r.externalBase() || r.ParallelBuild || r.Generate || r.Command != "" {
+		return false
+	}
+	// There's no true command to -exec on Windows.
+	return runtime.GOOS != "windows"
+}
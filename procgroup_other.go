@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package main
+
+import "os/exec"
+
+// setProcessGroup does nothing on platforms without process groups, only
+// the direct child is killed there and the WaitDelay stops waiting for its
+// children.
+func setProcessGroup(cmd *exec.Cmd) {}
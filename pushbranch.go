@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// pushResults commits the result files, the HTML report and an updated
+// history file for s to the configured results branch, and pushes the
+// branch if a remote is configured.
+func (r runner) pushResults(s *summary) error {
+	commit, err := gitOutput("", "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+
+	root, remove, err := addBranchWorktree(r.PushBranch)
+	if err != nil {
+		return err
+	}
+	defer remove()
+
+	dir := filepath.Join(root, filepath.FromSlash(r.PushDir))
+	runDir := filepath.Join(dir, commit)
+	if err := os.MkdirAll(runDir, 0o777); err != nil {
+		return err
+	}
+
+	for _, name := range []string{s.Base, s.Current} {
+		b, err := os.ReadFile(r.benchOutFilename(name))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(runDir, r.benchOutName(name)), b, 0o644); err != nil {
+			return err
+		}
+	}
+
+	html, err := renderHTML(s)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(runDir, "index.html"), []byte(html), 0o644); err != nil {
+		return err
+	}
+
+	historyFile := filepath.Join(dir, historyFilename)
+	history, err := readHistory(historyFile)
+	if err != nil {
+		return err
+	}
+	history = append(history, newHistoryEntry(commit, s))
+	if err := writeHistory(historyFile, history); err != nil {
+		return err
+	}
+
+	if _, err := gitOutput(root, "add", "-A"); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("Add benchmark results for %s (%s vs %s)", commit, s.Base, s.Current)
+	if _, err := gitOutput(root, "commit", "-m", msg); err != nil {
+		return err
+	}
+	fmt.Printf("Committed results to branch %q.\n", r.PushBranch)
+
+	if r.PushRemote != "" {
+		if _, err := gitOutput(root, "push", r.PushRemote, r.PushBranch); err != nil {
+			return err
+		}
+		fmt.Printf("Pushed branch %q to %q.\n", r.PushBranch, r.PushRemote)
+	}
+
+	return nil
+}
+
+// addBranchWorktree checks out branch in a new temporary worktree, creating
+// it as an orphan branch if it does not exist.
+// It returns the worktree root and a function that removes the worktree.
+func addBranchWorktree(branch string) (string, func(), error) {
+	root, err := os.MkdirTemp("", "gobench-branch")
+	if err != nil {
+		return "", nil, err
+	}
+
+	remove := func() {
+		if output, err := exec.Command("git", "worktree", "remove", "--force", root).CombinedOutput(); err != nil {
+			fmt.Printf("Warning: failed to remove worktree %s: %s: %s\n", root, err, output)
+		}
+		os.RemoveAll(root)
+	}
+
+	if _, err := gitOutput("", "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+		if _, err := gitOutput("", "worktree", "add", root, branch); err != nil {
+			os.RemoveAll(root)
+			return "", nil, err
+		}
+		return root, remove, nil
+	}
+
+	if _, err := gitOutput("", "worktree", "add", "--detach", root); err != nil {
+		os.RemoveAll(root)
+		return "", nil, err
+	}
+	if _, err := gitOutput(root, "checkout", "--orphan", branch); err != nil {
+		remove()
+		return "", nil, err
+	}
+	if _, err := gitOutput(root, "rm", "-rfq", "."); err != nil {
+		remove()
+		return "", nil, err
+	}
+
+	return root, remove, nil
+}
+
+// gitOutput runs git with args in dir and returns its trimmed output.
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %s: %s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// quarantined is an entry in the quarantine list of the config file, e.g.
+// {"bench": "^BenchmarkDial", "reason": "network jitter"}. The changes of
+// the matching benchmarks are reported but never violate the threshold.
+type quarantined struct {
+	Bench  string `json:"bench"`
+	Reason string `json:"reason"`
+
+	re *regexp.Regexp
+}
+
+func (q *quarantined) compile() error {
+	var err error
+	if q.re, err = regexp.Compile(q.Bench); err != nil {
+		return fmt.Errorf("invalid quarantine pattern %q: %s", q.Bench, err)
+	}
+	return nil
+}
+
+// isQuarantined reports whether the benchmark name matches an entry in the
+// quarantine list.
+func isQuarantined(name string, list []quarantined) bool {
+	for _, q := range list {
+		if q.re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyQuarantine marks the comparisons of the quarantined benchmarks,
+// which applyThreshold then skips.
+func (s *summary) applyQuarantine(list []quarantined) {
+	for i, c := range s.Comparisons {
+		if isQuarantined(c.Name, list) {
+			s.Comparisons[i].Quarantined = true
+		}
+	}
+}
+
+// quarantineNotes returns the significant changes of the quarantined
+// benchmarks, as a markdown list if markdown is set. It's empty if there
+// are none.
+func (s *summary) quarantineNotes(markdown bool) string {
+	changes := s.filterSorted(func(c comparison) bool {
+		return c.Quarantined && c.Significant
+	})
+	if len(changes) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	intro := "Changes in quarantined benchmarks, not checked against the threshold:"
+	prefix := "  "
+	if markdown {
+		fmt.Fprintf(&sb, "\n#### Quarantined\n\n%s\n\n", intro)
+		prefix = "- "
+	} else {
+		fmt.Fprintf(&sb, "\n%s\n", intro)
+	}
+	for _, c := range changes {
+		fmt.Fprintf(&sb, "%s%s %s: %s\n", prefix, c.Name, c.Unit, formatNoise(c))
+	}
+	return sb.String()
+}
+
+type historyQuarantineCmd struct {
+	Runs    int     `help:"the max number of stored results to look at" default:"20"`
+	MinRuns int     `arg:"--min-runs" help:"the min number of stored results for a benchmark to be considered" default:"3"`
+	MaxCV   percent `arg:"--max-cv" help:"suggest the benchmarks with a median coefficient of variation above this, e.g. 5%" default:"5"`
+	Branch  string  `help:"the branch to read the results from, defaults to --history-branch"`
+}
+
+// flakyBenchmark is the variation of a benchmark across the stored results.
+type flakyBenchmark struct {
+	name, unit string
+
+	// runs is the number of results with at least two samples, and
+	// medianCV and maxCV the median and max of their coefficients of
+	// variation in percent.
+	runs            int
+	medianCV, maxCV float64
+}
+
+// flakyBenchmarks returns the benchmarks in runs with at least minRuns
+// results and a median coefficient of variation above maxCV percent, the
+// noisiest first. Only the noisiest unit of each benchmark is included, and
+// units assumed exact are skipped.
+func flakyBenchmarks(runs []*benchFile, units map[string]unitMeta, minRuns int, maxCV float64) []flakyBenchmark {
+	cvs := make(map[sampleKey][]float64)
+	for _, bf := range runs {
+		for key, values := range bf.samples() {
+			if len(values) < 2 || units[key.unit].Assume == "exact" {
+				continue
+			}
+			m := mean(values)
+			if m == 0 {
+				continue
+			}
+			cvs[key] = append(cvs[key], stddev(values)/math.Abs(m)*100)
+		}
+	}
+
+	worst := make(map[string]flakyBenchmark)
+	for key, values := range cvs {
+		if len(values) < minRuns {
+			continue
+		}
+		f := flakyBenchmark{name: key.name, unit: key.unit, runs: len(values), medianCV: median(values)}
+		for _, cv := range values {
+			f.maxCV = math.Max(f.maxCV, cv)
+		}
+		if f.medianCV <= maxCV {
+			continue
+		}
+		w, found := worst[key.name]
+		if !found || f.medianCV > w.medianCV || (f.medianCV == w.medianCV && f.unit < w.unit) {
+			worst[key.name] = f
+		}
+	}
+
+	flaky := make([]flakyBenchmark, 0, len(worst))
+	for _, f := range worst {
+		flaky = append(flaky, f)
+	}
+	sort.Slice(flaky, func(i, j int) bool {
+		if flaky[i].medianCV != flaky[j].medianCV {
+			return flaky[i].medianCV > flaky[j].medianCV
+		}
+		return flaky[i].name < flaky[j].name
+	})
+	return flaky
+}
+
+// historyQuarantine suggests the benchmarks to quarantine from the
+// variation of their samples in the results stored as git notes. The
+// suggestions are printed as config file entries to be confirmed by adding
+// them to the quarantine list.
+func (r runner) historyQuarantine(re *regexp.Regexp) error {
+	cmd := r.History.Quarantine
+	branch := cmd.Branch
+	if branch == "" {
+		branch = r.HistoryBranch
+	}
+	if cmd.Runs < 1 || cmd.MinRuns < 1 {
+		return fmt.Errorf("--runs and --min-runs must be at least 1")
+	}
+	log, err := gitOutput("", "log", "--first-parent", "--format=%H", "-n", strconv.Itoa(maxHistoryCommits), branch)
+	if err != nil {
+		return err
+	}
+
+	var runs []*benchFile
+	for _, commit := range strings.Fields(log) {
+		if len(runs) == cmd.Runs {
+			break
+		}
+		bf, found, err := readNote(commit)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		bf.keepBenchmarks(re)
+		runs = append(runs, bf)
+	}
+	if len(runs) == 0 {
+		fmt.Printf("No results matching %q found in %s on %q.\n", r.Bench, notesRef, branch)
+		return nil
+	}
+
+	flaky := flakyBenchmarks(runs, r.file.Units, cmd.MinRuns, float64(cmd.MaxCV))
+	if len(flaky) == 0 {
+		fmt.Printf("No benchmarks with a median CV above %g%% in at least %d of the last %d results on %q.\n", float64(cmd.MaxCV), cmd.MinRuns, len(runs), branch)
+		return nil
+	}
+
+	fmt.Printf("Benchmarks with a median CV above %g%% in the last %d results on %q:\n\n", float64(cmd.MaxCV), len(runs), branch)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "benchmark\tunit\tresults\tmedian CV\tmax CV\t")
+	var suggested []quarantined
+	for _, f := range flaky {
+		status := ""
+		if isQuarantined(f.name, r.file.Quarantine) {
+			status = "quarantined"
+		} else {
+			suggested = append(suggested, quarantined{
+				Bench:  "^" + regexp.QuoteMeta(f.name) + "$",
+				Reason: fmt.Sprintf("median CV %.1f%% in %d results", f.medianCV, f.runs),
+			})
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.1f%%\t%.1f%%\t%s\n", f.name, f.unit, f.runs, f.medianCV, f.maxCV, status)
+	}
+	tw.Flush()
+
+	if len(suggested) == 0 {
+		fmt.Println("\nAll of them are already quarantined.")
+		return nil
+	}
+	b, err := json.MarshalIndent(map[string][]quarantined{"quarantine": suggested}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nTo quarantine them, add them to the config file:\n\n%s\n", b)
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyQuarantine(t *testing.T) {
+	list := []quarantined{{Bench: "^BenchmarkDial"}}
+	if err := list[0].compile(); err != nil {
+		t.Fatal(err)
+	}
+	s := &summary{Comparisons: []comparison{
+		{Name: "BenchmarkDial/tcp", Unit: "ns/op", Old: []float64{100, 100}, New: []float64{120, 120}, Delta: 20, Significant: true},
+		{Name: "BenchmarkEncode", Unit: "ns/op", Old: []float64{100, 100}, New: []float64{115, 115}, Delta: 15, Significant: true},
+		{Name: "BenchmarkDecode", Unit: "ns/op", Old: []float64{100, 100}, New: []float64{120, 120}, Delta: 20, Significant: true},
+	}}
+	s.applyQuarantine(list)
+	s.applyThreshold(10, nil)
+
+	if len(s.Violations) != 2 || s.Violations[0].Name != "BenchmarkDecode" || s.Violations[1].Name != "BenchmarkEncode" {
+		t.Errorf("got violations %v", s.Violations)
+	}
+	if got := s.quarantineNotes(false); !strings.Contains(got, "  BenchmarkDial/tcp ns/op: +20.00%") || strings.Contains(got, "BenchmarkEncode") {
+		t.Errorf("got %q", got)
+	}
+	if got := s.quarantineNotes(true); !strings.Contains(got, "#### Quarantined") || !strings.Contains(got, "- BenchmarkDial/tcp ns/op") {
+		t.Errorf("got %q", got)
+	}
+
+	if got := (&summary{Comparisons: s.Comparisons[1:]}).quarantineNotes(false); got != "" {
+		t.Errorf("expected no notes without quarantined changes, got %q", got)
+	}
+}
+
+func TestFlakyBenchmarks(t *testing.T) {
+	var runs []*benchFile
+	for _, run := range []string{
+		"BenchmarkNoisy 1 90 ns/op 95 hits/op\nBenchmarkNoisy 1 110 ns/op 105 hits/op\nBenchmarkStable 1 100 ns/op\nBenchmarkStable 1 101 ns/op\n",
+		"BenchmarkNoisy 1 80 ns/op 90 hits/op\nBenchmarkNoisy 1 120 ns/op 110 hits/op\nBenchmarkStable 1 100 ns/op\nBenchmarkStable 1 100 ns/op\n",
+		"BenchmarkNoisy 1 100 ns/op 100 hits/op\n",
+	} {
+		bf, err := parseBenchFile(strings.NewReader(run))
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, bf)
+	}
+	units := map[string]unitMeta{"hits/op": {Assume: "exact"}}
+
+	flaky := flakyBenchmarks(runs, units, 2, 5)
+	if len(flaky) != 1 {
+		t.Fatalf("got %v", flaky)
+	}
+	f := flaky[0]
+	if f.name != "BenchmarkNoisy" || f.unit != "ns/op" || f.runs != 2 || int(f.medianCV) != 21 || int(f.maxCV) != 28 {
+		t.Errorf("got %+v", f)
+	}
+
+	if flaky := flakyBenchmarks(runs, units, 3, 5); len(flaky) != 0 {
+		t.Errorf("expected too few results with at least two samples, got %v", flaky)
+	}
+	if flaky := flakyBenchmarks(runs, nil, 2, 5); len(flaky) != 1 || flaky[0].unit != "ns/op" {
+		t.Errorf("expected the noisiest unit only, got %v", flaky)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// releasePublicKey is the key the checksums files of the releases are
+// signed with, by ssh-keygen -Y sign -n gobench-release.
+const releasePublicKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIM0sKMnBwslr6nXPudzJQ+lATfiG9dSWDnWoBLfm80U2 gobench release"
+
+// releaseSignatureNamespace is the ssh-keygen -Y namespace of the release
+// signatures.
+const releaseSignatureNamespace = "gobench-release"
+
+// verifySSHSignature verifies the armored ssh-keygen -Y signature sig of
+// msg in namespace against the ed25519 public key in authorized_keys
+// format. It's a verifier for the SSHSIG format without ssh-keygen, which
+// may not be installed where gobench updates itself.
+func verifySSHSignature(publicKey, namespace string, msg, sig []byte) error {
+	fields := strings.Fields(publicKey)
+	if len(fields) < 2 || fields[0] != "ssh-ed25519" {
+		return errors.New("unsupported public key, must be ssh-ed25519")
+	}
+	keyBlob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return fmt.Errorf("invalid public key: %s", err)
+	}
+
+	blob, err := unarmorSSHSignature(sig)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(blob, []byte("SSHSIG")) {
+		return errors.New("invalid signature: missing SSHSIG magic")
+	}
+	r := sshReader{b: blob[6:]}
+	version := r.uint32()
+	sigKey := r.string()
+	sigNamespace := r.string()
+	reserved := r.string()
+	hashAlg := r.string()
+	sigData := r.string()
+	if r.err != nil {
+		return fmt.Errorf("invalid signature: %s", r.err)
+	}
+	if version != 1 {
+		return fmt.Errorf("unsupported signature version %d", version)
+	}
+	if !bytes.Equal(sigKey, keyBlob) {
+		return errors.New("the signature is not made by the release key")
+	}
+	if string(sigNamespace) != namespace {
+		return fmt.Errorf("the signature is for namespace %q, not %q", sigNamespace, namespace)
+	}
+
+	var digest []byte
+	switch string(hashAlg) {
+	case "sha512":
+		sum := sha512.Sum512(msg)
+		digest = sum[:]
+	case "sha256":
+		sum := sha256.Sum256(msg)
+		digest = sum[:]
+	default:
+		return fmt.Errorf("unsupported signature hash %q", hashAlg)
+	}
+
+	kr := sshReader{b: keyBlob}
+	keyType, key := kr.string(), kr.string()
+	sr := sshReader{b: sigData}
+	sigType, signature := sr.string(), sr.string()
+	if kr.err != nil || sr.err != nil || string(keyType) != "ssh-ed25519" || string(sigType) != "ssh-ed25519" || len(key) != ed25519.PublicKeySize {
+		return errors.New("invalid signature: not an ssh-ed25519 signature")
+	}
+
+	signed := sshSignedData(namespace, reserved, string(hashAlg), digest)
+	if !ed25519.Verify(ed25519.PublicKey(key), signed, signature) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// sshSignedData returns the data an SSHSIG signature is made over.
+func sshSignedData(namespace string, reserved []byte, hashAlg string, digest []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("SSHSIG")
+	for _, s := range [][]byte{[]byte(namespace), reserved, []byte(hashAlg), digest} {
+		writeSSHString(&b, s)
+	}
+	return b.Bytes()
+}
+
+func writeSSHString(b *bytes.Buffer, s []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(s)))
+	b.Write(n[:])
+	b.Write(s)
+}
+
+// unarmorSSHSignature returns the decoded blob of an armored SSH signature.
+func unarmorSSHSignature(sig []byte) ([]byte, error) {
+	const begin, end = "-----BEGIN SSH SIGNATURE-----", "-----END SSH SIGNATURE-----"
+	s := strings.TrimSpace(string(sig))
+	if !strings.HasPrefix(s, begin) || !strings.HasSuffix(s, end) {
+		return nil, errors.New("invalid signature: not an armored SSH signature")
+	}
+	s = strings.Join(strings.Fields(s[len(begin):len(s)-len(end)]), "")
+	blob, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %s", err)
+	}
+	return blob, nil
+}
+
+// sshReader reads the SSH wire format, see RFC 4251. The first error is
+// kept in err.
+type sshReader struct {
+	b   []byte
+	err error
+}
+
+func (r *sshReader) uint32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.b) < 4 {
+		r.err = errors.New("unexpected end of data")
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *sshReader) string() []byte {
+	n := r.uint32()
+	if r.err != nil {
+		return nil
+	}
+	if uint32(len(r.b)) < n {
+		r.err = errors.New("unexpected end of data")
+		return nil
+	}
+	s := r.b[:n]
+	r.b = r.b[n:]
+	return s
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// renames maps old to new benchmark names.
+type renames map[string]string
+
+// readRenames reads a rename mapping file with lines on the form
+// "BenchmarkOld => BenchmarkNew". Empty lines and lines starting with #
+// are ignored.
+func readRenames(filename string) (renames, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := make(renames)
+	scanner := bufio.NewScanner(f)
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, "=>")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"old-name => new-name\", got %q", filename, i, line)
+		}
+		oldName, newName := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if oldName == "" || newName == "" {
+			return nil, fmt.Errorf("%s:%d: expected \"old-name => new-name\", got %q", filename, i, line)
+		}
+		m[oldName] = newName
+	}
+
+	return m, scanner.Err()
+}
+
+// rename returns the new name for the benchmark name, which may have a
+// -N GOMAXPROCS suffix and be a sub-benchmark of a renamed benchmark.
+func (m renames) rename(name string) (string, bool) {
+	trimmed := trimProcsSuffix(name)
+	suffix := name[len(trimmed):]
+	if newName, found := m[trimmed]; found {
+		return newName + suffix, true
+	}
+	if i := strings.Index(trimmed, "/"); i != -1 {
+		if newName, found := m[trimmed[:i]]; found {
+			return newName + trimmed[i:] + suffix, true
+		}
+	}
+	return name, false
+}
+
+// apply renames the benchmarks in bf and returns the number renamed.
+func (m renames) apply(bf *benchFile) int {
+	var n int
+	for _, r := range bf.Results {
+		if newName, ok := m.rename(r.Name); ok {
+			r.Name = newName
+			n++
+		}
+	}
+	return n
+}
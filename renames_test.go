@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenames(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "renames.txt")
+	os.WriteFile(filename, []byte("# Renamed in v2.\nBenchmarkOld => BenchmarkNew\n"), 0o644)
+
+	m, err := readRenames(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bf, _ := parseBenchFile(strings.NewReader(`BenchmarkOld-4	10	100 ns/op
+BenchmarkOld/size=1K-4	10	100 ns/op
+BenchmarkOlder-4	10	100 ns/op
+`))
+	if n := m.apply(bf); n != 2 {
+		t.Fatalf("expected 2 renamed, got %d", n)
+	}
+	for i, expect := range []string{"BenchmarkNew-4", "BenchmarkNew/size=1K-4", "BenchmarkOlder-4"} {
+		if got := bf.Results[i].Name; got != expect {
+			t.Fatalf("got %q, expected %q", got, expect)
+		}
+	}
+}
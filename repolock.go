@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// repoLockFilename is the name of the lock file in the git directory.
+const repoLockFilename = "gobench.lock"
+
+// errLocked is returned by tryLockFile if another process holds the lock.
+var errLocked = errors.New("locked")
+
+// lockRepo takes the advisory lock on the repository for this process, so
+// concurrent invocations can't interleave their checkouts and stashes.
+// With --lock-wait, it waits up to that long for the lock to be released.
+// It returns a function that releases the lock.
+//
+// The lock is an OS lock on the lock file (flock or LockFileEx), which is
+// released when the process exits, so there are no stale locks to detect.
+// The file itself is left in place and only holds the process ID and start
+// time of the holder for the messages.
+func (c config) lockRepo() (func(), error) {
+	gitDir, err := gitOutput("", "rev-parse", "--git-common-dir")
+	if err != nil {
+		return nil, err
+	}
+	filename, err := filepath.Abs(filepath.Join(gitDir, repoLockFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(c.LockWait)
+	var waiting bool
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err := tryLockFile(f)
+		if err == nil {
+			break
+		}
+		if err != errLocked {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %s", filename, err)
+		}
+
+		pid, started := readRepoLock(filename)
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("another gobench (pid %d, started %s) is running in this repository; wait for it to finish or use --lock-wait", pid, started)
+		}
+		if !waiting {
+			fmt.Printf("Wait up to %s for another gobench (pid %d) running in this repository.\n", c.LockWait, pid)
+			waiting = true
+		}
+		time.Sleep(time.Second)
+	}
+
+	unlock := func() {
+		unlockFile(f)
+		f.Close()
+	}
+	if err := f.Truncate(0); err != nil {
+		unlock()
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(f, "%d\n%s\n", os.Getpid(), time.Now().Format(time.RFC3339)); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// readRepoLock returns the process ID and start time in the lock file,
+// zero and empty if it's not readable.
+func readRepoLock(filename string) (int, string) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, ""
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	pid, _ := strconv.Atoi(lines[0])
+	var started string
+	if len(lines) > 1 {
+		started = lines[1]
+	}
+	return pid, started
+}
@@ -0,0 +1,16 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package main
+
+import "os"
+
+// tryLockFile doesn't lock on platforms without flock or LockFileEx, so
+// concurrent invocations aren't detected there.
+func tryLockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+
+	errorLockViolation syscall.Errno = 33
+)
+
+// lockOffset is the offset of the locked byte. It's past the content, as
+// the locked range can't be read by other processes on Windows.
+const lockOffset = 1 << 31
+
+// tryLockFile takes an exclusive LockFileEx lock on f without blocking. It
+// returns errLocked if another process holds it.
+func tryLockFile(f *os.File) error {
+	ol := syscall.Overlapped{Offset: lockOffset}
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r != 0 {
+		return nil
+	}
+	if err == errorLockViolation {
+		return errLocked
+	}
+	return err
+}
+
+func unlockFile(f *os.File) error {
+	ol := syscall.Overlapped{Offset: lockOffset}
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r != 0 {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSummaryChanges is the max number of regressions and improvements to
+// list in compact summaries.
+const maxSummaryChanges = 5
+
+// reportFormats are the supported values for --format.
+var reportFormats = []string{"text", "markdown", "html", "json", "tap", "teamcity"}
+
+// renderReport renders s in the given format, any but text, which is
+// produced by benchstat, and html, see renderHTML.
+func renderReport(format string, s *summary) (string, error) {
+	switch format {
+	case "markdown":
+		return renderMarkdown(s), nil
+	case "json":
+		b, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(b) + "\n", nil
+	case "tap":
+		return renderTAP(s), nil
+	case "teamcity":
+		return renderTeamCity(s), nil
+	}
+	return "", fmt.Errorf("unsupported format %q", format)
+}
+
+// renderMarkdown renders s as a markdown table, with threshold violations
+// in bold. Sub-benchmarks are listed below a geomean row for their parent,
+// or only the geomean row if s.Collapse is set. If s.Plots is set, box
+// plots of the spread are added in a column.
+func renderMarkdown(s *summary) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "### %s vs %s\n\n", s.Base, s.Current)
+	fmt.Fprintf(&sb, "%s\n\n", s.Headline())
+
+	var plotHeader, plotAlign, plotEmpty string
+	if s.Plots {
+		plotHeader, plotAlign, plotEmpty = " Spread |", "---|", " |"
+	}
+	fmt.Fprintf(&sb, "| Benchmark | Unit | %s | %s | Delta | p | 95%% CI |%s\n", s.Base, s.Current, plotHeader)
+	sb.WriteString("|---|---|---:|---:|---:|---:|---:|" + plotAlign + "\n")
+	for _, g := range s.groups() {
+		if g.hasSubs() {
+			for _, gm := range g.Geomeans {
+				fmt.Fprintf(&sb, "| **%s** (geomean) | %s | | | %+.2f%% | | |%s\n", g.Name, gm.Unit, gm.Delta, plotEmpty)
+			}
+			if s.Collapse {
+				continue
+			}
+		}
+		for _, c := range g.Comparisons {
+			delta := "~"
+			if c.Significant {
+				delta = fmt.Sprintf("%+.2f%%", c.Delta)
+			}
+			if s.violation(c) {
+				delta = "**" + delta + "**"
+			}
+			var plot string
+			if s.Plots {
+				plot = plotEmpty
+				if old, new, ok := comparisonBoxPlots(c); ok {
+					plot = fmt.Sprintf(" `%s`<br>`%s` |", old, new)
+				}
+			}
+			var ci string
+			if len(c.Old) > 1 && len(c.New) > 1 {
+				ci = fmt.Sprintf("±%.2f%%", c.CI)
+			}
+			fmt.Fprintf(&sb, "| %s | %s | %.4g | %.4g | %s | %.3f | %s |%s\n", c.Name, c.Unit, c.OldMean, c.NewMean, delta, c.P, ci, plot)
+		}
+	}
+
+	if noisy := s.noisy(); len(noisy) > 0 {
+		sb.WriteString("\n#### Noisy\n\nThe variation exceeds the change, don't read too much into these:\n\n")
+		for _, c := range noisy {
+			fmt.Fprintf(&sb, "- %s %s: %s\n", c.Name, c.Unit, formatNoise(c))
+		}
+	}
+
+	// The benchmarks only found on one side are not in the table.
+	for _, section := range []struct {
+		title, desc string
+		names       []string
+	}{
+		{"Removed", "Only in " + s.Base + ", removed or renamed:", s.Removed},
+		{"Added", "Only in " + s.Current + ", added or renamed:", s.Added},
+	} {
+		if len(section.names) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n#### %s\n\n%s\n\n", section.title, section.desc)
+		for _, name := range section.names {
+			fmt.Fprintf(&sb, "- %s\n", name)
+		}
+	}
+
+	sb.WriteString(s.quarantineNotes(true))
+	sb.WriteString(s.countAdvice(true))
+	sb.WriteString(s.runNotes(true))
+
+	return sb.String()
+}
+
+// renderTAP renders s in the Test Anything Protocol format, with one test
+// per benchmark and unit. Threshold violations are reported as not ok.
+func renderTAP(s *summary) string {
+	var sb strings.Builder
+	sb.WriteString("TAP version 13\n")
+	fmt.Fprintf(&sb, "1..%d\n", len(s.Comparisons))
+	for i, c := range s.Comparisons {
+		status := "ok"
+		if s.violation(c) {
+			status = "not ok"
+		}
+		fmt.Fprintf(&sb, "%s %d - %s\n", status, i+1, formatComparison(c))
+	}
+	fmt.Fprintf(&sb, "# %s\n", s.Headline())
+	for _, note := range s.RunNotes() {
+		fmt.Fprintf(&sb, "# %s\n", note)
+	}
+	return sb.String()
+}
+
+// renderTeamCity renders s as TeamCity service messages, with a build
+// statistic value per benchmark and unit and threshold violations as
+// failed tests.
+func renderTeamCity(s *summary) string {
+	var sb strings.Builder
+	msg := func(name string, attrs ...string) {
+		sb.WriteString("##teamcity[" + name)
+		for i := 0; i+1 < len(attrs); i += 2 {
+			fmt.Fprintf(&sb, " %s='%s'", attrs[i], teamCityEscape(attrs[i+1]))
+		}
+		sb.WriteString("]\n")
+	}
+
+	suite := "gobench " + s.Base + " vs " + s.Current
+	msg("testSuiteStarted", "name", suite)
+	for _, c := range s.Comparisons {
+		key := "gobench." + c.Name + "." + c.Unit
+		msg("buildStatisticValue", "key", key, "value", fmt.Sprintf("%g", c.NewMean))
+		msg("buildStatisticValue", "key", key+".delta", "value", fmt.Sprintf("%.4f", c.Delta))
+
+		test := c.Name + " " + c.Unit
+		msg("testStarted", "name", test)
+		if s.violation(c) {
+			msg("testFailed", "name", test,
+				"message", fmt.Sprintf("regressed more than %g%%", s.Threshold),
+				"details", formatComparison(c))
+		}
+		msg("testFinished", "name", test)
+	}
+	msg("testSuiteFinished", "name", suite)
+	for _, g := range s.Geomeans {
+		msg("buildStatisticValue", "key", "gobench.geomean."+g.Unit+".delta", "value", fmt.Sprintf("%.4f", g.Delta))
+	}
+	for _, note := range s.RunNotes() {
+		msg("message", "text", note, "status", "WARNING")
+	}
+
+	return sb.String()
+}
+
+var teamCityReplacer = strings.NewReplacer(
+	"|", "||",
+	"'", "|'",
+	"\n", "|n",
+	"\r", "|r",
+	"[", "|[",
+	"]", "|]",
+)
+
+func teamCityEscape(s string) string {
+	return teamCityReplacer.Replace(s)
+}
+
+// publish sends the comparison summary to the configured destinations.
+func (r runner) publish(s *summary) error {
+	if r.JUnit != "" {
+		if err := writeJUnit(r.JUnit, s); err != nil {
+			return fmt.Errorf("failed to write JUnit report: %s", err)
+		}
+	}
+
+	if r.Badge != "" {
+		if err := writeBadge(r.Badge, s); err != nil {
+			return fmt.Errorf("failed to write badge: %s", err)
+		}
+	}
+
+	if r.PushBranch != "" {
+		if err := r.pushResults(s); err != nil {
+			return fmt.Errorf("failed to push results: %s", err)
+		}
+	}
+
+	if r.Buildkite {
+		if err := annotateBuildkite(s); err != nil {
+			return fmt.Errorf("failed to create Buildkite annotation: %s", err)
+		}
+	}
+
+	if r.Azure {
+		if err := azureLogIssues(r.OutDir, s); err != nil {
+			return fmt.Errorf("failed to write Azure Pipelines summary: %s", err)
+		}
+	}
+
+	if r.Bitbucket {
+		if err := r.reportBitbucket(s); err != nil {
+			return fmt.Errorf("failed to report to Bitbucket: %s", err)
+		}
+	}
+
+	if r.GerritURL != "" {
+		if err := r.postGerritReview(s); err != nil {
+			return fmt.Errorf("failed to post Gerrit review: %s", err)
+		}
+	}
+
+	if filename := os.Getenv("GITHUB_STEP_SUMMARY"); filename != "" {
+		if err := appendGitHubStepSummary(filename, s); err != nil {
+			return fmt.Errorf("failed to write GitHub job summary: %s", err)
+		}
+	}
+	if filename := os.Getenv("GITHUB_OUTPUT"); filename != "" {
+		if err := writeGitHubOutputs(filename, s, r.passed(s), filepath.Join(r.OutDir, summaryFilename)); err != nil {
+			return fmt.Errorf("failed to write GitHub outputs: %s", err)
+		}
+	}
+
+	if r.NotifyOn == "violation" && len(s.Violations) == 0 {
+		return nil
+	}
+	if r.NotifySlack != "" {
+		if err := notifySlack(r.NotifySlack, r.compactSummary(s)); err != nil {
+			return fmt.Errorf("failed to notify Slack: %s", err)
+		}
+	}
+	if r.NotifyURL != "" {
+		if err := postJSON(r.NotifyURL, s); err != nil {
+			return fmt.Errorf("failed to notify %s: %s", r.NotifyURL, err)
+		}
+	}
+	if r.EmailTo != "" {
+		if err := r.sendEmail(s); err != nil {
+			return fmt.Errorf("failed to send email: %s", err)
+		}
+	}
+	return nil
+}
+
+// compactSummary returns a short plain text summary of s listing the top
+// regressions and improvements.
+func (r runner) compactSummary(s *summary) string {
+	regressions, improvements := s.regressions(), s.improvements()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "gobench: %s vs %s\n%s\n", s.Base, s.Current, s.Headline())
+	sb.WriteString(s.missing())
+
+	list := func(title string, changes []comparison) {
+		if len(changes) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "\n%s:\n", title)
+		for i, c := range changes {
+			if i == maxSummaryChanges {
+				fmt.Fprintf(&sb, "  ... and %d more\n", len(changes)-i)
+				break
+			}
+			fmt.Fprintf(&sb, "  %s\n", formatComparison(c))
+		}
+	}
+	list("Top regressions", regressions)
+	list("Top improvements", improvements)
+	sb.WriteString(s.runNotes(false))
+
+	fmt.Fprintf(&sb, "\nResults in %s\n", r.OutDir)
+
+	return sb.String()
+}
+
+// Headline returns a one line summary of s with the geometric mean change
+// per unit and the number of improved, regressed and unchanged benchmarks,
+// e.g. "geomean: ns/op -1.23%, B/op +0.50%; 3 improved, 1 regressed, 10 unchanged".
+func (s *summary) Headline() string {
+	var means []string
+	var improved, regressed, unchanged int
+	for _, g := range s.Geomeans {
+		means = append(means, fmt.Sprintf("%s %+.2f%%", g.Unit, g.Delta))
+		improved += g.Improved
+		regressed += g.Regressed
+		unchanged += g.Unchanged
+	}
+	headline := fmt.Sprintf("geomean: %s; %d improved, %d regressed, %d unchanged", strings.Join(means, ", "), improved, regressed, unchanged)
+	if s.Threshold > 0 {
+		headline += fmt.Sprintf("; %d above the %g%% threshold", len(s.Violations), s.Threshold)
+	}
+	return headline
+}
+
+// missing returns the lines listing the benchmarks only found on one side,
+// empty if none.
+func (s *summary) missing() string {
+	var sb strings.Builder
+	if len(s.Removed) > 0 {
+		fmt.Fprintf(&sb, "Only in %s (removed or renamed): %s\n", s.Base, strings.Join(s.Removed, ", "))
+	}
+	if len(s.Added) > 0 {
+		fmt.Fprintf(&sb, "Only in %s (added or renamed): %s\n", s.Current, strings.Join(s.Added, ", "))
+	}
+	return sb.String()
+}
+
+// formatComparison formats c on one line, e.g.
+// "BenchmarkFoo ns/op 100 => 110 (+10.00%, p=0.029)".
+func formatComparison(c comparison) string {
+	delta := "~"
+	if c.Significant {
+		delta = fmt.Sprintf("%+.2f%%", c.Delta)
+	}
+	if c.Exact {
+		return fmt.Sprintf("%s %s %.4g => %.4g (%s, exact)", c.Name, c.Unit, c.OldMean, c.NewMean, delta)
+	}
+	return fmt.Sprintf("%s %s %.4g => %.4g (%s, p=%.3f)", c.Name, c.Unit, c.OldMean, c.NewMean, delta, c.P)
+}
+
+// renderHTML renders s as a standalone HTML page.
+func renderHTML(s *summary) (string, error) {
+	var buf bytes.Buffer
+	if err := htmlReportTemplate.Execute(&buf, s); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>gobench: {{ .Base }} vs {{ .Current }}</title></head>
+<body>
+<h1>{{ .Base }} vs {{ .Current }}</h1>
+<p>{{ .Headline }}</p>
+{{ with .Violations }}<p><strong>{{ len . }} regressions above the {{ $.Threshold }}% threshold.</strong></p>{{ end }}
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Benchmark</th><th>Unit</th><th>{{ .Base }}</th><th>{{ .Current }}</th><th>Delta</th><th>p</th></tr>
+{{ range .Comparisons }}<tr><td>{{ .Name }}</td><td>{{ .Unit }}</td><td>{{ printf "%.4g" .OldMean }}</td><td>{{ printf "%.4g" .NewMean }}</td><td>{{ if .Significant }}{{ printf "%+.2f%%" .Delta }}{{ else }}~{{ end }}</td><td>{{ printf "%.3f" .P }}</td></tr>
+{{ end }}</table>
+{{ range .RunNotes }}<p>{{ . }}</p>
+{{ end }}<pre>{{ .Report }}</pre>
+</body>
+</html>
+`))
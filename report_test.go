@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestSummary(t *testing.T) *summary {
+	bf1, err := parseBenchFile(strings.NewReader(`BenchmarkA-4	10	100 ns/op	16 B/op
+BenchmarkA-4	10	101 ns/op	16 B/op
+BenchmarkA-4	10	102 ns/op	16 B/op
+BenchmarkA-4	10	103 ns/op	16 B/op
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bf2, err := parseBenchFile(strings.NewReader(`BenchmarkA-4	10	150 ns/op	16 B/op
+BenchmarkA-4	10	151 ns/op	16 B/op
+BenchmarkA-4	10	152 ns/op	16 B/op
+BenchmarkA-4	10	153 ns/op	16 B/op
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSummary("base", "current", bf1, bf2, nil)
+	s.applyThreshold(10, nil)
+	return s
+}
+
+func TestRenderTAP(t *testing.T) {
+	out := renderTAP(newTestSummary(t))
+
+	assertContainsAll(t, out,
+		"TAP version 13\n1..2\n",
+		"ok 1 - BenchmarkA-4 B/op 16 => 16 (~, p=1.000)",
+		"not ok 2 - BenchmarkA-4 ns/op 101.5 => 151.5 (+49.26%, p=0.029)",
+		"# geomean: B/op +0.00%, ns/op +49.26%")
+}
+
+func TestWriteJUnit(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "junit.xml")
+	if err := writeJUnit(filename, newTestSummary(t)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertContainsAll(t, string(b),
+		`<testsuite name="gobench base vs current" tests="1" failures="1">`,
+		`<failure message="regressed more than 10%: ns/op +49.26%">`)
+}
+
+func TestRenderTeamCity(t *testing.T) {
+	out := renderTeamCity(newTestSummary(t))
+
+	assertContainsAll(t, out,
+		"##teamcity[testSuiteStarted name='gobench base vs current']",
+		"##teamcity[buildStatisticValue key='gobench.BenchmarkA-4.ns/op' value='151.5']",
+		"##teamcity[testFailed name='BenchmarkA-4 ns/op' message='regressed more than 10%'",
+		"##teamcity[buildStatisticValue key='gobench.geomean.ns/op.delta' value='49.2611']")
+
+	if got := teamCityEscape("a|b'[c]\n"); got != "a||b|'|[c|]|n" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	out := renderMarkdown(newTestSummary(t))
+
+	assertContainsAll(t, out,
+		"### base vs current",
+		"geomean: B/op +0.00%, ns/op +49.26%; 0 improved, 1 regressed, 1 unchanged; 1 above the 10% threshold",
+		"| BenchmarkA-4 | ns/op | 101.5 | 151.5 | **+49.26%** | 0.029 |")
+}
+
+func TestRunNotes(t *testing.T) {
+	s := newTestSummary(t)
+	if notes := s.RunNotes(); len(notes) != 0 {
+		t.Fatalf("expected no notes, got %v", notes)
+	}
+
+	r := runner{}
+	r.state = newRunState(r.config, "base", "current")
+	r.state.retried("base")
+	r.state.retried("base")
+	r.state.throttled("current")
+	r.addRunCounts(s, "base", "current")
+
+	assertContainsAll(t, renderMarkdown(s),
+		"#### Retries",
+		`- 2 failed runs for "base" were retried.`,
+		`- 1 runs for "current" were throttled.`)
+	assertContainsAll(t, renderTAP(s), `# 2 failed runs for "base" were retried.`)
+	assertContainsAll(t, renderTeamCity(s), "##teamcity[message text='1 runs for \"current\" were throttled.' status='WARNING']")
+	page, err := renderHTML(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContainsAll(t, page, "<p>2 failed runs for &#34;base&#34; were retried.</p>")
+	out, err := renderReport("json", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContainsAll(t, out, `"retries": {`, `"base": 2`, `"throttled": {`)
+}
+
+func TestRenderMarkdownUnmatched(t *testing.T) {
+	s := newTestSummary(t)
+	s.Removed = []string{"BenchmarkGone-4"}
+	out := renderMarkdown(s)
+
+	assertContainsAll(t, out, "#### Removed\n\nOnly in base, removed or renamed:\n\n- BenchmarkGone-4\n")
+	assertNotContainsAll(t, out, "#### Added")
+}
+
+func TestRenderMarkdownGroups(t *testing.T) {
+	bf1, _ := parseBenchFile(strings.NewReader(`BenchmarkFoo/size=1K-4	10	100 ns/op
+BenchmarkFoo/size=1M-4	10	400 ns/op
+`))
+	bf2, _ := parseBenchFile(strings.NewReader(`BenchmarkFoo/size=1K-4	10	200 ns/op
+BenchmarkFoo/size=1M-4	10	800 ns/op
+`))
+	s := newSummary("base", "current", bf1, bf2, nil)
+
+	out := renderMarkdown(s)
+	assertContainsAll(t, out,
+		"| **BenchmarkFoo** (geomean) | ns/op | | | +100.00% | |",
+		"| BenchmarkFoo/size=1M-4 | ns/op |")
+
+	s.Collapse = true
+	if out := renderMarkdown(s); strings.Contains(out, "size=1K") {
+		t.Fatalf("expected collapsed sub-benchmarks, got\n%s", out)
+	}
+}
+
+func TestRenderMarkdownNoise(t *testing.T) {
+	bf1, _ := parseBenchFile(strings.NewReader(`BenchmarkNoisy	10	80 ns/op
+BenchmarkNoisy	10	81 ns/op
+BenchmarkNoisy	10	82 ns/op
+BenchmarkNoisy	10	120 ns/op
+BenchmarkNoisy	10	83 ns/op
+BenchmarkNoisy	10	84 ns/op
+`))
+	bf2, _ := parseBenchFile(strings.NewReader(`BenchmarkNoisy	10	85 ns/op
+BenchmarkNoisy	10	86 ns/op
+BenchmarkNoisy	10	87 ns/op
+BenchmarkNoisy	10	125 ns/op
+BenchmarkNoisy	10	88 ns/op
+BenchmarkNoisy	10	89 ns/op
+`))
+	s := newSummary("base", "current", bf1, bf2, nil)
+	if len(s.noisy()) != 1 {
+		t.Fatalf("expected a noisy result, got %+v", s.Comparisons)
+	}
+	assertContainsAll(t, renderMarkdown(s),
+		"| Delta | p | 95% CI |",
+		"| BenchmarkNoisy | ns/op | 88.33 | 93.33 | +5.66% | 0.041 | ±22.68% |",
+		"#### Noisy",
+		"- BenchmarkNoisy ns/op: +5.66% ±22.68%, CV 17.6%")
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type reportCmd struct {
+	Dir string `arg:"positional,required" help:"the --outdir of a previous run"`
+}
+
+// runReport regenerates the report for a previous run from the result
+// files and the run state in its out dir, in the format given by --format.
+// No benchmarks are run.
+func (r runner) runReport() error {
+	filename := filepath.Join(r.Report.Dir, stateFilename)
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no run state found in %s", r.Report.Dir)
+		}
+		return err
+	}
+	var state runState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return fmt.Errorf("failed to read %s: %s", filename, err)
+	}
+	if state.Second == "" {
+		return fmt.Errorf("no results recorded in %s", filename)
+	}
+
+	r.OutDir, err = filepath.Abs(r.Report.Dir)
+	if err != nil {
+		return err
+	}
+	r.state = &state
+
+	if state.First != "" && r.Format == "text" {
+		fmt.Printf("Report %q vs %q from %s.\n\n", state.First, state.Second, r.OutDir)
+	}
+
+	return r.runBenchStat(state.First, state.Second)
+}
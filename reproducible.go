@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const reproducibilityFilename = "reproducibility.json"
+
+// moduleEnvKeys are the environment variables that affect module resolution
+// and the toolchain used.
+var moduleEnvKeys = []string{"GOFLAGS", "GOPROXY", "GONOPROXY", "GONOSUMCHECK", "GONOSUMDB", "GOPRIVATE", "GOSUMDB", "GOINSECURE", "GOWORK", "GOTOOLCHAIN"}
+
+// reproducibility is the module environment recorded for a run.
+type reproducibility struct {
+	Env  map[string]string `json:"env"`
+	Refs []moduleFiles     `json:"refs"`
+}
+
+// moduleFiles holds the checksums of the module files for a ref.
+type moduleFiles struct {
+	Ref   string `json:"ref"`
+	GoMod string `json:"gomod"`
+	GoSum string `json:"gosum"`
+
+	// GoWork is the checksum of the go.work file in the repository in use,
+	// if any.
+	GoWork string `json:"gowork,omitempty"`
+}
+
+// checkReproducible records the module environment and the go.mod and go.sum
+// state for the base (a git ref) and the current working tree, and fails if
+// they differ. The module environment is pinned for all benchmark runs.
+func (r *runner) checkReproducible(baseRef string) error {
+	for _, env := range append(append(r.Env, r.EnvBase...), r.EnvCurrent...) {
+		key := strings.SplitN(env, "=", 2)[0]
+		if contains(moduleEnvKeys, key) {
+			return fmt.Errorf("%s can not be set per run in reproducible mode", key)
+		}
+	}
+
+	args := append([]string{"env", "-json"}, moduleEnvKeys...)
+	output, err := exec.Command(goExe, args...).Output()
+	if err != nil {
+		return fmt.Errorf("failed to read go env: %s", err)
+	}
+	rep := reproducibility{}
+	if err := json.Unmarshal(output, &rep.Env); err != nil {
+		return err
+	}
+
+	current, err := readModuleFiles("")
+	if err != nil {
+		return err
+	}
+	rep.Refs = append(rep.Refs, current)
+
+	if baseRef != "" {
+		base, err := readModuleFiles(baseRef)
+		if err != nil {
+			return err
+		}
+		rep.Refs = append([]moduleFiles{base}, rep.Refs...)
+	}
+
+	b, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(r.OutDir, reproducibilityFilename), b, 0o644); err != nil {
+		return err
+	}
+
+	if baseRef != "" {
+		base := rep.Refs[0]
+		if base.GoMod != current.GoMod {
+			return fmt.Errorf("go.mod differs between %q and the current tree; measured deltas may be caused by dependency changes", baseRef)
+		}
+		if base.GoSum != current.GoSum {
+			return fmt.Errorf("go.sum differs between %q and the current tree; measured deltas may be caused by dependency changes", baseRef)
+		}
+		if base.GoWork != current.GoWork {
+			return fmt.Errorf("go.work differs between %q and the current tree; measured deltas may be caused by dependency changes", baseRef)
+		}
+	}
+
+	// Pin the module environment for all runs. A go.work in the repository
+	// is left to be found per ref, as pinning it would point the base
+	// worktree at the modules in the current tree.
+	var pinned []string
+	for _, key := range moduleEnvKeys {
+		if key == "GOWORK" && current.GoWork != "" {
+			continue
+		}
+		pinned = append(pinned, key+"="+rep.Env[key])
+	}
+	r.Env = append(pinned, r.Env...)
+
+	fmt.Println("Module environment recorded in", reproducibilityFilename)
+
+	return nil
+}
+
+// readModuleFiles reads the go.mod and go.sum checksums for ref,
+// or the working tree if ref is empty.
+func readModuleFiles(ref string) (moduleFiles, error) {
+	mf := moduleFiles{Ref: ref}
+	if ref == "" {
+		mf.Ref = "working tree"
+	}
+
+	output, err := exec.Command(goExe, "env", "GOMOD").Output()
+	if err != nil {
+		return mf, fmt.Errorf("failed to find go.mod: %s", err)
+	}
+	gomod := strings.TrimSpace(string(output))
+	if gomod == "" || gomod == os.DevNull {
+		return mf, fmt.Errorf("no go.mod found")
+	}
+
+	output, err = exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return mf, fmt.Errorf("failed to resolve git root: %s", err)
+	}
+	toplevel := strings.TrimSpace(string(output))
+
+	// read returns the checksum of the file at filename in the working tree
+	// or ref, empty if it doesn't exist.
+	read := func(filename string) (string, error) {
+		rel, err := filepath.Rel(toplevel, filename)
+		if err != nil {
+			return "", err
+		}
+		var b []byte
+		if ref == "" {
+			if b, err = os.ReadFile(filename); os.IsNotExist(err) {
+				return "", nil
+			}
+		} else {
+			b, err = gitShowFile(ref, filepath.ToSlash(rel))
+			if err == errFileNotInRef {
+				return "", nil
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(b)
+		return hex.EncodeToString(sum[:]), nil
+	}
+
+	if mf.GoMod, err = read(gomod); err != nil {
+		return mf, err
+	}
+	// A missing go.sum is fine, e.g. for modules without dependencies.
+	if mf.GoSum, err = read(filepath.Join(filepath.Dir(gomod), "go.sum")); err != nil {
+		return mf, err
+	}
+
+	output, err = exec.Command(goExe, "env", "GOWORK").Output()
+	if err != nil {
+		return mf, fmt.Errorf("failed to read go env: %s", err)
+	}
+	if gowork := strings.TrimSpace(string(output)); gowork != "" && gowork != "off" {
+		if rel, err := filepath.Rel(toplevel, gowork); err == nil && !strings.HasPrefix(rel, "..") {
+			if mf.GoWork, err = read(gowork); err != nil {
+				return mf, err
+			}
+		}
+	}
+
+	return mf, nil
+}
+
+// errFileNotInRef is returned by gitShowFile if the file doesn't exist in
+// the ref.
+var errFileNotInRef = errors.New("file not in ref")
+
+// gitShowFile returns the content of the file at path, relative to the
+// repository root, in ref.
+func gitShowFile(ref, path string) ([]byte, error) {
+	cmd := exec.Command("git", "show", ref+":"+path)
+	// The messages checked for below are translated.
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	b, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(msg, "does not exist in") || strings.Contains(msg, "exists on disk, but not in") {
+			return nil, errFileNotInRef
+		}
+		return nil, fmt.Errorf("git show %s:%s: %s: %s", ref, path, err, msg)
+	}
+	return b, nil
+}
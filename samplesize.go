@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// The normal quantiles for a two-sided test at the 95% confidence level
+// and 80% power.
+const (
+	zConfidence = 1.959964
+	zPower      = 0.841621
+)
+
+// mannWhitneyEfficiency is the asymptotic relative efficiency of the
+// Mann-Whitney U-test to the t-test for normal samples, 3/π. It needs about
+// 5% more samples to detect the same change.
+const mannWhitneyEfficiency = 3 / math.Pi
+
+// maxRecommendedCount caps the recommended counts, beyond it the benchmark
+// is too noisy to detect the change in reasonable time.
+const maxRecommendedCount = 100
+
+// stddev returns the sample standard deviation of values.
+func stddev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	m := mean(values)
+	var sum float64
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+// cv returns the pooled coefficient of variation of the samples in c, the
+// standard deviation relative to the base mean.
+func (c comparison) cv() float64 {
+	n1, n2 := len(c.Old), len(c.New)
+	if n1+n2 < 3 || c.OldMean == 0 {
+		return 0
+	}
+	s1, s2 := stddev(c.Old), stddev(c.New)
+	pooled := (s1*s1*float64(n1-1) + s2*s2*float64(n2-1)) / float64(n1+n2-2)
+	return math.Sqrt(pooled) / math.Abs(c.OldMean)
+}
+
+// requiredCount returns the count per ref needed to detect a change of
+// delta percent with the variation cv, at least minBudgetCount, the
+// smallest count where the U-test can be significant at all.
+func requiredCount(cv, delta float64) int {
+	d := delta / 100
+	z := zConfidence + zPower
+	n := int(math.Ceil(2 * z * z * cv * cv / (d * d) / mannWhitneyEfficiency))
+	if n < minBudgetCount {
+		return minBudgetCount
+	}
+	if n > maxRecommendedCount {
+		return maxRecommendedCount
+	}
+	return n
+}
+
+// applyPower sets the count needed to detect a change of delta percent for
+// each comparison, and the max of them as the recommended count.
+func (s *summary) applyPower(delta float64) {
+	s.PowerDelta = delta
+	if delta <= 0 {
+		return
+	}
+	for i, c := range s.Comparisons {
+		if c.Exact {
+			continue
+		}
+		n := requiredCount(c.cv(), delta)
+		s.Comparisons[i].RecommendedCount = n
+		if n > s.RecommendedCount {
+			s.RecommendedCount = n
+		}
+	}
+}
+
+// countAdvice returns the benchmarks that ran with too low a count to
+// detect a --power-delta change and the suggested count, as a markdown list
+// if markdown is set. It's empty without --power-delta.
+func (s *summary) countAdvice(markdown bool) string {
+	if s.PowerDelta <= 0 {
+		return ""
+	}
+	var sb strings.Builder
+	intro := fmt.Sprintf("Counts needed to detect a %g%% change (95%% confidence, 80%% power):", s.PowerDelta)
+	prefix := "  "
+	if markdown {
+		fmt.Fprintf(&sb, "\n#### Counts\n\n%s\n\n", intro)
+		prefix = "- "
+	} else {
+		fmt.Fprintf(&sb, "\n%s\n", intro)
+	}
+	var n int
+	for _, c := range s.Comparisons {
+		count := len(c.Old)
+		if len(c.New) < count {
+			count = len(c.New)
+		}
+		if c.RecommendedCount <= count {
+			continue
+		}
+		needed := fmt.Sprint(c.RecommendedCount)
+		if c.RecommendedCount == maxRecommendedCount {
+			needed = fmt.Sprintf("more than %d", maxRecommendedCount)
+		}
+		fmt.Fprintf(&sb, "%s%s %s: %s (ran %d, CV %.1f%%)\n", prefix, c.Name, c.Unit, needed, count, c.cv()*100)
+		n++
+	}
+	if n == 0 {
+		fmt.Fprintf(&sb, "%sThe counts were enough for all benchmarks.\n", prefix)
+		return sb.String()
+	}
+	if markdown {
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "Suggested --count for next time: %d", s.RecommendedCount)
+	if s.RecommendedCount == maxRecommendedCount {
+		sb.WriteString(", but some benchmarks are too noisy to detect the change, e.g. try --lock-env")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRequiredCount(t *testing.T) {
+	for _, test := range []struct {
+		cv, delta float64
+		want      int
+	}{
+		{0, 2, minBudgetCount},
+		{0.005, 2, minBudgetCount},
+		{0.02, 2, 17},
+		{0.02, 5, minBudgetCount},
+		{0.5, 2, maxRecommendedCount},
+	} {
+		if got := requiredCount(test.cv, test.delta); got != test.want {
+			t.Errorf("requiredCount(%g, %g) = %d, want %d", test.cv, test.delta, got, test.want)
+		}
+	}
+}
+
+func TestCountAdvice(t *testing.T) {
+	noisy := comparison{Name: "BenchmarkNoisy", Unit: "ns/op", Old: []float64{90, 100, 110, 100}, New: []float64{95, 105, 100, 100}}
+	stable := comparison{Name: "BenchmarkStable", Unit: "ns/op", Old: []float64{100, 100, 100, 100}, New: []float64{101, 101, 101, 101}}
+	for _, c := range []*comparison{&noisy, &stable} {
+		c.OldMean, c.NewMean = mean(c.Old), mean(c.New)
+	}
+	if cv := noisy.cv(); math.Abs(cv-0.0645) > 0.001 {
+		t.Errorf("got CV %g", cv)
+	}
+
+	s := &summary{Comparisons: []comparison{noisy, stable}}
+	s.applyPower(5)
+	if got := s.countAdvice(false); !strings.Contains(got, "BenchmarkNoisy ns/op: 28 (ran 4, CV 6.5%)") || strings.Contains(got, "BenchmarkStable") || !strings.Contains(got, "Suggested --count for next time: 28\n") {
+		t.Errorf("got %q", got)
+	}
+
+	s = &summary{Comparisons: []comparison{stable}}
+	s.applyPower(5)
+	if got := s.countAdvice(true); !strings.Contains(got, "- The counts were enough for all benchmarks.") {
+		t.Errorf("got %q", got)
+	}
+
+	if got := (&summary{}).countAdvice(false); got != "" {
+		t.Errorf("expected no advice without --power-delta, got %q", got)
+	}
+}
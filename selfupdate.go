@@ -0,0 +1,267 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// latestReleaseURL is the GitHub API endpoint for the latest release.
+const latestReleaseURL = "https://api.github.com/repos/bep/gobench/releases/latest"
+
+type selfUpdateCmd struct{}
+
+type release struct {
+	TagName string `json:"tag_name"`
+	Body    string `json:"body"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// assetURL returns the download URL of the asset with the given name suffix.
+func (r release) assetURL(suffix string) (string, string, bool) {
+	for _, a := range r.Assets {
+		if strings.HasSuffix(a.Name, suffix) {
+			return a.Name, a.URL, true
+		}
+	}
+	return "", "", false
+}
+
+func latestRelease() (release, error) {
+	return latestReleaseWith(httpClient)
+}
+
+func latestReleaseWith(client *http.Client) (release, error) {
+	var rel release
+	resp, err := client.Get(latestReleaseURL)
+	if err != nil {
+		return rel, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rel, fmt.Errorf("failed to get the latest release: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return rel, err
+	}
+	return rel, nil
+}
+
+// newerVersion reports whether the version v1 is newer than v2, both on
+// the form v1.2.3. Pre-release and build suffixes are ignored.
+func newerVersion(v1, v2 string) bool {
+	p1, p2 := versionParts(v1), versionParts(v2)
+	for i := range p1 {
+		if p1[i] != p2[i] {
+			return p1[i] > p2[i]
+		}
+	}
+	return false
+}
+
+func versionParts(v string) [3]int {
+	var parts [3]int
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i != -1 {
+		v = v[:i]
+	}
+	for i, s := range strings.SplitN(v, ".", 3) {
+		parts[i], _ = strconv.Atoi(s)
+	}
+	return parts
+}
+
+// runSelfUpdate replaces the running binary with the one from the latest
+// GitHub release, if newer, after verifying its SHA-256 checksum against the
+// checksums file published with the release. The checksums file must be
+// signed with the release key, or anyone able to replace the archive could
+// replace the checksums as well.
+func runSelfUpdate() error {
+	rel, err := latestRelease()
+	if err != nil {
+		return err
+	}
+	if !newerVersion(rel.TagName, version) {
+		fmt.Printf("gobench %s is up to date.\n", version)
+		return nil
+	}
+
+	ext := ".tar.gz"
+	if runtime.GOOS == "windows" {
+		ext = ".zip"
+	}
+	archiveName, archiveURL, found := rel.assetURL(fmt.Sprintf("_%s_%s%s", runtime.GOOS, runtime.GOARCH, ext))
+	if !found {
+		return fmt.Errorf("no %s/%s build found in release %s", runtime.GOOS, runtime.GOARCH, rel.TagName)
+	}
+	_, checksumsURL, found := rel.assetURL("_checksums.txt")
+	if !found {
+		return fmt.Errorf("no checksums found in release %s", rel.TagName)
+	}
+	_, signatureURL, found := rel.assetURL("_checksums.txt.sig")
+	if !found {
+		return fmt.Errorf("no checksums signature found in release %s", rel.TagName)
+	}
+
+	fmt.Printf("Update gobench %s to %s from %s\n", version, rel.TagName, archiveURL)
+	archive, err := download(archiveURL)
+	if err != nil {
+		return err
+	}
+	checksums, err := download(checksumsURL)
+	if err != nil {
+		return err
+	}
+	signature, err := download(signatureURL)
+	if err != nil {
+		return err
+	}
+	if err := verifySSHSignature(releasePublicKey, releaseSignatureNamespace, checksums, signature); err != nil {
+		return fmt.Errorf("failed to verify the checksums of release %s: %s", rel.TagName, err)
+	}
+	if err := verifyChecksum(archiveName, archive, checksums); err != nil {
+		return err
+	}
+
+	binary, err := extractBinary(archiveName, archive)
+	if err != nil {
+		return err
+	}
+	if err := replaceExecutable(binary); err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated to gobench %s.\n", rel.TagName)
+	return nil
+}
+
+func download(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// verifyChecksum verifies the SHA-256 checksum of the named file against
+// the checksums file, with lines on the form "<hex sum>  <name>".
+func verifyChecksum(name string, b, checksums []byte) error {
+	sum := sha256.Sum256(b)
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[1] != name {
+			continue
+		}
+		if fields[0] != hex.EncodeToString(sum[:]) {
+			return fmt.Errorf("checksum mismatch for %s", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("no checksum found for %s", name)
+}
+
+// extractBinary extracts the gobench binary from the release archive.
+func extractBinary(name string, archive []byte) ([]byte, error) {
+	binaryName := "gobench"
+	if runtime.GOOS == "windows" {
+		binaryName += ".exe"
+	}
+
+	if strings.HasSuffix(name, ".zip") {
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if path.Base(f.Name) != binaryName {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(rc)
+		}
+		return nil, fmt.Errorf("%s not found in %s", binaryName, name)
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in %s", binaryName, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg && path.Base(hdr.Name) == binaryName {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// replaceExecutable replaces the running executable with binary. The new
+// binary is written next to it and renamed into place, so a failure leaves
+// the old binary intact.
+func replaceExecutable(binary []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	tmp := exe + ".new"
+	if err := os.WriteFile(tmp, binary, 0o755); err != nil {
+		return fmt.Errorf("failed to write the new binary, check that you have write access to %s: %s", filepath.Dir(exe), err)
+	}
+
+	if runtime.GOOS == "windows" {
+		// A running executable can not be replaced on Windows, but it
+		// can be renamed.
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+
+	if err := os.Rename(tmp, exe); err != nil {
+		os.Remove(tmp)
+		if runtime.GOOS == "windows" {
+			// Put the old binary back.
+			os.Rename(exe+".old", exe)
+		}
+		return fmt.Errorf("failed to replace %s: %s", exe, err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestNewerVersion(t *testing.T) {
+	for _, test := range []struct {
+		v1, v2   string
+		expected bool
+	}{
+		{"v0.6.0", "v0.5", true},
+		{"v0.5.1", "v0.5.0", true},
+		{"v0.5.0", "v0.5", false},
+		{"v0.10.0", "v0.9.3", true},
+		{"v0.4.9", "v0.5.0", false},
+		{"v1.0.0-rc1", "v0.9.0", true},
+	} {
+		if got := newerVersion(test.v1, test.v2); got != test.expected {
+			t.Errorf("newerVersion(%q, %q) = %t", test.v1, test.v2, got)
+		}
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	b := []byte("gobench")
+	sum := sha256.Sum256(b)
+	checksums := []byte("0000  gobench_0.6.0_linux_arm64.tar.gz\n" + hex.EncodeToString(sum[:]) + "  gobench_0.6.0_linux_amd64.tar.gz\n")
+	if err := verifyChecksum("gobench_0.6.0_linux_amd64.tar.gz", b, checksums); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyChecksum("gobench_0.6.0_linux_arm64.tar.gz", b, checksums); err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+	if err := verifyChecksum("gobench_0.6.0_darwin_amd64.tar.gz", b, checksums); err == nil {
+		t.Fatal("expected missing checksum")
+	}
+}
+
+func TestVerifySSHSignature(t *testing.T) {
+	// Made with ssh-keygen -Y sign -n gobench-release and the release key.
+	const sig = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgzSwoycHCyWvqdc+53MlD6UBN+I
+b11JYOdagEt+bzRTYAAAAPZ29iZW5jaC1yZWxlYXNlAAAAAAAAAAZzaGE1MTIAAABTAAAA
+C3NzaC1lZDI1NTE5AAAAQLdYyjPGQ1t+ybdjTamU1h7UQE7aZygX8I+lJW/lXlQi44fGHh
+tVQtWgPIC5iCn/AOv+s3xeEih1h67p9UVcQw4=
+-----END SSH SIGNATURE-----
+`
+	checksums := []byte("abc  gobench_1_linux_amd64.tar.gz\n")
+	if err := verifySSHSignature(releasePublicKey, releaseSignatureNamespace, checksums, []byte(sig)); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySSHSignature(releasePublicKey, releaseSignatureNamespace, []byte("def  gobench_1_linux_amd64.tar.gz\n"), []byte(sig)); err == nil {
+		t.Fatal("expected invalid signature for tampered checksums")
+	}
+	if err := verifySSHSignature(releasePublicKey, "file", checksums, []byte(sig)); err == nil {
+		t.Fatal("expected namespace mismatch")
+	}
+	const otherKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPNakxWVfwT4fKC+CgMeRHW1kN1oSZ3mEXtSbOU5IC+p other"
+	if err := verifySSHSignature(otherKey, releaseSignatureNamespace, checksums, []byte(sig)); err == nil {
+		t.Fatal("expected key mismatch")
+	}
+}
+
+func TestChangelogHighlights(t *testing.T) {
+	got := changelogHighlights("## Changelog\n* abc123 Fix typo\n* def456 Add `--plots` to show box plots\n- Add --charts\n")
+	if len(got) != 2 || got[0] != "def456 Add `--plots` to show box plots" || got[1] != "Add --charts" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The baseline server protocol is plain HTTP with the results in the Go
+// benchmark format:
+//
+//	PUT {server}/v1/baselines/{branch}/{commit}  store the results for commit
+//	GET {server}/v1/baselines/{branch}/{commit}  get the results for commit
+//	GET {server}/v1/baselines/{branch}/latest    get the last stored results
+//
+// Signed results are stored with a manifest at the results URL with a
+// .manifest suffix, and its signature with a .manifest.sig suffix. The
+// manifest holds the branch, commit and SHA-256 checksum of the results, so
+// results signed for one branch or commit can't be served for another. The
+// branch and commit are path escaped. With --server-token, requests are sent
+// with it as a bearer token.
+
+// baselineManifest is the signed manifest of results on the server.
+type baselineManifest struct {
+	Branch string `json:"branch"`
+	Commit string `json:"commit"`
+	SHA256 string `json:"sha256"`
+}
+
+type pushCmd struct {
+	Dir    string `arg:"positional,required" help:"the --outdir of the run to push the current results of"`
+	Branch string `help:"the branch to store the results for. Defaults to the current ref of the run"`
+	Commit string `help:"the commit to store the results for. Defaults to the current commit of the run"`
+}
+
+// baselineURL returns the URL of the results for branch and commit on the
+// --server.
+func (c config) baselineURL(branch, commit string) string {
+	return fmt.Sprintf("%s/v1/baselines/%s/%s", strings.TrimSuffix(c.Server, "/"), url.PathEscape(branch), url.PathEscape(commit))
+}
+
+// serverRequest sends a request to the baseline server.
+func (c config) serverRequest(method, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if c.ServerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.ServerToken)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return resp, nil
+}
+
+// serverGet returns the body of a GET request to the baseline server.
+func (c config) serverGet(url string) ([]byte, error) {
+	resp, err := c.serverRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// runPush stores the current results of a previous run on the --server.
+func (r runner) runPush() error {
+	dir, err := filepath.Abs(r.Push.Dir)
+	if err != nil {
+		return err
+	}
+	rs := readSummaryJSON(filepath.Join(dir, summaryFilename), time.Time{})
+	if rs == nil || rs.Current == "" {
+		return fmt.Errorf("no results found in %s", dir)
+	}
+	branch, commit := r.Push.Branch, r.Push.Commit
+	if branch == "" {
+		branch = rs.Current
+	}
+	if commit == "" {
+		commit = rs.CurrentCommit
+	}
+	if commit == "" {
+		return fmt.Errorf("the results in %s are not for a commit, set --commit", dir)
+	}
+
+	r.OutDir = dir
+	filename := r.benchOutFilename(rs.Current)
+	endpoint := r.baselineURL(branch, commit)
+	uploads := []struct{ filename, url string }{{filename, endpoint}}
+	if r.SignKey != "" {
+		manifest, err := writeBaselineManifest(filename, branch, commit)
+		if err != nil {
+			return err
+		}
+		if err := signFile(r.SignTool, r.SignKey, manifest); err != nil {
+			return err
+		}
+		uploads = append(uploads,
+			struct{ filename, url string }{manifest, endpoint + ".manifest"},
+			struct{ filename, url string }{manifest + ".sig", endpoint + ".manifest.sig"},
+		)
+	}
+
+	for _, upload := range uploads {
+		f, err := os.Open(upload.filename)
+		if err != nil {
+			return err
+		}
+		resp, err := r.serverRequest("PUT", upload.url, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	fmt.Printf("Pushed the results for %s (%s) to %s.\n", branch, commit, endpoint)
+	return nil
+}
+
+// writeBaselineManifest writes the manifest of the results in filename for
+// branch and commit next to it and returns its filename.
+func writeBaselineManifest(filename, branch, commit string) (string, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	manifest, err := json.Marshal(baselineManifest{Branch: branch, Commit: commit, SHA256: hex.EncodeToString(sum[:])})
+	if err != nil {
+		return "", err
+	}
+	manifestFilename := filename + ".manifest.json"
+	return manifestFilename, os.WriteFile(manifestFilename, append(manifest, '\n'), 0o644)
+}
+
+// pullBaseline downloads the results for the --base-from-server spec, a
+// branch with an optional @commit, to --outdir and returns the filename.
+// With --verify-key, the results must match a manifest signed for the
+// branch, and the commit if set.
+func (r runner) pullBaseline(spec string) (string, error) {
+	branch, commit := spec, "latest"
+	if i := strings.LastIndex(spec, "@"); i > 0 {
+		branch, commit = spec[:i], spec[i+1:]
+	}
+	endpoint := r.baselineURL(branch, commit)
+	b, err := r.serverGet(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(r.OutDir, baseFilesDir)
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return "", err
+	}
+	filename := filepath.Join(dir, r.benchOutName(branch))
+	if r.VerifyKey != "" {
+		if commit, err = r.verifyBaseline(endpoint, filename, branch, commit, b); err != nil {
+			return "", err
+		}
+	}
+	if err := os.WriteFile(filename, b, 0o644); err != nil {
+		return "", err
+	}
+	fmt.Printf("Downloaded the %s results for %s from %s.\n", commit, branch, endpoint)
+	return filename, nil
+}
+
+// verifyBaseline downloads the manifest of the results b at endpoint and
+// its signature next to filename, verifies it with --verify-key and checks
+// that it's for the results, branch and commit, if not latest. It returns
+// the commit in the manifest.
+func (r runner) verifyBaseline(endpoint, filename, branch, commit string, b []byte) (string, error) {
+	manifest, err := r.serverGet(endpoint + ".manifest")
+	if err != nil {
+		return "", fmt.Errorf("no manifest for the results: %s", err)
+	}
+	sig, err := r.serverGet(endpoint + ".manifest.sig")
+	if err != nil {
+		return "", fmt.Errorf("no signature for the results: %s", err)
+	}
+	manifestFilename := filename + ".manifest.json"
+	if err := os.WriteFile(manifestFilename, manifest, 0o644); err != nil {
+		return "", err
+	}
+	if err := r.verifyDownload(manifestFilename, sig); err != nil {
+		return "", err
+	}
+
+	var m baselineManifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return "", fmt.Errorf("invalid manifest for the results: %s", err)
+	}
+	if m.Branch != branch {
+		return "", fmt.Errorf("the results are signed for branch %q, not %q", m.Branch, branch)
+	}
+	if commit != "latest" && m.Commit != commit {
+		return "", fmt.Errorf("the results are signed for commit %q, not %q", m.Commit, commit)
+	}
+	if sum := sha256.Sum256(b); !strings.EqualFold(m.SHA256, hex.EncodeToString(sum[:])) {
+		return "", errors.New("the results don't match the checksum in the signed manifest")
+	}
+	return m.Commit, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPushAndPullBaseline(t *testing.T) {
+	stored := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(req.URL.EscapedPath(), "/v1/baselines/"), "/")
+		switch req.Method {
+		case "PUT":
+			b, _ := io.ReadAll(req.Body)
+			stored[req.URL.EscapedPath()] = string(b)
+			suffix := strings.TrimPrefix(parts[1], strings.SplitN(parts[1], ".", 2)[0])
+			stored["/v1/baselines/"+parts[0]+"/latest"+suffix] = string(b)
+		case "GET":
+			b, found := stored[req.URL.EscapedPath()]
+			if !found {
+				http.NotFound(w, req)
+				return
+			}
+			io.WriteString(w, b)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	content := "BenchmarkFoo 100 10 ns/op\n"
+	if err := os.WriteFile(filepath.Join(dir, "feature-x.bench"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	summary := `{"currentCommit": "abc123", "passed": true, "current": "feature/x"}`
+	if err := os.WriteFile(filepath.Join(dir, summaryFilename), []byte(summary), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := config{Server: srv.URL, ServerToken: "secret"}
+	r := runner{config: c}
+	r.Push = &pushCmd{Dir: dir}
+	if err := r.runPush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := stored["/v1/baselines/feature%2Fx/abc123"]; got != content {
+		t.Fatalf("stored %q", stored)
+	}
+
+	r = runner{config: c}
+	r.OutDir = t.TempDir()
+	for _, spec := range []string{"feature/x", "feature/x@abc123"} {
+		filename, err := r.pullBaseline(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := os.ReadFile(filename); string(b) != content {
+			t.Errorf("%s: got %q", spec, b)
+		}
+	}
+	if _, err := r.pullBaseline("main"); err == nil {
+		t.Error("expected error for missing baseline")
+	}
+
+	r.ServerToken = ""
+	if _, err := r.pullBaseline("feature/x"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected unauthorized, got %v", err)
+	}
+
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+	key := filepath.Join(t.TempDir(), "id_ed25519")
+	if output, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "bench", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("%s: %s", err, output)
+	}
+	pub, err := os.ReadFile(key + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed := filepath.Join(filepath.Dir(key), "allowed_signers")
+	if err := os.WriteFile(allowed, []byte("bench@example.com "+string(pub)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r = runner{config: c}
+	r.SignKey = key
+	r.Push = &pushCmd{Dir: dir}
+	if err := r.runPush(); err != nil {
+		t.Fatal(err)
+	}
+	r.Push = &pushCmd{Dir: dir, Commit: "def456"}
+	if err := r.runPush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r = runner{config: c}
+	r.OutDir = t.TempDir()
+	r.VerifyKey = allowed
+	for _, spec := range []string{"feature/x", "feature/x@abc123"} {
+		if _, err := r.pullBaseline(spec); err != nil {
+			t.Errorf("%s: %s", spec, err)
+		}
+	}
+
+	// Replay the signed results for abc123 as another commit and branch.
+	for _, path := range []string{"/v1/baselines/feature%2Fx/ghi789", "/v1/baselines/main/latest"} {
+		for _, suffix := range []string{"", ".manifest", ".manifest.sig"} {
+			stored[path+suffix] = stored["/v1/baselines/feature%2Fx/abc123"+suffix]
+		}
+	}
+	if _, err := r.pullBaseline("feature/x@ghi789"); err == nil || !strings.Contains(err.Error(), "signed for commit") {
+		t.Errorf("expected commit mismatch, got %v", err)
+	}
+	if _, err := r.pullBaseline("main"); err == nil || !strings.Contains(err.Error(), "signed for branch") {
+		t.Errorf("expected branch mismatch, got %v", err)
+	}
+
+	stored["/v1/baselines/feature%2Fx/abc123"] = "BenchmarkFoo 100 1 ns/op\n"
+	if _, err := r.pullBaseline("feature/x@abc123"); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// benchSet is a named selection of benchmarks in the config file, selected
+// with --set, e.g. {"smoke": "BenchmarkEncode|BenchmarkDecode"} or
+// {"full": {"bench": ".", "count": 10, "budget": "30m"}}.
+type benchSet struct {
+	Bench   string `json:"bench"`
+	Package string `json:"package"`
+	Count   int    `json:"count"`
+
+	// Budget is a duration, e.g. 20m, see --budget.
+	Budget string `json:"budget"`
+
+	// Counts replaces the counts in the config file for this set.
+	Counts []countOverride `json:"counts"`
+
+	budget time.Duration
+}
+
+// UnmarshalJSON accepts the bench pattern alone as a string.
+func (s *benchSet) UnmarshalJSON(b []byte) error {
+	var bench string
+	if err := json.Unmarshal(b, &bench); err == nil {
+		*s = benchSet{Bench: bench}
+		return nil
+	}
+	type plain benchSet
+	return json.Unmarshal(b, (*plain)(s))
+}
+
+func (s *benchSet) compile(name string) error {
+	if s.Count < 0 {
+		return fmt.Errorf("set %q: count must be at least 1", name)
+	}
+	if s.Budget != "" {
+		var err error
+		if s.budget, err = time.ParseDuration(s.Budget); err != nil {
+			return fmt.Errorf("set %q: invalid budget %q: %s", name, s.Budget, err)
+		}
+	}
+	for i := range s.Counts {
+		if err := s.Counts[i].compile(); err != nil {
+			return fmt.Errorf("set %q: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// applySet applies the --set from the config file. The flags set to other
+// than their defaults take precedence.
+func (c *config) applySet() error {
+	s, found := c.file.Sets[c.Set]
+	if !found {
+		var names []string
+		for name := range c.file.Sets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("no set %q in the config file, must be one of %v", c.Set, names)
+	}
+	if s.Bench != "" && c.Bench == defaultBench {
+		c.Bench = s.Bench
+	}
+	if s.Package != "" && c.Package == "." {
+		c.Package = s.Package
+	}
+	if c.Count == 0 {
+		c.Count = s.Count
+	}
+	if c.Budget == 0 {
+		c.Budget = s.budget
+	}
+	if len(s.Counts) > 0 {
+		c.file.Counts = s.Counts
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApplySet(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "gobench.json")
+	content := `{"sets": {
+		"smoke": "BenchmarkEncode|BenchmarkDecode",
+		"full": {"bench": ".", "package": "./...", "count": 10, "budget": "30m", "counts": [{"bench": "Macro", "count": 2}]}
+	}}`
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := loadFileConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := config{Bench: defaultBench, Package: ".", Set: "smoke", file: file}
+	if err := c.applySet(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Bench != "BenchmarkEncode|BenchmarkDecode" || c.Package != "." || c.Count != 0 {
+		t.Errorf("smoke: got %q %q %d", c.Bench, c.Package, c.Count)
+	}
+
+	c = config{Bench: defaultBench, Package: ".", Count: 3, Set: "full", file: file}
+	if err := c.applySet(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Bench != "." || c.Package != "./..." || c.Count != 3 || c.Budget != 30*time.Minute || len(c.file.Counts) != 1 {
+		t.Errorf("full: got %q %q %d %s %v", c.Bench, c.Package, c.Count, c.Budget, c.file.Counts)
+	}
+
+	c = config{Set: "nosuch", file: file}
+	if err := c.applySet(); err == nil {
+		t.Error("expected error for unknown set")
+	}
+}
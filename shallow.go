@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// fetchModes are the valid --fetch values.
+var fetchModes = []string{"auto", "never"}
+
+// maxDeepen is the max number of times to deepen a shallow clone by
+// --fetch-depth commits looking for the merge base.
+const maxDeepen = 10
+
+// commitHashRe matches full commit hashes, which can be fetched directly.
+var commitHashRe = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// ensureRef makes sure ref, and in a shallow clone the merge base of it and
+// HEAD, is available locally, fetching from --fetch-remote if needed.
+// This is common in CI, where repositories are often cloned with depth 1
+// and only the branch built.
+func (r runner) ensureRef(ref string) error {
+	if !r.hasCommit(ref) {
+		if r.Fetch == "never" {
+			return fmt.Errorf("%q not found in the repository and --fetch is never, fetch it first, e.g. git fetch %s %s", ref, r.FetchRemote, ref)
+		}
+		fmt.Printf("Fetch %q from %s\n", ref, r.FetchRemote)
+		if err := r.fetchRef(ref); err != nil {
+			return err
+		}
+		if !r.hasCommit(ref) {
+			return fmt.Errorf("%q not found after fetching from %s", ref, r.FetchRemote)
+		}
+	}
+
+	shallow, err := r.isShallow()
+	if err != nil || !shallow {
+		return err
+	}
+	for i := 0; ; i++ {
+		if _, err := gitOutput(r.workDir, "merge-base", "HEAD", ref); err == nil {
+			return nil
+		}
+		if r.Fetch == "never" || i == maxDeepen {
+			fmt.Printf("Warning: no merge base of HEAD and %q found in the shallow clone.\n", ref)
+			return nil
+		}
+		fmt.Printf("Deepen the shallow clone by %d commits looking for the merge base of HEAD and %q\n", r.FetchDepth, ref)
+		if _, err := gitOutput(r.workDir, "fetch", "--deepen="+strconv.Itoa(r.FetchDepth), r.FetchRemote); err != nil {
+			return err
+		}
+	}
+}
+
+// hasCommit reports whether ref resolves to a commit in the repository.
+func (r runner) hasCommit(ref string) bool {
+	_, err := gitOutput(r.workDir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	return err == nil
+}
+
+// isShallow reports whether the repository is a shallow clone.
+func (r runner) isShallow() (bool, error) {
+	shallow, err := gitOutput(r.workDir, "rev-parse", "--is-shallow-repository")
+	return shallow == "true", err
+}
+
+// fetchRef fetches ref into the local ref it names: a branch or tag on the
+// remote keeps its name, <remote>/<branch> updates the remote tracking branch
+// and a full commit hash is fetched as is. The fetch is limited to
+// --fetch-depth commits in a shallow clone only, as --depth would make a
+// full clone shallow.
+func (r runner) fetchRef(ref string) error {
+	shallow, err := r.isShallow()
+	if err != nil {
+		return err
+	}
+	fetch := func(refspec string) error {
+		args := []string{"fetch"}
+		if shallow {
+			args = append(args, "--depth="+strconv.Itoa(r.FetchDepth))
+		}
+		_, err := gitOutput(r.workDir, append(args, r.FetchRemote, refspec)...)
+		return err
+	}
+
+	if commitHashRe.MatchString(ref) {
+		return fetch(ref)
+	}
+	if branch := strings.TrimPrefix(ref, r.FetchRemote+"/"); branch != ref {
+		return fetch("+refs/heads/" + branch + ":refs/remotes/" + ref)
+	}
+
+	remoteRefs, err := gitOutput(r.workDir, "ls-remote", r.FetchRemote, ref)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(remoteRefs, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if name := fields[1]; name == "refs/heads/"+ref || name == "refs/tags/"+ref {
+			return fetch("+" + name + ":" + name)
+		}
+	}
+	return fmt.Errorf("%q not found in %s", ref, r.FetchRemote)
+}
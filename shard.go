@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// shardFilename is the name of the shard metadata written to --outdir with
+// --shard, read by gobench merge.
+const shardFilename = "shard.json"
+
+// shardInfo is the content of shard.json.
+type shardInfo struct {
+	Index int `json:"index"`
+	Total int `json:"total"`
+
+	// The result names and commits of the refs benchmarked.
+	Base          string `json:"base"`
+	Current       string `json:"current"`
+	BaseCommit    string `json:"baseCommit,omitempty"`
+	CurrentCommit string `json:"currentCommit,omitempty"`
+
+	// Bench is the --bench pattern before sharding and Benchmarks the top
+	// level benchmarks in this shard.
+	Bench      string   `json:"bench"`
+	Package    string   `json:"package"`
+	Benchmarks []string `json:"benchmarks"`
+}
+
+// parseShard parses a --shard value on the form index/total, e.g. 2/5.
+func parseShard(s string) (int, int, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid --shard %q, must be on the form index/total, e.g. 2/5", s)
+	}
+	index, err1 := strconv.Atoi(parts[0])
+	total, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || total < 1 || index < 1 || index > total {
+		return 0, 0, fmt.Errorf("invalid --shard %q, must be on the form index/total with 1 <= index <= total", s)
+	}
+	return index, total, nil
+}
+
+// inShard reports whether the benchmark name belongs to shard index of total.
+// The benchmarks are partitioned by a hash of their name, so a benchmark stays
+// in the same shard when others are added or removed.
+func inShard(name string, index, total int) bool {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32()%uint32(total)) == index-1
+}
+
+// selectShard restricts the benchmarks to run to those in --shard and writes
+// the shard metadata for first and second to --outdir. The benchmarks are
+// listed from the current code only, so benchmarks removed in it are in no
+// shard and aren't reported as removed.
+func (r *runner) selectShard(exeName, first, second string) error {
+	index, total, err := parseShard(r.Shard)
+	if err != nil {
+		return err
+	}
+	names, err := r.listBenchmarks(exeName, r.EnvCurrent)
+	if err != nil {
+		return err
+	}
+	info := shardInfo{
+		Index: index, Total: total,
+		Base: first, Current: second,
+		BaseCommit: r.refCommit(first), CurrentCommit: r.refCommit(second),
+		Bench: r.Bench, Package: r.Package,
+	}
+	for _, name := range names {
+		if inShard(name, index, total) && !contains(info.Benchmarks, name) {
+			info.Benchmarks = append(info.Benchmarks, name)
+		}
+	}
+
+	b, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(r.OutDir, shardFilename), append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+
+	if len(info.Benchmarks) == 0 {
+		fmt.Printf("No benchmarks in shard %s, nothing to benchmark.\n", r.Shard)
+		return errNothingToRun
+	}
+	fmt.Printf("Benchmark shard %s: %d of %d benchmarks\n", r.Shard, len(info.Benchmarks), len(names))
+	r.Bench = benchPattern(map[string][]string{"": info.Benchmarks})
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	if index, total, err := parseShard("2/5"); err != nil || index != 2 || total != 5 {
+		t.Fatalf("got %d/%d: %v", index, total, err)
+	}
+	for _, s := range []string{"0/5", "6/5", "2", "a/b"} {
+		if _, _, err := parseShard(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestInShard(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("Benchmark%d", i)
+		var n int
+		for index := 1; index <= 5; index++ {
+			if inShard(name, index, 5) {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Fatalf("%s is in %d shards", name, n)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// signTools are the tools supported to sign and verify results with.
+var signTools = []string{"ssh", "minisign"}
+
+// signatureNamespace is the ssh-keygen -Y namespace of the signatures, so
+// a signature made for another purpose with the same key isn't accepted.
+const signatureNamespace = "gobench"
+
+// signFile signs filename with the private key using tool, writing the
+// signature to filename.sig.
+func signFile(tool, key, filename string) error {
+	var cmd *exec.Cmd
+	switch tool {
+	case "minisign":
+		cmd = exec.Command("minisign", "-S", "-s", key, "-m", filename, "-x", filename+".sig")
+	default:
+		// ssh-keygen doesn't overwrite an existing signature.
+		os.Remove(filename + ".sig")
+		cmd = exec.Command("ssh-keygen", "-q", "-Y", "sign", "-f", key, "-n", signatureNamespace, filename)
+	}
+	// The key may be protected by a passphrase.
+	cmd.Stdin = os.Stdin
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to sign %s: %s: %s", filename, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// verifyFile verifies the signature of filename in sigFilename using tool
+// with key, a minisign public key file or an ssh allowed signers file.
+func verifyFile(tool, key, filename, sigFilename string) error {
+	var cmd *exec.Cmd
+	switch tool {
+	case "minisign":
+		cmd = exec.Command("minisign", "-V", "-q", "-p", key, "-m", filename, "-x", sigFilename)
+	default:
+		principals, err := exec.Command("ssh-keygen", "-Y", "find-principals", "-f", key, "-s", sigFilename).Output()
+		if err != nil {
+			return fmt.Errorf("the signature of %s is not made by any of the keys in %s", filename, key)
+		}
+		principal := strings.TrimSpace(strings.Split(string(principals), "\n")[0])
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		cmd = exec.Command("ssh-keygen", "-Y", "verify", "-f", key, "-I", principal, "-n", signatureNamespace, "-s", sigFilename)
+		cmd.Stdin = f
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("invalid signature for %s: %s", filename, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// signResults signs the result files for the refs benchmarked with
+// --sign-key.
+func (r runner) signResults(names ...string) error {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if err := signFile(r.SignTool, r.SignKey, r.benchOutFilename(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyDownload writes the signature sig of the downloaded filename next
+// to it and verifies it with --verify-key.
+func (r runner) verifyDownload(filename string, sig []byte) error {
+	sigFilename := filename + ".sig"
+	if err := os.WriteFile(sigFilename, sig, 0o644); err != nil {
+		return err
+	}
+	return verifyFile(r.SignTool, r.VerifyKey, filename, sigFilename)
+}
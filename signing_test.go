@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignAndVerifySSH(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+	dir := t.TempDir()
+	key := filepath.Join(dir, "id_ed25519")
+	if output, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "bench", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("%s: %s", err, output)
+	}
+	pub, err := os.ReadFile(key + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed := filepath.Join(dir, "allowed_signers")
+	if err := os.WriteFile(allowed, []byte("bench@example.com "+string(pub)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(dir, "main.bench")
+	if err := os.WriteFile(filename, []byte("BenchmarkFoo 100 10 ns/op\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := signFile("ssh", key, filename); err != nil {
+		t.Fatal(err)
+	}
+	// Signing again replaces the signature.
+	if err := signFile("ssh", key, filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyFile("ssh", allowed, filename, filename+".sig"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filename, []byte("BenchmarkFoo 100 1 ns/op\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyFile("ssh", allowed, filename, filename+".sig"); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("expected invalid signature for edited file, got %v", err)
+	}
+
+	other := filepath.Join(dir, "other_signers")
+	if err := os.WriteFile(other, []byte("other@example.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyFile("ssh", other, filename, filename+".sig"); err == nil {
+		t.Error("expected error for signature by an unknown key")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const stateFilename = "gobench-state.json"
+
+// runState holds the progress of a run, persisted to the out dir after each
+// completed benchmark run so an interrupted run can be resumed.
+type runState struct {
+	Bench   string `json:"bench"`
+	Package string `json:"package"`
+	Count   int    `json:"count"`
+	First   string `json:"first"`
+	Second  string `json:"second"`
+
+	// Completed maps a ref name to the number of completed counts.
+	Completed map[string]int `json:"completed"`
+
+	// Offsets maps a ref name to the size of its result file after the
+	// last completed count. Anything after that is from an interrupted run.
+	Offsets map[string]int64 `json:"offsets"`
+
+	// Retries maps a ref name to the number of retried runs.
+	Retries map[string]int `json:"retries,omitempty"`
+
+	// Throttled maps a ref name to the number of runs where thermal
+	// throttling was detected.
+	Throttled map[string]int `json:"throttled,omitempty"`
+
+	// FailedPackages maps a ref name to the packages that failed and were
+	// left out with --keep-going.
+	FailedPackages map[string][]string `json:"failedPackages,omitempty"`
+
+	// Chunks holds the chunks of counts run with --alternate, in order.
+	Chunks []runChunk `json:"chunks,omitempty"`
+
+	filename string
+}
+
+func newRunState(c config, first, second string) *runState {
+	return &runState{
+		Bench:          c.Bench,
+		Package:        c.Package,
+		Count:          c.Count,
+		First:          first,
+		Second:         second,
+		Completed:      make(map[string]int),
+		Offsets:        make(map[string]int64),
+		Retries:        make(map[string]int),
+		Throttled:      make(map[string]int),
+		FailedPackages: make(map[string][]string),
+		filename:       filepath.Join(c.OutDir, stateFilename),
+	}
+}
+
+// loadRunState loads the state from the out dir and verifies that it
+// matches the current configuration.
+// If no state file is found, a fresh state is returned.
+func loadRunState(c config, first, second string) (*runState, error) {
+	s := newRunState(c, first, second)
+	b, err := os.ReadFile(s.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Printf("No state found in %s, starting from scratch.\n", c.OutDir)
+			return s, nil
+		}
+		return nil, err
+	}
+
+	var saved runState
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %s", s.filename, err)
+	}
+
+	if saved.Bench != s.Bench || saved.Package != s.Package || saved.Count != s.Count {
+		return nil, fmt.Errorf("state in %s was recorded with bench %q, package %q and count %d, which does not match the current run", s.filename, saved.Bench, saved.Package, saved.Count)
+	}
+	if saved.First != s.First || saved.Second != s.Second {
+		return nil, fmt.Errorf("state in %s was recorded for %q and %q, not %q and %q", s.filename, saved.First, saved.Second, s.First, s.Second)
+	}
+
+	if saved.Completed != nil {
+		s.Completed = saved.Completed
+	}
+	if saved.Offsets != nil {
+		s.Offsets = saved.Offsets
+	}
+	if saved.Retries != nil {
+		s.Retries = saved.Retries
+	}
+	if saved.Throttled != nil {
+		s.Throttled = saved.Throttled
+	}
+	if saved.FailedPackages != nil {
+		s.FailedPackages = saved.FailedPackages
+	}
+	s.Chunks = saved.Chunks
+
+	return s, nil
+}
+
+// retried records a retried run for the given ref.
+func (s *runState) retried(name string) {
+	s.Retries[name]++
+}
+
+// throttled records a run for the given ref where throttling was detected.
+func (s *runState) throttled(name string) {
+	s.Throttled[name]++
+}
+
+// failedPackages records packages that failed for the given ref.
+func (s *runState) failedPackages(name string, packages []string) {
+	s.FailedPackages[name] = append(s.FailedPackages[name], packages...)
+}
+
+// complete marks n more counts for the given ref as completed, with the
+// result file now having the given size, and saves the state.
+func (s *runState) complete(name string, n int, size int64) error {
+	s.Completed[name] += n
+	s.Offsets[name] = size
+	return s.save()
+}
+
+// addChunk records a completed chunk and saves the state.
+func (s *runState) addChunk(c runChunk) error {
+	s.Chunks = append(s.Chunks, c)
+	return s.save()
+}
+
+func (s *runState) save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.filename, b, 0o644)
+}
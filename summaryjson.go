@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// summaryFilename is the name of the machine readable summary written to
+// --outdir for every run, whatever the --format.
+const summaryFilename = "summary.json"
+
+// runSummary is the content of summary.json.
+type runSummary struct {
+	// The commits benchmarked, empty if not a git ref, e.g. a base file.
+	BaseCommit    string `json:"baseCommit,omitempty"`
+	CurrentCommit string `json:"currentCommit,omitempty"`
+
+	// Passed is false if the threshold or --fail-on-removed failed the run.
+	Passed bool `json:"passed"`
+
+	// Artifacts holds the paths of all files written by the run.
+	Artifacts []string `json:"artifacts"`
+
+	// The comparison, nil when there is nothing to compare with.
+	*summary
+}
+
+// writeSummaryJSON writes summary.json to --outdir for the results for base
+// and current compared in s, which is nil if there was no base.
+func (r runner) writeSummaryJSON(base, current string, s *summary) error {
+	rs := runSummary{Passed: true, summary: s}
+	if s == nil {
+		rs.summary = &summary{Current: current}
+		r.addRunCounts(rs.summary, current)
+	} else {
+		rs.Passed = r.passed(s)
+	}
+	if r.standardRun() {
+		rs.BaseCommit = r.refCommit(base)
+		rs.CurrentCommit = r.refCommit(current)
+	}
+
+	filename := filepath.Join(r.OutDir, summaryFilename)
+	var err error
+	if rs.Artifacts, err = r.artifacts(filename); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(rs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(b, '\n'), 0o644)
+}
+
+// passed reports whether the comparison in s passes the threshold and, with
+// --fail-on-removed, has no removed benchmarks.
+func (r runner) passed(s *summary) bool {
+	return len(s.Violations) == 0 && !(r.FailOnRemoved && len(s.Removed) > 0)
+}
+
+// refCommit returns the commit hash for the benchmarked ref name, empty if
+// it's not a git ref.
+func (r runner) refCommit(name string) string {
+	switch {
+	case name == "":
+		return ""
+	case name == r.currentBranch || name == "stash":
+		// The stash is relative to HEAD.
+		name = "HEAD"
+	case r.externalBase():
+		return ""
+	}
+	for _, ref := range []string{name, strings.TrimSuffix(name, "-base")} {
+		if sha, err := gitOutput(r.workDir, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err == nil {
+			return sha
+		}
+	}
+	return ""
+}
+
+// artifacts returns the sorted paths of the files in --outdir and the
+// reports written elsewhere, apart from exclude.
+func (r runner) artifacts(exclude string) ([]string, error) {
+	var filenames []string
+	walk := func(dir string) error {
+		return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && path != exclude {
+				filenames = append(filenames, path)
+			}
+			return nil
+		})
+	}
+
+	if err := walk(r.OutDir); err != nil {
+		return nil, err
+	}
+	if r.Charts != "" {
+		dir, err := filepath.Abs(r.Charts)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(dir, r.OutDir+string(filepath.Separator)) {
+			if err := walk(dir); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, filename := range []string{r.JUnit, r.Badge} {
+		if filename == "" {
+			continue
+		}
+		filename, err := filepath.Abs(filename)
+		if err != nil {
+			return nil, err
+		}
+		if !contains(filenames, filename) {
+			filenames = append(filenames, filename)
+		}
+	}
+
+	sort.Strings(filenames)
+	return filenames, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// sweep declares a parameter sweep in the config file: the benchmarks are
+// run once per value with the environment variable Env set to it, e.g.
+// {"env": "SIZE", "values": ["1K", "64K", "1M"]}.
+type sweep struct {
+	Env    string   `json:"env"`
+	Values []string `json:"values"`
+}
+
+// label returns the sub-benchmark name part identifying value.
+func (s sweep) label(value string) string {
+	return s.Env + "=" + value
+}
+
+// labelName adds label as a sub-benchmark to the benchmark name, before the
+// -N GOMAXPROCS suffix, e.g. BenchmarkFoo/SIZE=1K-8.
+func labelName(name, label string) string {
+	trimmed := trimProcsSuffix(name)
+	return trimmed + "/" + label + name[len(trimmed):]
+}
+
+// labelWriter adds a label to the benchmark names in the lines written to w.
+type labelWriter struct {
+	w     io.Writer
+	label string
+	buf   []byte
+}
+
+func (lw *labelWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i == -1 {
+			break
+		}
+		line := string(lw.buf[:i])
+		lw.buf = lw.buf[i+1:]
+		if res, ok := parseBenchResult(line); ok {
+			res.Name = labelName(res.Name, lw.label)
+			line = res.String()
+		}
+		if _, err := io.WriteString(lw.w, line+"\n"); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flush writes any incomplete last line.
+func (lw *labelWriter) flush() error {
+	if len(lw.buf) == 0 {
+		return nil
+	}
+	_, err := lw.w.Write(lw.buf)
+	lw.buf = nil
+	return err
+}
+
+// renderSweepTable renders a table with the mean value per benchmark and
+// unit (rows) for each sweep value (columns).
+func renderSweepTable(bf *benchFile, s sweep) string {
+	type row struct {
+		name, unit string
+	}
+	var rows []row
+	cells := make(map[row]map[string]float64)
+	for key, values := range bf.samples() {
+		for _, value := range s.Values {
+			label := "/" + s.label(value)
+			trimmed := trimProcsSuffix(key.name)
+			if !strings.HasSuffix(trimmed, label) {
+				continue
+			}
+			r := row{name: strings.TrimSuffix(trimmed, label) + key.name[len(trimmed):], unit: key.unit}
+			if cells[r] == nil {
+				cells[r] = make(map[string]float64)
+				rows = append(rows, r)
+			}
+			cells[r][value] = mean(values)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].name != rows[j].name {
+			return rows[i].name < rows[j].name
+		}
+		return rows[i].unit < rows[j].unit
+	})
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tunit\t%s\n", s.Env, strings.Join(s.Values, "\t"))
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%s", r.name, r.unit)
+		for _, value := range s.Values {
+			if v, found := cells[r][value]; found {
+				fmt.Fprintf(w, "\t%.4g", v)
+			} else {
+				fmt.Fprint(w, "\t-")
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	return buf.String()
+}
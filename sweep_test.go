@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestSweep(t *testing.T) {
+	s := sweep{Env: "SIZE", Values: []string{"1K", "1M"}}
+
+	var buf bytes.Buffer
+	for i, value := range s.Values {
+		lw := &labelWriter{w: &buf, label: s.label(value)}
+		io.WriteString(lw, "pkg: example.com/p\nBenchmarkFoo-8\t10\t")
+		io.WriteString(lw, []string{"100 ns/op\n", "900 ns/op\n"}[i])
+		if err := lw.flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bf, err := parseBenchFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bf.Results) != 2 || bf.Results[1].Name != "BenchmarkFoo/SIZE=1M-8" {
+		t.Fatalf("unexpected results: %v", bf.Results)
+	}
+
+	assertContainsAll(t, renderSweepTable(bf, s),
+		"SIZE            unit   1K   1M",
+		"BenchmarkFoo-8  ns/op  100  900")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// throttleModes are the valid values for --on-throttle.
+var throttleModes = []string{"warn", "retry", "discard"}
+
+// maxThrottleDiscards is the max number of throttled runs in a row to
+// discard with --on-throttle discard before giving up.
+const maxThrottleDiscards = 5
+
+// throttleMonitor detects thermal throttling of the CPU while a benchmark
+// chunk runs.
+type throttleMonitor struct {
+	// Linux: the sum of the thermal throttle event counters at start.
+	count int64
+
+	// macOS: set when a sample showed a CPU speed limit below 100%.
+	mu        sync.Mutex
+	throttled bool
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// startThrottleMonitor starts monitoring for throttling. Only Linux (with
+// the thermal_throttle counters in sysfs) and macOS are supported; on other
+// systems throttling is never detected.
+func startThrottleMonitor() *throttleMonitor {
+	m := &throttleMonitor{}
+	switch runtime.GOOS {
+	case "linux":
+		m.count = throttleCount()
+	case "darwin":
+		m.done = make(chan struct{})
+		m.wg.Add(1)
+		go m.sample()
+	}
+	return m
+}
+
+// stop stops the monitor and reports whether throttling was detected.
+func (m *throttleMonitor) stop() bool {
+	switch runtime.GOOS {
+	case "linux":
+		return throttleCount() > m.count
+	case "darwin":
+		close(m.done)
+		m.wg.Wait()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.throttled
+	}
+	return false
+}
+
+// throttleCount returns the sum of the core and package thermal throttle
+// event counters for all CPUs.
+func throttleCount() int64 {
+	var sum int64
+	files, _ := filepath.Glob("/sys/devices/system/cpu/cpu*/thermal_throttle/*_throttle_count")
+	for _, file := range files {
+		n, _ := strconv.ParseInt(readSysFile(file), 10, 64)
+		sum += n
+	}
+	return sum
+}
+
+var cpuSpeedLimitRe = regexp.MustCompile(`CPU_Speed_Limit\s*=\s*(\d+)`)
+
+func (m *throttleMonitor) sample() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+		out, err := exec.Command("pmset", "-g", "therm").Output()
+		if err != nil {
+			continue
+		}
+		if match := cpuSpeedLimitRe.FindSubmatch(out); match != nil {
+			if limit, _ := strconv.Atoi(string(match[1])); limit < 100 {
+				m.mu.Lock()
+				m.throttled = true
+				m.mu.Unlock()
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unitMeta holds the semantics of a benchmark unit, declared in the results
+// with benchfmt unit metadata lines, e.g. "Unit ns/op better=lower", or in
+// the config file.
+type unitMeta struct {
+	// Better is lower or higher, empty for the default (higher for units
+	// ending in /s, else lower).
+	Better string `json:"better"`
+
+	// Assume is nothing or exact. Exact values have no noise, so any
+	// change is significant.
+	Assume string `json:"assume"`
+}
+
+func (m unitMeta) validate(unit string) error {
+	if m.Better != "" && m.Better != "lower" && m.Better != "higher" {
+		return fmt.Errorf("invalid better=%q for unit %q, must be lower or higher", m.Better, unit)
+	}
+	if m.Assume != "" && m.Assume != "nothing" && m.Assume != "exact" {
+		return fmt.Errorf("invalid assume=%q for unit %q, must be nothing or exact", m.Assume, unit)
+	}
+	return nil
+}
+
+// merge returns m with the fields set in other overriding.
+func (m unitMeta) merge(other unitMeta) unitMeta {
+	if other.Better != "" {
+		m.Better = other.Better
+	}
+	if other.Assume != "" {
+		m.Assume = other.Assume
+	}
+	return m
+}
+
+// higherIsBetter reports whether higher values are better for unit.
+func (m unitMeta) higherIsBetter(unit string) bool {
+	if m.Better != "" {
+		return m.Better == "higher"
+	}
+	return !lowerIsBetter(unit)
+}
+
+// parseBenchUnit parses a unit metadata line on the form
+// "Unit ns/op assume=exact better=lower".
+// Unknown keys are ignored.
+func parseBenchUnit(line string) (string, unitMeta, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "Unit" {
+		return "", unitMeta{}, false
+	}
+	var m unitMeta
+	for _, f := range fields[2:] {
+		i := strings.Index(f, "=")
+		if i <= 0 {
+			return "", unitMeta{}, false
+		}
+		switch f[:i] {
+		case "better":
+			m.Better = f[i+1:]
+		case "assume":
+			m.Assume = f[i+1:]
+		}
+	}
+	return fields[1], m, true
+}
+
+// unitMetas returns the unit semantics to use when comparing bf1 and bf2:
+// the metadata in the result files, overridden by the config file and then
+// by --higher-is-better.
+func (r runner) unitMetas(bf1, bf2 *benchFile) map[string]unitMeta {
+	units := make(map[string]unitMeta)
+	set := func(unit string, m unitMeta) {
+		units[unit] = units[unit].merge(m)
+	}
+	for _, bf := range []*benchFile{bf1, bf2} {
+		for unit, m := range bf.Units {
+			set(unit, m)
+		}
+	}
+	for unit, m := range r.file.Units {
+		set(unit, m)
+	}
+	for _, unit := range splitList(r.HigherIsBetter) {
+		set(unit, unitMeta{Better: "higher"})
+	}
+	return units
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// updateCheckInterval is the min time between checks for a new release.
+const updateCheckInterval = 24 * time.Hour
+
+// maxUpdateHighlights is the max number of changelog lines to print.
+const maxUpdateHighlights = 3
+
+// updateCheck is the cached result of the last check for a new release.
+type updateCheck struct {
+	Checked time.Time `json:"checked"`
+	Latest  string    `json:"latest"`
+
+	// Highlights holds the changelog lines for the latest release
+	// mentioning flags.
+	Highlights []string `json:"highlights"`
+}
+
+var changelogFlagRe = regexp.MustCompile("`?--[a-z][a-z-]*")
+
+// checkForUpdate prints a notice to stderr if a newer gobench release is
+// available. GitHub is asked at most once per updateCheckInterval, the
+// result is cached in the user cache dir. Any errors are ignored. It's
+// skipped in CI and when stdout isn't a terminal, e.g. when the output is
+// piped to benchstat.
+func checkForUpdate() {
+	if os.Getenv("CI") != "" || !isTerminal(os.Stdout) {
+		return
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return
+	}
+	filename := filepath.Join(dir, "gobench", "update-check.json")
+
+	var check updateCheck
+	if b, err := os.ReadFile(filename); err == nil {
+		json.Unmarshal(b, &check)
+	}
+
+	if time.Since(check.Checked) > updateCheckInterval {
+		check.Checked = time.Now()
+		// Don't hold up the run for a slow network.
+		client := &http.Client{Timeout: 2 * time.Second}
+		if rel, err := latestReleaseWith(client); err == nil {
+			check.Latest = rel.TagName
+			check.Highlights = changelogHighlights(rel.Body)
+		}
+		if b, err := json.Marshal(check); err == nil {
+			os.MkdirAll(filepath.Dir(filename), 0o777)
+			os.WriteFile(filename, b, 0o666)
+		}
+	}
+
+	if check.Latest == "" || !newerVersion(check.Latest, version) {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "gobench %s is available (you have %s), run gobench self-update to update.\n", check.Latest, version)
+	for _, line := range check.Highlights {
+		fmt.Fprintf(os.Stderr, "  %s\n", line)
+	}
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// changelogHighlights returns the first lines of the release notes that
+// mention flags, e.g. "* Add --foo to bar".
+func changelogHighlights(body string) []string {
+	var highlights []string
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "*-"))
+		if line == "" || !changelogFlagRe.MatchString(line) {
+			continue
+		}
+		highlights = append(highlights, line)
+		if len(highlights) == maxUpdateHighlights {
+			break
+		}
+	}
+	return highlights
+}
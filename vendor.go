@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var validModFlags = []string{"mod", "vendor", "readonly"}
+
+// modFlag returns the -mod flag to use for the currently checked out ref,
+// adjusted so refs with and without a vendor directory both build.
+// An empty string means to use the go command's default.
+func (r runner) modFlag(exeName string) string {
+	mod := r.Mod
+	if mod == "" {
+		mod = goflagsMod()
+	}
+	if mod != "vendor" {
+		return r.Mod
+	}
+	if hasVendorDir(exeName, r.workDir) {
+		return r.Mod
+	}
+	fmt.Println("No vendor directory found for this ref, using -mod=mod.")
+	return "mod"
+}
+
+// goflagsMod returns the -mod value set in GOFLAGS, if any.
+func goflagsMod() string {
+	for _, flag := range strings.Fields(os.Getenv("GOFLAGS")) {
+		if strings.HasPrefix(flag, "-mod=") {
+			return strings.TrimPrefix(flag, "-mod=")
+		}
+	}
+	return ""
+}
+
+// hasVendorDir reports whether the main module in dir has a vendor directory.
+func hasVendorDir(exeName, dir string) bool {
+	cmd := exec.Command(exeName, "env", "GOMOD")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return false
+	}
+	gomod := strings.TrimSpace(string(output))
+	if gomod == "" || gomod == os.DevNull {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(filepath.Dir(gomod), "vendor", "modules.txt"))
+	return err == nil
+}
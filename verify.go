@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// verifyTests runs the unit tests for the current code, uncached, so broken
+// code isn't benchmarked.
+func (r runner) verifyTests(exeName, name string) error {
+	fmt.Printf("Run the tests for %q.\n", name)
+	args := []string{"test", "-count=1"}
+	if r.Tags != "" {
+		args = append(args, "-tags", r.Tags)
+	}
+	if r.Race {
+		args = append(args, "-race")
+	}
+	if mod := r.modFlag(exeName); mod != "" {
+		args = append(args, "-mod="+mod)
+	}
+	args = append(args, r.packageArgs()...)
+
+	cmd := commandContext(r.context(), exeName, args...)
+	cmd.Dir = r.workDir
+	if env := append(append([]string(nil), r.Env...), r.EnvCurrent...); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("the tests for %q failed, not benchmarking: %s", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// withExeSuffix adds the .exe suffix on Windows to paths to executables
+// without an extension, e.g. GOEXE=C:\go1.17\bin\go.
+func withExeSuffix(name string) string {
+	if runtime.GOOS != "windows" || filepath.Ext(name) != "" || !strings.ContainsAny(name, `/\`) {
+		// Plain names are resolved with PATHEXT by exec.LookPath.
+		return name
+	}
+	return name + ".exe"
+}
+
+// fileNameReplacer replaces slashes in branch names and the characters not
+// allowed in filenames on Windows.
+var fileNameReplacer = strings.NewReplacer(
+	"/", "-", `\`, "-", ":", "-", "*", "-", "?", "-", `"`, "-", "<", "-", ">", "-", "|", "-",
+)
+
+// callgrindViewer returns the path to the callgrind viewer to use, empty if
+// none is installed, which is usually the case on Windows.
+func callgrindViewer() string {
+	for _, name := range []string{"qcachegrind", "kcachegrind"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	return ""
+}
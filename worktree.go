@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// addWorktree checks out ref in a new temporary git worktree, limited to the
+// sparse-checkout cone of the directories in sparse if not empty.
+// It returns the directory in the worktree matching the current working
+// directory and a function that removes the worktree.
+func addWorktree(ref string, sparse []string) (string, func(), error) {
+	prefix, err := exec.Command("git", "rev-parse", "--show-prefix").Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve git prefix: %s", err)
+	}
+
+	root, err := os.MkdirTemp("", "gobench-worktree")
+	if err != nil {
+		return "", nil, err
+	}
+
+	args := []string{"worktree", "add", "--detach", root, ref}
+	if len(sparse) > 0 {
+		// The files in the cone are checked out below.
+		args = []string{"worktree", "add", "--no-checkout", "--detach", root, ref}
+	}
+	output, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		os.RemoveAll(root)
+		return "", nil, fmt.Errorf("failed to add worktree for %q: %s: %s", ref, err, output)
+	}
+
+	remove := func() {
+		if output, err := exec.Command("git", "worktree", "remove", "--force", root).CombinedOutput(); err != nil {
+			fmt.Printf("Warning: failed to remove worktree %s: %s: %s\n", root, err, output)
+		}
+		os.RemoveAll(root)
+	}
+
+	if len(sparse) > 0 {
+		// The sparse-checkout settings are per worktree.
+		if _, err := gitOutput(root, append([]string{"sparse-checkout", "set", "--cone"}, sparse...)...); err != nil {
+			remove()
+			return "", nil, err
+		}
+		if _, err := gitOutput(root, "read-tree", "-mu", "HEAD"); err != nil {
+			remove()
+			return "", nil, err
+		}
+	}
+
+	return filepath.Join(root, strings.TrimSpace(string(prefix))), remove, nil
+}
+
+// addWorktree checks out ref in a new temporary git worktree, with --sparse
+// limited to the directories of the packages to benchmark and their dependencies.
+func (r runner) addWorktree(ref string) (string, func(), error) {
+	var sparse []string
+	if r.Sparse {
+		var err error
+		if sparse, err = r.sparseDirs(); err != nil {
+			return "", nil, err
+		}
+	}
+	return addWorktree(ref, sparse)
+}
+
+// sparseDirs returns the directories, relative to the repository root, of
+// the packages to benchmark and the packages in the repository they depend
+// on, also in tests. The dependencies are resolved in the current code,
+// so a base with dependencies since removed may need a full checkout.
+func (r runner) sparseDirs() ([]string, error) {
+	root, err := gitOutput(r.workDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"list", "-deps", "-test", "-f", "{{.Dir}}"}
+	if r.Tags != "" {
+		args = append(args, "-tags", r.Tags)
+	}
+	cmd := exec.Command(goExe, append(args, r.packageArgs()...)...)
+	cmd.Dir = r.workDir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the package dependencies: %s", err)
+	}
+
+	var dirs []string
+	for _, dir := range strings.Split(string(output), "\n") {
+		rel, err := filepath.Rel(root, dir)
+		if dir == "" || err != nil || strings.HasPrefix(rel, "..") {
+			// In GOROOT or the module cache.
+			continue
+		}
+		if rel = filepath.ToSlash(rel); rel != "." && !contains(dirs, rel) {
+			dirs = append(dirs, rel)
+		}
+	}
+	if len(dirs) == 0 {
+		// Only the files in the root are needed.
+		dirs = append(dirs, ".")
+	}
+	return dirs, nil
+}